@@ -1,12 +1,36 @@
 package actions
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/ratelimit"
+	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/suite/v4"
+	"github.com/gobuffalo/x/sessions"
+	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	// The suites sign in far more often than the auth rate limit allows
+	config.Get().RateLimit.Auth = ratelimit.PerMinute(10000)
+	// App() holds on to models.DB; tests without a database still run
+	if err := modelstest.Open(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
 type ActionSuite struct {
 	*suite.Action
 }
@@ -22,3 +46,53 @@ func Test_ActionSuite(t *testing.T) {
 	}
 	suite.Run(t, as)
 }
+
+// newTestApp builds a bare app, without sessions or a database, using the
+// problem error handlers, request IDs, translations and then mw
+func newTestApp(mw ...buffalo.MiddlewareFunc) *buffalo.App {
+	a := buffalo.New(buffalo.Options{Env: "test", SessionStore: sessions.Null{}})
+	useProblemErrors(a)
+	a.Use(RequestIDMiddleware)
+	a.Use(translations())
+	a.Use(mw...)
+	return a
+}
+
+// newRequest returns a JSON request with header as name and value pairs.
+// A string body is sent as is and any other non-nil body is encoded.
+func newRequest(method, path string, body any, header ...string) *http.Request {
+	var r io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(body)
+	default:
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		r = &buf
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return req
+}
+
+func serveRequest(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
+
+// serve sends newRequest(method, path, body, header...) to h
+func serve(h http.Handler, method, path string, body any, header ...string) *httptest.ResponseRecorder {
+	return serveRequest(h, newRequest(method, path, body, header...))
+}
+
+func problemOf(t *testing.T, res *httptest.ResponseRecorder) apperrors.Problem {
+	t.Helper()
+	var problem apperrors.Problem
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &problem), res.Body.String())
+	return problem
+}
@@ -1,22 +1,31 @@
 package actions
 
 import (
+	"net/http"
 	"sync"
+	"time"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/flags"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
 	"github.com/akingundogdu/production-ready-go-backend-architecture/locales"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/maintenance"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/envy"
 	"github.com/gobuffalo/middleware/contenttype"
 	"github.com/gobuffalo/middleware/forcessl"
 	"github.com/gobuffalo/middleware/i18n"
-	"github.com/gobuffalo/middleware/paramlogger"
 	"github.com/gobuffalo/x/sessions"
 	"github.com/rs/cors"
 	"github.com/unrolled/secure"
 )
 
 // ENV is used to help switch settings based on where the
-// application is being run. Default is "development".
+// application is being run. Default is "development". It is read from
+// GO_ENV like config.Config.Env, not from config.Get, which must not run
+// before main has parsed the flags.
 var ENV = envy.Get("GO_ENV", "development")
 
 var (
@@ -40,39 +49,165 @@ var (
 // declared after it to never be called.
 func App() *buffalo.App {
 	appOnce.Do(func() {
+		cfg := config.Get()
+
+		// Security headers and CORS apply to every response, preflight
+		// and not found responses included
+		security, securityErr := securityOptions(cfg.Security)
+
 		app = buffalo.New(buffalo.Options{
 			Env:          ENV,
+			Addr:         cfg.Server.Addr(),
 			SessionStore: sessions.Null{},
 			PreWares: []buffalo.PreWare{
-				cors.Default().Handler,
+				SecurityHeaders(security),
+				cors.New(corsOptions(cfg.CORS)).Handler,
 			},
 			SessionName: "_production_ready_go_backend_session",
+			Logger:      logging.NewBuffaloLogger(logging.For("http")),
 		})
 
+		if securityErr != nil {
+			app.Stop(securityErr)
+		}
+
+		// The repositories handlers are built with
+		deps := newContainer()
+
+		// Render every error as application/problem+json
+		useProblemErrors(app)
+
+		// Replace buffalo's request logger with structured request logs
+		// that carry the request and trace IDs
+		app.Middleware.Remove(buffalo.RequestLogger)
+		app.Use(RequestIDMiddleware)
+
+		// Trace every request, continuing any incoming W3C trace context
+		app.Use(TracingMiddleware)
+		app.Use(RequestLoggingMiddleware)
+
+		// Rotate the JWT keys when their secrets change
+		if cfg.Secrets.Refresh > 0 {
+			lifecycle.Append(secretsRefreshJob(cfg.Secrets.Refresh))
+		}
+
+		// Answer panics with a bare 500 problem and record them, grouped
+		// by fingerprint
+		errorEvents, err := newErrorEventStore()
+		if err != nil {
+			app.Stop(err)
+		}
+		app.Use(Recovery(errorEvents))
+
+		// Feature flags, cached in memory and reloaded when any replica
+		// changes one; FlagOn and RequireFlag check them
+		flagStore, err := newFlagStore(cfg.Flags)
+		if err != nil {
+			app.Stop(err)
+		}
+		featureFlags := flags.NewCache(flagStore)
+		if _, ok := flagStore.(*flags.PostgresStore); ok {
+			lifecycle.Append(listenJob("flags", models.DB.URL(), flags.Channel, featureFlags.Refresh))
+		}
+		app.Use(FeatureFlags(featureFlags))
+
+		// Route read-only queries to healthy read replicas that keep up
+		// with the primary, except right after a client writes
+		if models.Replicas.Len() > 0 {
+			lifecycle.Append(replicasCheckJob(models.Replicas, cfg.Database.ReplicaCheckInterval))
+		}
+		app.Use(ReadReplicas(models.Replicas, cfg.Database.PrimaryAfterWrite))
+
+		// Bound the duration and body size of requests, per route
+		limits, perRoute, err := requestLimitsFromEnv()
+		if err != nil {
+			app.Stop(err)
+		}
+		app.Use(RequestLimits(limits, perRoute))
+
 		// Automatically redirect to SSL
 		app.Use(forceSSL())
 
-		// Log request parameters (filters apply).
-		app.Use(paramlogger.ParameterLogger)
+		// Log request parameters, headers and JSON bodies (secrets are redacted).
+		app.Use(ParameterLoggingMiddleware)
 
 		// Set the request content type to JSON
 		app.Use(contenttype.Set("application/json"))
 
+		// Negotiate the language of API messages from Accept-Language
+		app.Use(translations())
+
+		// Maintenance mode, set by configuration or by admins and shared
+		// through the database. Health probes, allowed networks and admins
+		// are still served.
+		maintenanceStore, err := newMaintenanceStore(cfg.Maintenance)
+		if err != nil {
+			app.Stop(err)
+		}
+		maintenanceSwitch := maintenance.NewSwitch(maintenanceStore, forcedMaintenance(cfg.Maintenance))
+		if _, ok := maintenanceStore.(*maintenance.PostgresStore); ok {
+			lifecycle.Append(listenJob("maintenance", models.DB.URL(), maintenance.Channel, maintenanceSwitch.Refresh))
+		}
+		maintenanceAllowed, err := cfg.Maintenance.Networks()
+		if err != nil {
+			app.Stop(err)
+		}
+		app.Use(Maintenance(maintenanceSwitch, maintenanceAllowed, deps.Users))
+
+		// Enforce the OpenAPI contract; outside production also report
+		// responses that drift from it
+		app.Use(contractValidation())
+
 		// Health check routes
 		// These should be at the top for quick health monitoring
 		app.GET("/health", HealthHandler)
 		app.GET("/health/live", LivenessHandler)
 		app.GET("/health/ready", ReadinessHandler)
+
+		// API documentation, generated from the routes below
+		app.GET("/openapi.json", OpenAPIHandler)
+		if ENV != "production" {
+			app.GET("/docs", DocsHandler)
+		}
 		
+		// Rate limits: strict per IP on sign in and sign up, looser per
+		// user on the API. Health probes are exempt.
+		rateLimits, err := newRateLimitStore(cfg.RateLimit)
+		if err != nil {
+			app.Stop(err)
+		}
+		authLimit, apiLimit := cfg.RateLimit.Auth, cfg.RateLimit.API
+
+		// Replay responses of retried unsafe requests sent with an
+		// Idempotency-Key. Auth responses carry tokens, which must not be
+		// stored: sign ups are replayed with a fresh token instead.
+		replays, err := newIdempotencyStore()
+		if err != nil {
+			app.Stop(err)
+		}
+		replayTTL, err := time.ParseDuration(envy.Get("IDEMPOTENCY_TTL", "24h"))
+		if err != nil {
+			app.Stop(err)
+		}
+
+		// Write routes opt in to running in a transaction per request
+		inTransaction := Transaction(models.DB)
+		replaySignUps := IdempotentReplay(replays, replayTTL, idempotencySecret(cfg), replayRegister(deps.Users))
+
 		// Authentication routes (public)
 		authGroup := app.Group("/auth")
 		{
-			authGroup.POST("/register", RegisterHandler)
-			authGroup.POST("/login", LoginHandler)
+			publicAuth := authGroup.Group("")
+			publicAuth.Use(RateLimit(rateLimits, "auth", authLimit, ByIP))
+			{
+				publicAuth.POST("/register", replaySignUps(inTransaction(RegisterHandler(deps.Users))))
+				publicAuth.POST("/login", LoginHandler(deps.Users))
+			}
 			
 			// Protected auth routes (require valid JWT)
 			protectedAuth := authGroup.Group("")
-			protectedAuth.Use(AuthMiddleware)
+			protectedAuth.Use(AuthMiddleware(deps.Users))
+			protectedAuth.Use(RateLimit(rateLimits, "api", apiLimit, ByUser))
 			{
 				protectedAuth.GET("/me", MeHandler)
 				protectedAuth.POST("/refresh", RefreshTokenHandler)
@@ -84,7 +219,9 @@ func App() *buffalo.App {
 		{
 			// Protected routes (require authentication)
 			protected := apiV1.Group("")
-			protected.Use(AuthMiddleware)
+			protected.Use(AuthMiddleware(deps.Users))
+			protected.Use(RateLimit(rateLimits, "api", apiLimit, ByUser))
+			protected.Use(Idempotency(replays, replayTTL, idempotencySecret(cfg)))
 			{
 				// User routes - any authenticated user
 				protected.GET("/profile", MeHandler) // Alias for /auth/me
@@ -93,6 +230,15 @@ func App() *buffalo.App {
 				adminOnly := protected.Group("/admin")
 				adminOnly.Use(AdminMiddleware)
 				{
+					adminOnly.GET("/errors", ErrorEventsHandler(errorEvents))
+					adminOnly.GET("/errors/{fingerprint}", ErrorEventHandler(errorEvents))
+					adminOnly.GET("/flags", FlagsHandler(featureFlags))
+					adminOnly.POST("/flags", CreateFlagHandler(featureFlags))
+					adminOnly.GET("/flags/{key}", FlagHandler(featureFlags))
+					adminOnly.PUT("/flags/{key}", UpdateFlagHandler(featureFlags))
+					adminOnly.DELETE("/flags/{key}", DeleteFlagHandler(featureFlags))
+					adminOnly.GET("/maintenance", MaintenanceHandler(maintenanceSwitch))
+					adminOnly.PUT("/maintenance", UpdateMaintenanceHandler(maintenanceSwitch))
 					// Admin endpoints will be added here
 					// adminOnly.GET("/users", AdminUsersListHandler)
 					// adminOnly.GET("/stats", AdminStatsHandler)
@@ -104,6 +250,17 @@ func App() *buffalo.App {
 	return app
 }
 
+// Handler returns App() wrapped in the net/http middleware that must see
+// complete responses, problem documents included, which buffalo renders
+// after its own middleware returned: conditional requests and compression
+func Handler() (http.Handler, error) {
+	compression, err := compressOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return Compress(compression)(Conditional(cachePolicies)(App())), nil
+}
+
 // translations will load locale files, set up the translator `actions.T`,
 // and will return a middleware to use to load the correct locale for each
 // request.
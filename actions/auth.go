@@ -1,20 +1,21 @@
 package actions
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
 	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
 	"github.com/gobuffalo/buffalo"
-	"github.com/gobuffalo/envy"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gofrs/uuid"
 )
 
-// JWT configuration
-var jwtSecretKey = []byte(envy.Get("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"))
-
 // JWT Claims structure
 type JWTClaims struct {
 	UserID string `json:"user_id"`
@@ -29,6 +30,7 @@ type RegisterRequest struct {
 	Email           string `json:"email" validate:"required,email"`
 	Password        string `json:"password" validate:"required,min=8,max=100"`
 	PasswordConfirm string `json:"password_confirm" validate:"required"`
+	Locale          string `json:"locale,omitempty" validate:"omitempty,locale"`
 }
 
 type LoginRequest struct {
@@ -38,18 +40,22 @@ type LoginRequest struct {
 
 type AuthResponse struct {
 	Token     string      `json:"token"`
-	User      interface{} `json:"user"`
+	User      interface{} `json:"user" openapi:"ref=User"`
 	ExpiresAt time.Time   `json:"expires_at"`
 }
 
-type ErrorResponse struct {
-	Error   string            `json:"error"`
-	Details map[string]string `json:"details,omitempty"`
-}
-
 // GenerateJWT creates a new JWT token for a user
 func GenerateJWT(user *models.User) (string, time.Time, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+	return GenerateJWTContext(context.Background(), user)
+}
+
+// GenerateJWTContext is GenerateJWT with token signing traced as a child
+// span of the span in ctx
+func GenerateJWTContext(ctx context.Context, user *models.User) (tokenString string, expiresAt time.Time, err error) {
+	_, span := telemetry.StartSpan(ctx, "jwt.sign")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	expirationTime := time.Now().Add(config.Get().Auth.TokenTTL)
 	
 	now := time.Now()
 	claims := &JWTClaims{
@@ -65,8 +71,10 @@ func GenerateJWT(user *models.User) (string, time.Time, error) {
 		},
 	}
 
+	key := jwtKeys().Current()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecretKey)
+	token.Header["kid"] = key.ID
+	tokenString, err = token.SignedString(key.Secret)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -76,10 +84,28 @@ func GenerateJWT(user *models.User) (string, time.Time, error) {
 
 // ValidateJWT validates and parses a JWT token
 func ValidateJWT(tokenString string) (*JWTClaims, error) {
+	return ValidateJWTContext(context.Background(), tokenString)
+}
+
+// ValidateJWTContext is ValidateJWT with token verification traced as a
+// child span of the span in ctx
+func ValidateJWTContext(ctx context.Context, tokenString string) (_ *JWTClaims, err error) {
+	_, span := telemetry.StartSpan(ctx, "jwt.verify")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	claims := &JWTClaims{}
 	
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecretKey, nil
+		// Tokens issued before keys had IDs were signed with the current key
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return jwtKeys().Current().Secret, nil
+		}
+		key, ok := jwtKeys().Lookup(kid)
+		if !ok {
+			return nil, errUnknownKey
+		}
+		return key.Secret, nil
 	})
 
 	if err != nil {
@@ -95,109 +121,116 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 
 // RegisterHandler handles user registration
 // POST /auth/register
-func RegisterHandler(c buffalo.Context) error {
-	var req RegisterRequest
-	if err := c.Bind(&req); err != nil {
-		return c.Render(http.StatusBadRequest, r.JSON(ErrorResponse{
-			Error: "Invalid request format",
-		}))
-	}
+func RegisterHandler(users models.UserRepository) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		var req RegisterRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
 
-	// Validate password confirmation
-	if req.Password != req.PasswordConfirm {
-		return c.Render(http.StatusBadRequest, r.JSON(ErrorResponse{
-			Error: "Password confirmation does not match",
-		}))
-	}
+		// Validate password confirmation
+		if req.Password != req.PasswordConfirm {
+			return apperrors.New(apperrors.CodePasswordMismatch, "")
+		}
 
-	// Create new user
-	user := &models.User{
-		Name:            req.Name,
-		Email:           req.Email,
-		Password:        req.Password,
-		PasswordConfirm: req.PasswordConfirm,
-		Role:            models.RoleUser, // Default role
-	}
+		// Create new user
+		user := &models.User{
+			Name:            req.Name,
+			Email:           req.Email,
+			Password:        req.Password,
+			PasswordConfirm: req.PasswordConfirm,
+			Role:            models.RoleUser, // Default role
+			Locale:          req.Locale,
+		}
 
-	// Validate and create user
-	verrs, err := models.DB.ValidateAndCreate(user)
-	if err != nil {
-		return c.Render(http.StatusInternalServerError, r.JSON(ErrorResponse{
-			Error: "Failed to create user",
-		}))
-	}
+		// Validate and create user
+		verrs, err := users.Create(c, user)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "user_create_failed")
+		}
 
-	if verrs.HasAny() {
-		details := make(map[string]string)
-		for _, key := range verrs.Keys() {
-			details[key] = strings.Join(verrs.Get(key), ", ")
+		if verrs.HasAny() {
+			return apperrors.Validation(verrs.Errors)
 		}
-		return c.Render(http.StatusBadRequest, r.JSON(ErrorResponse{
-			Error:   "Validation failed",
-			Details: details,
-		}))
-	}
+		// Retries with the same Idempotency-Key get a fresh token for
+		// this user, not a second account
+		replayAs(c, user.ID.String())
 
-	// Generate JWT token
-	tokenString, expiresAt, err := GenerateJWT(user)
-	if err != nil {
-		return c.Render(http.StatusInternalServerError, r.JSON(ErrorResponse{
-			Error: "Failed to generate token",
-		}))
-	}
+		// Generate JWT token
+		tokenString, expiresAt, err := GenerateJWTContext(c, user)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "token_generate_failed")
+		}
 
-	// Return response
-	response := AuthResponse{
-		Token:     tokenString,
-		User:      user,
-		ExpiresAt: expiresAt,
+		// Return response
+		response := AuthResponse{
+			Token:     tokenString,
+			User:      user,
+			ExpiresAt: expiresAt,
+		}
+
+		return renderAuth(c, http.StatusCreated, response)
 	}
+}
 
-	return c.Render(http.StatusCreated, r.JSON(response))
+// replayRegister answers a retried registration with a fresh token for
+// the user its first request created
+func replayRegister(users models.UserRepository) ReplayFunc {
+	return func(c buffalo.Context, status int, ref string) error {
+		userID, err := uuid.FromString(ref)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
+		user, err := users.FindByID(c, userID)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
+		tokenString, expiresAt, err := GenerateJWTContext(c, user)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "token_generate_failed")
+		}
+		return renderAuth(c, status, AuthResponse{Token: tokenString, User: user, ExpiresAt: expiresAt})
+	}
 }
 
 // LoginHandler handles user login
 // POST /auth/login
-func LoginHandler(c buffalo.Context) error {
-	var req LoginRequest
-	if err := c.Bind(&req); err != nil {
-		return c.Render(http.StatusBadRequest, r.JSON(ErrorResponse{
-			Error: "Invalid request format",
-		}))
-	}
+func LoginHandler(users models.UserRepository) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		var req LoginRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
 
-	// Find user by email
-	user := &models.User{}
-	err := models.DB.Where("email = ?", strings.ToLower(req.Email)).First(user)
-	if err != nil {
-		return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-			Error: "Invalid credentials",
-		}))
-	}
+		// Find user by email
+		user, err := users.FindByEmail(c, req.Email)
+		if errors.Is(err, models.ErrUserNotFound) {
+			return apperrors.New(apperrors.CodeInvalidCredentials, "")
+		}
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
 
-	// Validate password
-	if !user.ValidatePassword(req.Password) {
-		return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-			Error: "Invalid credentials",
-		}))
-	}
+		// Validate password
+		if !user.ValidatePasswordContext(c, req.Password) {
+			return apperrors.New(apperrors.CodeInvalidCredentials, "")
+		}
 
-	// Generate JWT token
-	tokenString, expiresAt, err := GenerateJWT(user)
-	if err != nil {
-		return c.Render(http.StatusInternalServerError, r.JSON(ErrorResponse{
-			Error: "Failed to generate token",
-		}))
-	}
+		// Generate JWT token
+		tokenString, expiresAt, err := GenerateJWTContext(c, user)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "token_generate_failed")
+		}
 
-	// Return response
-	response := AuthResponse{
-		Token:     tokenString,
-		User:      user,
-		ExpiresAt: expiresAt,
-	}
+		// Return response
+		response := AuthResponse{
+			Token:     tokenString,
+			User:      user,
+			ExpiresAt: expiresAt,
+		}
 
-	return c.Render(http.StatusOK, r.JSON(response))
+		return renderAuth(c, http.StatusOK, response)
+	}
 }
 
 // MeHandler returns current user information
@@ -205,62 +238,69 @@ func LoginHandler(c buffalo.Context) error {
 func MeHandler(c buffalo.Context) error {
 	user := c.Value("currentUser")
 	if user == nil {
-		return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-			Error: "Unauthorized",
-		}))
+		return apperrors.New(apperrors.CodeUnauthorized, "")
 	}
 
 	return c.Render(http.StatusOK, r.JSON(user))
 }
 
-// AuthMiddleware validates JWT tokens and sets current user
-func AuthMiddleware(next buffalo.Handler) buffalo.Handler {
-	return func(c buffalo.Context) error {
-		// Get token from Authorization header
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "Authorization header required",
-			}))
-		}
+// authenticate returns the user of the bearer token of the request
+func authenticate(c buffalo.Context, users models.UserRepository) (*models.User, error) {
+	// Get token from Authorization header
+	authHeader := c.Request().Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, apperrors.New(apperrors.CodeAuthorizationMissing, "")
+	}
 
-		// Check Bearer token format
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "Invalid authorization header format",
-			}))
-		}
+	// Check Bearer token format
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return nil, apperrors.New(apperrors.CodeAuthorizationInvalid, "")
+	}
 
-		// Validate JWT token
-		claims, err := ValidateJWT(tokenParts[1])
-		if err != nil {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "Invalid token",
-			}))
-		}
+	// Validate JWT token
+	claims, err := ValidateJWTContext(c, tokenParts[1])
+	if err != nil {
+		return nil, apperrors.Wrap(err, apperrors.CodeInvalidToken, "")
+	}
 
-		// Get user from database
-		userID, err := uuid.FromString(claims.UserID)
-		if err != nil {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "Invalid user ID in token",
-			}))
-		}
+	// Get user from database
+	userID, err := uuid.FromString(claims.UserID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, apperrors.CodeInvalidToken, "token_user_id_invalid")
+	}
 
-		user := &models.User{}
-		err = models.DB.Find(user, userID)
-		if err != nil {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "User not found",
-			}))
-		}
+	user, err := users.FindByID(c, userID)
+	if errors.Is(err, models.ErrUserNotFound) {
+		return nil, apperrors.Wrap(err, apperrors.CodeUnauthorized, "user_not_found")
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, apperrors.CodeInternal, "")
+	}
 
-		// Set current user in context
-		c.Set("currentUser", user)
-		c.Set("currentUserID", userID)
+	return user, nil
+}
 
-		return next(c)
+// AuthMiddleware validates JWT tokens and sets current user
+func AuthMiddleware(users models.UserRepository) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			user, err := authenticate(c, users)
+			if err != nil {
+				return err
+			}
+
+			// Set current user in context
+			c.Set("currentUser", user)
+			c.Set("currentUserID", user.ID)
+
+			// A stored language preference wins over Accept-Language
+			if user.Locale != "" && T != nil {
+				T.Refresh(c, user.Locale)
+			}
+
+			return next(c)
+		}
 	}
 }
 
@@ -269,16 +309,12 @@ func AdminMiddleware(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
 		user := c.Value("currentUser")
 		if user == nil {
-			return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-				Error: "Unauthorized",
-			}))
+			return apperrors.New(apperrors.CodeUnauthorized, "")
 		}
 
 		currentUser, ok := user.(*models.User)
 		if !ok || !currentUser.IsAdmin() {
-			return c.Render(http.StatusForbidden, r.JSON(ErrorResponse{
-				Error: "Admin access required",
-			}))
+			return apperrors.New(apperrors.CodeForbidden, "admin_access_required")
 		}
 
 		return next(c)
@@ -290,24 +326,18 @@ func AdminMiddleware(next buffalo.Handler) buffalo.Handler {
 func RefreshTokenHandler(c buffalo.Context) error {
 	user := c.Value("currentUser")
 	if user == nil {
-		return c.Render(http.StatusUnauthorized, r.JSON(ErrorResponse{
-			Error: "Unauthorized",
-		}))
+		return apperrors.New(apperrors.CodeUnauthorized, "")
 	}
 
 	currentUser, ok := user.(*models.User)
 	if !ok {
-		return c.Render(http.StatusInternalServerError, r.JSON(ErrorResponse{
-			Error: "Invalid user data",
-		}))
+		return apperrors.New(apperrors.CodeInternal, "user_data_invalid")
 	}
 
 	// Generate new JWT token
-	tokenString, expiresAt, err := GenerateJWT(currentUser)
+	tokenString, expiresAt, err := GenerateJWTContext(c, currentUser)
 	if err != nil {
-		return c.Render(http.StatusInternalServerError, r.JSON(ErrorResponse{
-			Error: "Failed to generate token",
-		}))
+		return apperrors.Wrap(err, apperrors.CodeInternal, "token_generate_failed")
 	}
 
 	// Return response
@@ -317,5 +347,12 @@ func RefreshTokenHandler(c buffalo.Context) error {
 		ExpiresAt: expiresAt,
 	}
 
-	return c.Render(http.StatusOK, r.JSON(response))
-} 
\ No newline at end of file
+	return renderAuth(c, http.StatusOK, response)
+} 
+
+// renderAuth sends a response carrying a token, which must not be stored
+// by caches or the Idempotency middleware
+func renderAuth(c buffalo.Context, status int, response AuthResponse) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Render(status, r.JSON(response))
+}
@@ -0,0 +1,28 @@
+package actions
+
+import (
+	"reflect"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/binding"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/flags"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+)
+
+func init() {
+	// validate:"locale" accepts the language tags stored in users.locale
+	binding.RegisterRule("locale", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && models.IsValidLocale(v.String())
+	})
+	// validate:"flag_key" accepts feature flag keys
+	binding.RegisterRule("flag_key", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && flags.KeyPattern.MatchString(v.String())
+	})
+}
+
+// bind strictly decodes the JSON body of the request into v and enforces
+// its `validate:` tags. Handlers return the error as is: it is already a
+// problem with field-level messages.
+func bind(c buffalo.Context, v interface{}) error {
+	return binding.JSON(c.Request(), v)
+}
@@ -0,0 +1,91 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+)
+
+func (as *ActionSuite) Test_LoginHandler_Rejects_Empty_Email() {
+	res := as.JSON("/auth/login").Post(LoginRequest{Password: "password123"})
+	as.Equal(http.StatusBadRequest, res.Code)
+
+	var response apperrors.Problem
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &response))
+	as.Equal(apperrors.CodeValidationFailed, response.Code)
+	as.NotEmpty(response.Errors["email"])
+}
+
+func (as *ActionSuite) Test_RegisterHandler_Rejects_Unknown_Fields() {
+	res := as.JSON("/auth/register").Post(map[string]string{
+		"name":             "John Doe",
+		"email":            "john@example.com",
+		"password":         "password123",
+		"password_confirm": "password123",
+		"role":             "admin",
+	})
+	as.Equal(http.StatusBadRequest, res.Code)
+
+	var response apperrors.Problem
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &response))
+	as.Equal([]string{"Unknown field"}, response.Errors["role"])
+
+	count, err := as.DB.Count("users")
+	as.NoError(err)
+	as.Equal(0, count)
+}
+
+// bindApp serves RegisterRequest binding without touching the database
+func bindApp() *buffalo.App {
+	a := newTestApp()
+	a.POST("/bind", func(c buffalo.Context) error {
+		var req RegisterRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, r.JSON(req))
+	})
+	return a
+}
+
+func TestBind_Field_Errors(t *testing.T) {
+	res := serve(bindApp(), http.MethodPost, "/bind", `{"name":"J","email":"bad","password":"short","password_confirm":"short","locale":"??"}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	problem := problemOf(t, res)
+	assert.Equal(t, apperrors.CodeValidationFailed, problem.Code)
+	assert.Equal(t, map[string][]string{
+		"name":     {"Must be at least 2 characters long"},
+		"email":    {"Must be a valid email address"},
+		"password": {"Must be at least 8 characters long"},
+		"locale":   {"Must be a language tag such as 'en-US'"},
+	}, problem.Errors)
+}
+
+func TestBind_Field_Errors_Localized(t *testing.T) {
+	res := serve(bindApp(), http.MethodPost, "/bind", `{"name":"J","email":"a@example.com","password":"password123","password_confirm":"password123"}`, "Accept-Language", "es")
+	problem := problemOf(t, res)
+	assert.Equal(t, []string{"Debe tener al menos 2 caracteres"}, problem.Errors["name"])
+}
+
+func TestBind_Type_Errors(t *testing.T) {
+	problem := problemOf(t, serve(bindApp(), http.MethodPost, "/bind", `{"name":["J"]}`))
+	assert.Equal(t, []string{"Must be a JSON string"}, problem.Errors["name"])
+}
+
+func TestBind_Too_Large(t *testing.T) {
+	res := serve(bindApp(), http.MethodPost, "/bind", `{"name":"`+strings.Repeat("a", 2<<20)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	problem := problemOf(t, res)
+	assert.Equal(t, apperrors.CodePayloadTooLarge, problem.Code)
+	assert.Equal(t, "Request body must not exceed 1048576 bytes", problem.Detail)
+}
+
+func TestBind_Valid(t *testing.T) {
+	res := serve(bindApp(), http.MethodPost, "/bind", `{"name":"Jo","email":"jo@example.com","password":"password123","password_confirm":"password123","locale":"es-ES"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,217 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicy sets the Cache-Control of successful responses to GET
+// requests for Path, or below it when Path ends with "/"
+type CachePolicy struct {
+	Path  string
+	Value string
+	// Static documents change only on deploy: they are last modified when
+	// the process started
+	Static bool
+}
+
+// cachePolicies are the Cache-Control values of routes that do not set
+// their own. Probes must never be served from a cache; documents that
+// change only on deploy may be.
+var cachePolicies = []CachePolicy{
+	{Path: "/health", Value: "no-store"},
+	{Path: "/health/", Value: "no-store"},
+	{Path: "/.well-known/", Value: "public, max-age=3600", Static: true},
+	{Path: "/openapi.json", Value: "public, max-age=300", Static: true},
+	{Path: "/docs", Value: "public, max-age=300", Static: true},
+}
+
+// processStarted is the Last-Modified time of static documents
+var processStarted = time.Now().UTC().Truncate(time.Second)
+
+// privateCacheControl is used for authenticated responses no policy
+// covers: only the client may keep them, and must revalidate them
+const privateCacheControl = "private, no-cache"
+
+// maxETagBody bounds the responses buffered to compute an ETag; larger
+// ones are sent without
+const maxETagBody = 1 << 20
+
+// policyFor returns the policy for a GET of the path of r, or one
+// setting privateCacheControl or nothing when none covers it
+func policyFor(policies []CachePolicy, r *http.Request) CachePolicy {
+	path := routePath(r.URL.Path)
+	for _, p := range policies {
+		if path == routePath(p.Path) && !strings.HasSuffix(p.Path, "/") ||
+			strings.HasSuffix(p.Path, "/") && strings.HasPrefix(path, p.Path) {
+			return p
+		}
+	}
+	if r.Header.Get("Authorization") != "" {
+		return CachePolicy{Value: privateCacheControl}
+	}
+	return CachePolicy{}
+}
+
+// Conditional returns a net/http middleware for GET and HEAD requests. It
+// gives successful JSON responses a strong ETag computed from their body,
+// answers If-None-Match and If-Modified-Since with 304 Not Modified, and
+// sets Cache-Control from policies on responses that have none, and
+// Last-Modified on static documents.
+func Conditional(policies []CachePolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &conditionalWriter{ResponseWriter: w, req: r, policy: policyFor(policies, r)}
+			next.ServeHTTP(cw, r)
+			cw.finish()
+		})
+	}
+}
+
+// conditionalWriter holds back successful JSON responses until they are
+// complete, to tag them and compare the tag with the request
+type conditionalWriter struct {
+	http.ResponseWriter
+	req    *http.Request
+	policy CachePolicy
+
+	status    int
+	buffering bool
+	passed    bool
+	// discard drops the body of a 304 answered before it was written
+	discard bool
+	buf     []byte
+}
+
+func (w *conditionalWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+
+	h := w.Header()
+	if w.policy.Value != "" && status < http.StatusBadRequest && h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", w.policy.Value)
+	}
+	if w.policy.Static && status == http.StatusOK && h.Get("Last-Modified") == "" {
+		h.Set("Last-Modified", processStarted.Format(http.TimeFormat))
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if status == http.StatusOK && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		w.buffering = true
+		return
+	}
+	// Other responses are not tagged, but may still be older than the
+	// copy of the client
+	if status == http.StatusOK && notModified(w.req, h) {
+		w.notModified()
+		w.discard = true
+	}
+	w.pass()
+}
+
+// pass sends the header and the buffered body and lets the rest of the
+// response through
+func (w *conditionalWriter) pass() {
+	w.buffering, w.passed = false, true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *conditionalWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(b)
+	}
+	if len(w.buf)+len(b) > maxETagBody {
+		w.pass()
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// Flush gives up on the ETag: the handler streams
+func (w *conditionalWriter) Flush() {
+	if w.buffering {
+		w.pass()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// finish tags a buffered response and sends it, or a 304 when the client
+// has it already
+func (w *conditionalWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	h := w.Header()
+	if h.Get("ETag") == "" {
+		sum := sha256.Sum256(w.buf)
+		h.Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+	}
+	if notModified(w.req, h) {
+		w.notModified()
+	}
+	w.pass()
+}
+
+// notModified turns the response into a 304 without a body
+func (w *conditionalWriter) notModified() {
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Language"} {
+		w.Header().Del(name)
+	}
+	w.buf = nil
+	w.status = http.StatusNotModified
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *conditionalWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when it is
+// absent, against the response headers h
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ims)
+}
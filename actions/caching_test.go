@@ -0,0 +1,146 @@
+package actions
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionalHandler serves a JSON document last modified at modified
+func conditionalHandler(modified time.Time) http.Handler {
+	return Conditional(cachePolicies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		_, _ = io.WriteString(w, `{"version":1}`)
+	}))
+}
+
+func TestConditional_ETag(t *testing.T) {
+	h := conditionalHandler(time.Now())
+
+	res := serve(h, http.MethodGet, "/doc", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	etag := res.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, etag, serve(h, http.MethodGet, "/doc", nil).Header().Get("ETag"), "tags are stable")
+
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		res = serve(h, http.MethodGet, "/doc", nil, "If-None-Match", inm)
+		assert.Equal(t, http.StatusNotModified, res.Code, inm)
+		assert.Empty(t, res.Body.String())
+		assert.Equal(t, etag, res.Header().Get("ETag"))
+		assert.Empty(t, res.Header().Get("Content-Type"))
+	}
+
+	res = serve(h, http.MethodGet, "/doc", nil, "If-None-Match", `"stale"`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `{"version":1}`, res.Body.String())
+}
+
+func TestConditional_If_Modified_Since(t *testing.T) {
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := conditionalHandler(modified)
+
+	assert.Equal(t, http.StatusNotModified, serve(h, http.MethodGet, "/doc", nil, "If-Modified-Since", modified.Format(http.TimeFormat)).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/doc", nil, "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat)).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/doc", nil,
+		"If-Modified-Since", modified.Format(http.TimeFormat),
+		"If-None-Match", `"stale"`,
+	).Code, "If-None-Match takes precedence")
+}
+
+func TestConditional_Static_Documents(t *testing.T) {
+	h := Conditional(cachePolicies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs" {
+			w.Header().Set("Content-Type", "text/html")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = io.WriteString(w, "{}")
+	}))
+	since := processStarted.Format(http.TimeFormat)
+
+	for _, path := range []string{"/openapi.json", "/docs", "/.well-known/jwks.json"} {
+		res := serve(h, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, res.Code, path)
+		assert.Equal(t, processStarted.Format(http.TimeFormat), res.Header().Get("Last-Modified"), path)
+
+		res = serve(h, http.MethodGet, path, nil, "If-Modified-Since", since)
+		assert.Equal(t, http.StatusNotModified, res.Code, path)
+		assert.Empty(t, res.Body.String(), path)
+		assert.Empty(t, res.Header().Get("Content-Type"), path)
+	}
+	assert.Empty(t, serve(h, http.MethodGet, "/api/v1/profile", nil).Header().Get("Last-Modified"), "only static documents")
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/api/v1/profile", nil, "If-Modified-Since", since).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/docs", nil, "If-Modified-Since", processStarted.Add(-time.Hour).Format(http.TimeFormat)).Code)
+}
+
+func TestConditional_Only_Tags_Successful_JSON(t *testing.T) {
+	h := Conditional(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+		}
+		_, _ = io.WriteString(w, "{}")
+	}))
+	assert.Empty(t, serve(h, http.MethodGet, "/missing", nil).Header().Get("ETag"))
+	assert.Empty(t, serve(h, http.MethodGet, "/page", nil).Header().Get("ETag"))
+
+	assert.Empty(t, serve(h, http.MethodPost, "/missing", nil).Header().Get("ETag"))
+}
+
+func TestConditional_Cache_Control(t *testing.T) {
+	h := Conditional(cachePolicies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/custom":
+			w.Header().Set("Cache-Control", "max-age=5")
+		case "/.well-known/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, "{}")
+	}))
+
+	for path, want := range map[string]string{
+		"/health":                "no-store",
+		"/health/ready/":         "no-store",
+		"/.well-known/jwks.json": "public, max-age=3600",
+		"/openapi.json":          "public, max-age=300",
+		"/custom":                "max-age=5",
+		"/healthz":               "",
+		"/.well-known/missing":   "",
+		"/api/v1/profile":        "",
+	} {
+		assert.Equal(t, want, serve(h, http.MethodGet, path, nil).Header().Get("Cache-Control"), path)
+	}
+
+	res := serve(h, http.MethodGet, "/api/v1/profile", nil, "Authorization", "Bearer token")
+	assert.Equal(t, privateCacheControl, res.Header().Get("Cache-Control"))
+}
+
+func TestHandler_Compresses_And_Revalidates(t *testing.T) {
+	h, err := Handler()
+	require.NoError(t, err)
+
+	res := serve(h, http.MethodGet, "/openapi.json", nil, "Accept-Encoding", "gzip")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "public, max-age=300", res.Header().Get("Cache-Control"))
+	etag := res.Header().Get("ETag")
+	assert.Regexp(t, `^W/"`, etag)
+	assert.Contains(t, decompress(t, "gzip", res.Body.Bytes()), `"openapi"`)
+
+	res = serve(h, http.MethodGet, "/openapi.json", nil, "Accept-Encoding", "gzip", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.Bytes())
+
+	res = serve(h, http.MethodGet, "/health/live", nil)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"context"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lock"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+)
+
+// expirer deletes expired rows, such as rate limit windows
+type expirer interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// cleanupJob returns a background job deleting the expired rows of store
+// every minute
+func cleanupJob(job string, store expirer, locker lock.Locker) lifecycle.Hook {
+	return lifecycle.Hook{Name: job + ".cleanup", Run: func(ctx context.Context) error {
+		cleanupExpired(ctx, job, store, locker, time.Minute)
+		return nil
+	}}
+}
+
+// cleanupExpired deletes the expired rows of store every interval until
+// ctx is done. Every replica schedules it; the lock named after the job
+// lets only one run it at a time.
+func cleanupExpired(ctx context.Context, job string, store expirer, locker lock.Locker, every time.Duration) {
+	log := logging.For(job)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := lock.Singleton(ctx, locker, job+".cleanup", func(ctx context.Context) error {
+			deleted, err := store.DeleteExpired(ctx)
+			if deleted > 0 {
+				log.Debug("deleted expired rows", "count", deleted)
+			}
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Warn("cleanup failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lock"
+)
+
+type countingExpirer struct{ calls chan struct{} }
+
+func (e countingExpirer) DeleteExpired(context.Context) (int64, error) {
+	e.calls <- struct{}{}
+	return 1, nil
+}
+
+func TestCleanupExpired_Runs_Until_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := countingExpirer{calls: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		cleanupExpired(ctx, "test", e, lock.NewMemory(), time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-e.calls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("cleanup did not run")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleanup did not stop")
+	}
+}
@@ -0,0 +1,275 @@
+package actions
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gobuffalo/envy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a compressor that can be reused for another response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pools the compressors of the supported content codings
+var encoders = map[string]*sync.Pool{
+	"zstd": {New: func() interface{} {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return enc
+	}},
+	"br": {New: func() interface{} { return brotli.NewWriterLevel(nil, 4) }},
+	"gzip": {New: func() interface{} {
+		enc, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return enc
+	}},
+}
+
+// CompressOptions configures Compress
+type CompressOptions struct {
+	// Encodings are the content codings offered, most preferred first
+	Encodings []string
+	// MinSize is the smallest body compressed, in bytes; smaller bodies
+	// gain nothing
+	MinSize int
+	// ContentTypes lists the media types compressed
+	ContentTypes []string
+}
+
+// defaultCompressedTypes are text formats served by the API; images and
+// archives are compressed already
+var defaultCompressedTypes = []string{
+	"application/json", "application/problem+json", "application/javascript",
+	"text/html", "text/plain", "text/css", "image/svg+xml",
+}
+
+// compressOptionsFromEnv reads COMPRESSION_ENCODINGS (default
+// "zstd,br,gzip"; "none" disables compression) and COMPRESSION_MIN_SIZE
+// (default "1KB")
+func compressOptionsFromEnv() (CompressOptions, error) {
+	opts := CompressOptions{ContentTypes: defaultCompressedTypes}
+	if list := envy.Get("COMPRESSION_ENCODINGS", "zstd,br,gzip"); list != "none" {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := encoders[name]; !ok {
+				return opts, fmt.Errorf("COMPRESSION_ENCODINGS: unsupported encoding %q", name)
+			}
+			opts.Encodings = append(opts.Encodings, name)
+		}
+	}
+	size, err := parseSize(envy.Get("COMPRESSION_MIN_SIZE", "1KB"))
+	if err != nil {
+		return opts, fmt.Errorf("COMPRESSION_MIN_SIZE: %w", err)
+	}
+	opts.MinSize = int(size)
+	return opts, nil
+}
+
+// Compress returns a net/http middleware that compresses responses with
+// the coding the client prefers among opts.Encodings, ties going to the
+// server's order. Only bodies of at least MinSize bytes with one of the
+// listed content types are compressed; strong ETags become weak, as the
+// bytes sent differ from the representation they were computed on.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	types := map[string]bool{}
+	for _, t := range opts.ContentTypes {
+		types[t] = true
+	}
+	return func(next http.Handler) http.Handler {
+		if len(opts.Encodings) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings),
+				minSize:        opts.MinSize,
+				types:          types,
+			}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the coding of offered the Accept-Encoding header
+// prefers, or "" for none. Codings with the same weight are ranked by
+// their order in offered.
+func negotiateEncoding(header string, offered []string) string {
+	if header == "" {
+		return ""
+	}
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range offered {
+		q, ok := weights[name]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// to compress it: once minSize bytes arrived, or the response ends or is
+// flushed
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	types    map[string]bool
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// compressible reports whether the response may be compressed, whatever
+// the client accepts
+func (w *compressWriter) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return w.types[mediaType]
+}
+
+// decide sends the header, compressing the body when it is worth it, and
+// writes the buffered start of the body
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	if w.compressible() {
+		h.Add("Vary", "Accept-Encoding")
+		if w.encoding != "" && len(w.buf) >= w.minSize {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+			w.enc = encoders[w.encoding].Get().(encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what was written so far; a body flushed before reaching
+// minSize is compressed all the same, as more is likely to follow
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.minSize = 0
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close ends the response, sending what is still buffered
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 {
+			// Nothing was written: leave the response to net/http
+			return nil
+		}
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+	err := w.enc.Close()
+	w.enc.Reset(nil)
+	encoders[w.encoding].Put(w.enc)
+	w.enc = nil
+	return err
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
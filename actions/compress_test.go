@@ -0,0 +1,175 @@
+package actions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gobuffalo/envy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCompression = CompressOptions{
+	Encodings:    []string{"zstd", "br", "gzip"},
+	MinSize:      64,
+	ContentTypes: defaultCompressedTypes,
+}
+
+// serveCompressed writes body with contentType through Compress
+func serveCompressed(t *testing.T, opts CompressOptions, acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := Compress(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		// Write in pieces, as renderers do
+		for _, part := range strings.SplitAfter(body, ",") {
+			_, _ = io.WriteString(w, part)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		r = gz
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		dec, err := zstd.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer dec.Close()
+		r = dec
+	default:
+		return string(body)
+	}
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCompress_Encodings(t *testing.T) {
+	body := `{"items":[` + strings.Repeat(`{"name":"widget","price":10},`, 50) + `{}]}`
+	for _, enc := range []string{"gzip", "br", "zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			res := serveCompressed(t, testCompression, enc, "application/json; charset=utf-8", body)
+			assert.Equal(t, enc, res.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+			assert.Equal(t, `W/"v1"`, res.Header().Get("ETag"), "compressed bytes only match weakly")
+			assert.Less(t, res.Body.Len(), len(body))
+			assert.Equal(t, body, decompress(t, enc, res.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompress_Skips(t *testing.T) {
+	large := strings.Repeat("x", 200)
+	tests := []struct {
+		name, accept, contentType, body string
+	}{
+		{"small body", "gzip", "application/json", `{"ok":true}`},
+		{"no Accept-Encoding", "", "application/json", large},
+		{"unsupported coding", "compress", "application/json", large},
+		{"refused coding", "gzip;q=0", "application/json", large},
+		{"binary content", "gzip", "image/png", large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serveCompressed(t, testCompression, tt.accept, tt.contentType, tt.body)
+			assert.Empty(t, res.Header().Get("Content-Encoding"))
+			assert.Equal(t, `"v1"`, res.Header().Get("ETag"))
+			assert.Equal(t, tt.body, res.Body.String())
+		})
+	}
+}
+
+func TestCompress_Flush_Compresses_Small_Bodies(t *testing.T) {
+	h := Compress(testCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "tick\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "tock\n")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	assert.True(t, res.Flushed)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "tick\ntock\n", decompress(t, "gzip", res.Body.Bytes()))
+}
+
+func TestCompress_Problem_Documents(t *testing.T) {
+	opts := testCompression
+	opts.MinSize = 1
+	h := Compress(opts)(failingApp())
+
+	res := serve(h, http.MethodGet, "/forbidden", nil, "Accept-Encoding", "br")
+	require.Equal(t, http.StatusForbidden, res.Code)
+	assert.Equal(t, "br", res.Header().Get("Content-Encoding"))
+	assert.Contains(t, decompress(t, "br", res.Body.Bytes()), `"code":"forbidden"`)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"zstd", "br", "gzip"}
+	for header, want := range map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"gzip, deflate, br":         "br",
+		"gzip, deflate, br, zstd":   "zstd",
+		"br;q=0.5, gzip":            "gzip",
+		"ZSTD;q=0.1, GZIP;q=0.2":    "gzip",
+		"*":                         "zstd",
+		"*;q=0.5, zstd;q=0, br;q=0": "gzip",
+		"identity":                  "",
+	} {
+		assert.Equal(t, want, negotiateEncoding(header, offered), header)
+	}
+}
+
+func TestCompressOptionsFromEnv(t *testing.T) {
+	var (
+		opts CompressOptions
+		err  error
+	)
+	envy.Temp(func() {
+		envy.Set("COMPRESSION_ENCODINGS", "gzip, br")
+		envy.Set("COMPRESSION_MIN_SIZE", "2KB")
+		opts, err = compressOptionsFromEnv()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gzip", "br"}, opts.Encodings)
+	assert.Equal(t, 2048, opts.MinSize)
+
+	envy.Temp(func() {
+		envy.Set("COMPRESSION_ENCODINGS", "none")
+		opts, err = compressOptionsFromEnv()
+	})
+	require.NoError(t, err)
+	assert.Empty(t, opts.Encodings)
+
+	envy.Temp(func() {
+		envy.Set("COMPRESSION_ENCODINGS", "deflate")
+		_, err = compressOptionsFromEnv()
+	})
+	assert.ErrorContains(t, err, "COMPRESSION_ENCODINGS")
+}
@@ -0,0 +1,17 @@
+package actions
+
+import "github.com/akingundogdu/production-ready-go-backend-architecture/models"
+
+// Container holds the dependencies App builds handlers with, so handlers
+// do not reach for package globals and tests can build them on fakes
+type Container struct {
+	Users models.UserRepository
+}
+
+// newContainer returns the dependencies of App, stored in models.DB:
+// reads go to the replica of the request and writes to its transaction
+func newContainer() *Container {
+	return &Container{
+		Users: models.NewPostgresUserRepository(models.DB).ReadFrom(readDB).WriteTo(writeDB),
+	}
+}
@@ -0,0 +1,156 @@
+package actions
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/binding"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/openapi"
+	"github.com/gobuffalo/buffalo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contractValidation returns a middleware that enforces the API contract.
+// The contract is generated from the route table, so it is only built on
+// the first request, once every route is registered. Responses are only
+// checked outside production.
+func contractValidation() buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			doc, err := Contract()
+			if err != nil {
+				return err
+			}
+			return ContractMiddleware(doc, ENV != "production")(next)(c)
+		}
+	}
+}
+
+// maxCapturedResponse bounds how much of a response body is buffered for
+// contract checks; larger bodies are only checked for their status
+const maxCapturedResponse = 1 << 20
+
+// ContractMiddleware rejects requests whose parameters or body do not match
+// their operation in doc, before handlers run. With checkResponses set it
+// also compares every response with the documented ones and logs any drift,
+// such as a handler returning fields the contract does not declare. Routes
+// missing from doc pass through unchecked.
+func ContractMiddleware(doc *openapi.Document, checkResponses bool) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			req := c.Request()
+			route, params, ok := doc.Find(req.Method, req.URL.Path)
+			if !ok {
+				return next(c)
+			}
+
+			body, err := peekBody(req, binding.Limit(req))
+			if err != nil {
+				return bodyError(err)
+			}
+			if fields := route.ValidateRequest(req, params, body); len(fields) > 0 {
+				return apperrors.Validation(fields)
+			}
+
+			if !checkResponses {
+				return next(c)
+			}
+
+			res, ok := c.Response().(*buffalo.Response)
+			if !ok {
+				return next(c)
+			}
+			capture := &captureWriter{ResponseWriter: res.ResponseWriter}
+			res.ResponseWriter = capture
+			err = next(c)
+			res.ResponseWriter = capture.ResponseWriter
+			if c.Request().Context().Err() != nil {
+				// Timed out or abandoned: RequestLimits answers for it
+				return err
+			}
+
+			var drift []string
+			if err != nil {
+				// Errors are rendered as problems further up the stack;
+				// only their status can drift
+				drift = route.ValidateResponse(errorStatus(err), res.Header(), nil)
+			} else {
+				status := res.Status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				drift = route.ValidateResponse(status, res.Header(), capture.body())
+			}
+			if len(drift) > 0 {
+				reportDrift(c, route, drift)
+			}
+			return err
+		}
+	}
+}
+
+// reportDrift logs a response that does not match the contract and marks
+// the request span, so drift shows up in both logs and traces
+func reportDrift(c buffalo.Context, route *openapi.Route, drift []string) {
+	Log(c).Warn("response does not match the OpenAPI contract",
+		"operation", route.Operation.OperationID,
+		"drift", drift,
+	)
+	trace.SpanFromContext(c).AddEvent("openapi.drift", trace.WithAttributes(
+		attribute.String("openapi.operation", route.Operation.OperationID),
+		attribute.StringSlice("openapi.drift", drift),
+	))
+}
+
+// peekBody reads up to limit bytes of the request body and restores it for
+// the handler. Bodies over the limit are left to the binding layer, which
+// rejects them, and are not returned.
+func peekBody(req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+	if int64(len(buf)) > limit {
+		return nil, nil
+	}
+	return buf, nil
+}
+
+// captureWriter copies the first maxCapturedResponse bytes of a response
+type captureWriter struct {
+	http.ResponseWriter
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if room := maxCapturedResponse - w.buf.Len(); room > 0 {
+		if len(b) > room {
+			w.buf.Write(b[:room])
+			w.truncated = true
+		} else {
+			w.buf.Write(b)
+		}
+	} else if len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// body returns the captured body, or nil when it was too large to check
+func (w *captureWriter) body() []byte {
+	if w.truncated {
+		return nil
+	}
+	return w.buf.Bytes()
+}
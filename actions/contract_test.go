@@ -0,0 +1,155 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contractApp serves /auth/register with handler behind the contract
+// middleware, without touching the database
+func contractApp(t *testing.T, handler buffalo.Handler) *buffalo.App {
+	t.Helper()
+	doc, err := Contract()
+	require.NoError(t, err)
+
+	a := newTestApp(ContractMiddleware(doc, true))
+	a.POST("/auth/register", handler)
+	return a
+}
+
+// captureLogs sends the application logs to a buffer for one test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	logging.Setup(logging.Config{Format: logging.FormatJSON, Level: slog.LevelInfo, Output: buf})
+	t.Cleanup(func() { logging.Setup(logging.Config{Format: logging.FormatJSON, Level: slog.LevelInfo}) })
+	return buf
+}
+
+func testUser() *models.User {
+	now := time.Now().UTC()
+	return &models.User{
+		ID:        uuid.Must(uuid.NewV4()),
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Role:      models.RoleUser,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestContractMiddleware_Rejects_Invalid_Requests(t *testing.T) {
+	called := false
+	a := contractApp(t, func(c buffalo.Context) error {
+		called = true
+		return nil
+	})
+
+	res := serve(a, http.MethodPost, "/auth/register", `{"name":"J","email":"nope","password":"password123","is_admin":true}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.False(t, called, "handler must not run")
+
+	problem := problemOf(t, res)
+	assert.Equal(t, apperrors.CodeValidationFailed, problem.Code)
+	assert.Equal(t, map[string][]string{
+		"name":             {"Must be at least 2 characters long"},
+		"email":            {"Must be a valid email address"},
+		"password_confirm": {"This field is required"},
+		"is_admin":         {"Unknown field"},
+	}, problem.Errors)
+}
+
+func TestContractMiddleware_Keeps_Body_For_Handler(t *testing.T) {
+	a := contractApp(t, func(c buffalo.Context) error {
+		var req RegisterRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
+		return c.Render(http.StatusCreated, r.JSON(AuthResponse{Token: req.Name, User: testUser(), ExpiresAt: time.Now()}))
+	})
+
+	buf := captureLogs(t)
+	res := serve(a, http.MethodPost, "/auth/register", `{"name":"Jo","email":"jo@example.com","password":"password123","password_confirm":"password123"}`)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Contains(t, res.Body.String(), `"token":"Jo"`)
+	assert.NotContains(t, buf.String(), "OpenAPI contract", "models.User matches the User schema")
+}
+
+func TestContractMiddleware_Reports_Response_Drift(t *testing.T) {
+	// AuthResponse.User is an interface{}, so nothing but the contract
+	// stops a handler from leaking an arbitrary user shape
+	a := contractApp(t, func(c buffalo.Context) error {
+		return c.Render(http.StatusCreated, r.JSON(AuthResponse{
+			Token:     "token",
+			User:      map[string]interface{}{"id": "42", "name": "John", "password_hash": "$2a$10$"},
+			ExpiresAt: time.Now(),
+		}))
+	})
+
+	buf := captureLogs(t)
+	res := serve(a, http.MethodPost, "/auth/register", `{"name":"Jo","email":"jo@example.com","password":"password123","password_confirm":"password123"}`)
+	assert.Equal(t, http.StatusCreated, res.Code, "drift is reported, not enforced")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(lastLine(t, buf, "OpenAPI contract"), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "register", record["operation"])
+	assert.ElementsMatch(t, []interface{}{
+		"user.created_at: validation_required",
+		"user.email: validation_required",
+		"user.id: validation_uuid",
+		"user.password_hash: validation_unknown_field",
+		"user.role: validation_required",
+		"user.updated_at: validation_required",
+	}, record["drift"])
+}
+
+func TestContractMiddleware_Reports_Undocumented_Status(t *testing.T) {
+	a := contractApp(t, func(c buffalo.Context) error {
+		return apperrors.New(apperrors.CodeForbidden, "")
+	})
+
+	buf := captureLogs(t)
+	res := serve(a, http.MethodPost, "/auth/register", `{"name":"Jo","email":"jo@example.com","password":"password123","password_confirm":"password123"}`)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, string(lastLine(t, buf, "OpenAPI contract")), "status 403 is not documented")
+}
+
+func TestContractMiddleware_Production_Skips_Responses(t *testing.T) {
+	doc, err := Contract()
+	require.NoError(t, err)
+	a := newTestApp(ContractMiddleware(doc, false))
+	a.POST("/auth/register", func(c buffalo.Context) error {
+		return apperrors.New(apperrors.CodeConflict, "")
+	})
+
+	buf := captureLogs(t)
+	serve(a, http.MethodPost, "/auth/register", `{"name":"Jo","email":"jo@example.com","password":"password123","password_confirm":"password123"}`)
+	assert.NotContains(t, buf.String(), "OpenAPI contract")
+}
+
+// lastLine returns the last log line containing s
+func lastLine(t *testing.T, buf *bytes.Buffer, s string) []byte {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], s) {
+			return []byte(lines[i])
+		}
+	}
+	t.Fatalf("no log line contains %q:\n%s", s, buf.String())
+	return nil
+}
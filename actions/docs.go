@@ -0,0 +1,281 @@
+package actions
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/errorevents"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/flags"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/maintenance"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/openapi"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// apiInfo describes the API in the generated OpenAPI document
+var apiInfo = openapi.Info{
+	Title:       "Production Ready Go Backend API",
+	Version:     "1.0.0",
+	Description: "Authentication and user API. Errors are RFC 7807 problem documents with a stable code; messages follow the Accept-Language header.",
+}
+
+// idempotencyKeyParameter documents the Idempotency-Key header of unsafe
+// operations
+var idempotencyKeyParameter = &openapi.Parameter{
+	Name:   IdempotencyKeyHeader,
+	In:     "header",
+	Schema: &openapi.Schema{Type: openapi.Types{"string"}, MinLength: &[]int{1}[0], MaxLength: &[]int{maxIdempotencyKey}[0]},
+}
+
+// errorEventsLimitParameter bounds the number of error events listed
+var errorEventsLimitParameter = &openapi.Parameter{
+	Name:   "limit",
+	In:     "query",
+	Schema: &openapi.Schema{Type: openapi.Types{"integer"}, Minimum: &[]float64{1}[0], Maximum: &[]float64{200}[0]},
+}
+
+// apiEndpoints annotates the routes declared in App(). Every route needs
+// an entry here: TestContract_Documents_Every_Route fails otherwise.
+var apiEndpoints = []openapi.Endpoint{
+	{
+		Method: http.MethodGet, Path: "/health", OperationID: "health", Tags: []string{"health"},
+		Summary:   "Detailed health information",
+		Responses: map[int]interface{}{http.StatusOK: HealthResponse{}},
+	},
+	{
+		Method: http.MethodGet, Path: "/health/live", OperationID: "liveness", Tags: []string{"health"},
+		Summary:   "Liveness probe",
+		Responses: map[int]interface{}{http.StatusOK: ProbeResponse{}},
+	},
+	{
+		Method: http.MethodGet, Path: "/health/ready", OperationID: "readiness", Tags: []string{"health"},
+		Summary:   "Readiness probe",
+		Responses: map[int]interface{}{http.StatusOK: ProbeResponse{}, http.StatusServiceUnavailable: ProbeResponse{}},
+	},
+	{
+		Method: http.MethodGet, Path: "/openapi.json", OperationID: "openapi", Tags: []string{"docs"},
+		Summary:   "This OpenAPI document",
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}},
+		Errors:    []int{http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/docs", OperationID: "explorer", Tags: []string{"docs"},
+		Summary:     "Interactive API explorer, outside production only",
+		ContentType: "text/html",
+		Responses:   map[int]interface{}{http.StatusOK: nil},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/register", OperationID: "register", Tags: []string{"auth"},
+		Summary:    "Create an account and sign in",
+		Parameters: []*openapi.Parameter{idempotencyKeyParameter},
+		Request:    RegisterRequest{},
+		Responses:  map[int]interface{}{http.StatusCreated: AuthResponse{}},
+		Errors:     []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/login", OperationID: "login", Tags: []string{"auth"},
+		Summary:   "Exchange credentials for a token",
+		Request:   LoginRequest{},
+		Responses: map[int]interface{}{http.StatusOK: AuthResponse{}},
+		Errors:    []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/me", OperationID: "me", Tags: []string{"auth"},
+		Summary: "The signed in user", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: models.User{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/refresh", OperationID: "refresh", Tags: []string{"auth"},
+		Summary: "Issue a new token for the signed in user", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: AuthResponse{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/profile", OperationID: "profile", Tags: []string{"users"},
+		Summary: "The signed in user, alias of /auth/me", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: models.User{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/admin/errors", OperationID: "listErrorEvents", Tags: []string{"admin"},
+		Summary: "Recorded panics, the most recently seen first", Secured: true,
+		Parameters: []*openapi.Parameter{errorEventsLimitParameter},
+		Responses:  map[int]interface{}{http.StatusOK: ErrorEventsResponse{}},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/admin/errors/{fingerprint}", OperationID: "getErrorEvent", Tags: []string{"admin"},
+		Summary: "A recorded panic with the stack of its latest occurrence", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: errorevents.Event{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/admin/flags", OperationID: "listFlags", Tags: []string{"admin"},
+		Summary: "Feature flags, ordered by key", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: FlagsResponse{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/admin/flags", OperationID: "createFlag", Tags: []string{"admin"},
+		Summary: "Create a feature flag", Secured: true,
+		Parameters: []*openapi.Parameter{idempotencyKeyParameter},
+		Request:    CreateFlagRequest{},
+		Responses:  map[int]interface{}{http.StatusCreated: flags.Flag{}},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/admin/flags/{key}", OperationID: "getFlag", Tags: []string{"admin"},
+		Summary: "A feature flag", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: flags.Flag{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodPut, Path: "/api/v1/admin/flags/{key}", OperationID: "updateFlag", Tags: []string{"admin"},
+		Summary: "Replace the targeting of a feature flag", Secured: true,
+		Parameters: []*openapi.Parameter{idempotencyKeyParameter},
+		Request:    FlagRequest{},
+		Responses:  map[int]interface{}{http.StatusOK: flags.Flag{}},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/v1/admin/flags/{key}", OperationID: "deleteFlag", Tags: []string{"admin"},
+		Summary: "Delete a feature flag, turning it off", Secured: true,
+		Parameters: []*openapi.Parameter{idempotencyKeyParameter},
+		Responses:  map[int]interface{}{http.StatusNoContent: nil},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/admin/maintenance", OperationID: "getMaintenance", Tags: []string{"admin"},
+		Summary: "The maintenance mode in effect", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: MaintenanceResponse{}},
+		Errors:    []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		Method: http.MethodPut, Path: "/api/v1/admin/maintenance", OperationID: "updateMaintenance", Tags: []string{"admin"},
+		Summary: "Switch maintenance mode for every replica", Secured: true,
+		Parameters: []*openapi.Parameter{idempotencyKeyParameter},
+		Request:    MaintenanceRequest{},
+		Responses:  map[int]interface{}{http.StatusOK: MaintenanceResponse{}},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+}
+
+// newGenerator returns a generator with the component schemas of the API
+func newGenerator() *openapi.Generator {
+	g := openapi.NewGenerator(apiInfo)
+	user := g.Component("User", models.User{})
+	user.Properties["role"].Enum = []interface{}{models.RoleUser, models.RoleAdmin}
+	user.Properties["email"].Format = "email"
+
+	g.Component("RegisterRequest", RegisterRequest{})
+	g.Component("LoginRequest", LoginRequest{})
+	g.Component("AuthResponse", AuthResponse{})
+	g.Component("HealthResponse", HealthResponse{})
+	g.Component("ProbeResponse", ProbeResponse{})
+	g.Component("ErrorEvent", errorevents.Event{})
+	g.Component("ErrorEventsResponse", ErrorEventsResponse{})
+	g.Component("Flag", flags.Flag{})
+	g.Component("FlagRequest", FlagRequest{})
+	g.Component("CreateFlagRequest", CreateFlagRequest{})
+	g.Component("FlagsResponse", FlagsResponse{})
+	g.Component("MaintenanceRequest", MaintenanceRequest{})
+	state := g.Component("MaintenanceResponse", MaintenanceResponse{})
+	state.Properties["mode"].Enum = []interface{}{maintenance.Off, maintenance.ReadOnly, maintenance.Offline}
+	return g
+}
+
+// BuildContract generates the OpenAPI document of routes from
+// apiEndpoints. Routes without an annotation are left out of the document
+// and returned as "METHOD /path".
+func BuildContract(routes buffalo.RouteList) (*openapi.Document, []string, error) {
+	endpoints := map[string]openapi.Endpoint{}
+	for _, e := range apiEndpoints {
+		endpoints[e.Method+" "+e.Path] = e
+	}
+
+	g := newGenerator()
+	var undocumented []string
+	for _, route := range routes {
+		key := route.Method + " " + routePath(route.Path)
+		e, ok := endpoints[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		g.Add(withLimitErrors(e))
+	}
+
+	doc, err := g.Document()
+	return doc, undocumented, err
+}
+
+// withLimitErrors adds the errors RequestLimits and Maintenance answer
+// with to e: 503 when the request takes too long or during maintenance
+// and, for requests with a body, 408 and 413
+func withLimitErrors(e openapi.Endpoint) openapi.Endpoint {
+	statuses := []int{http.StatusServiceUnavailable}
+	if e.Request != nil {
+		statuses = append(statuses, http.StatusRequestTimeout, http.StatusRequestEntityTooLarge)
+	}
+
+	errs := append([]int(nil), e.Errors...)
+	for _, status := range statuses {
+		if _, ok := e.Responses[status]; ok || slices.Contains(errs, status) {
+			continue
+		}
+		errs = append(errs, status)
+	}
+	e.Errors = errs
+	return e
+}
+
+// routePath strips the trailing slash buffalo adds to every route
+func routePath(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+var (
+	contractOnce sync.Once
+	contract     *openapi.Document
+	contractErr  error
+)
+
+// Contract returns the OpenAPI document of App(), generated once
+func Contract() (*openapi.Document, error) {
+	contractOnce.Do(func() {
+		var undocumented []string
+		contract, undocumented, contractErr = BuildContract(App().Routes())
+		if len(undocumented) > 0 {
+			logging.For("actions").Warn("routes missing from the OpenAPI document", "routes", undocumented)
+		}
+	})
+	return contract, contractErr
+}
+
+// OpenAPIHandler serves the generated OpenAPI document
+// GET /openapi.json
+func OpenAPIHandler(c buffalo.Context) error {
+	doc, err := Contract()
+	if err != nil {
+		return apperrors.Wrap(err, apperrors.CodeInternal, "")
+	}
+	return c.Render(http.StatusOK, r.JSON(doc))
+}
+
+// DocsHandler serves an interactive explorer for the OpenAPI document
+// GET /docs
+func DocsHandler(c buffalo.Context) error {
+	return c.Render(http.StatusOK, r.Func("text/html; charset=utf-8", func(w io.Writer, _ render.Data) error {
+		return openapi.WriteExplorer(w, apiInfo.Title, "/openapi.json")
+	}))
+}
@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract_Documents_Every_Route(t *testing.T) {
+	routes := App().Routes()
+	require.NotEmpty(t, routes)
+
+	_, undocumented, err := BuildContract(routes)
+	require.NoError(t, err)
+	assert.Empty(t, undocumented, "add the routes to apiEndpoints in docs.go")
+
+	doc, err := Contract()
+	require.NoError(t, err)
+	for _, route := range routes {
+		_, _, ok := doc.Find(route.Method, route.Path)
+		assert.True(t, ok, "%s %s is missing from the OpenAPI document", route.Method, route.Path)
+	}
+}
+
+func TestBuildContract_Reports_Undocumented_Routes(t *testing.T) {
+	a := buffalo.New(buffalo.Options{})
+	a.GET("/health", HealthHandler)
+	a.DELETE("/widgets/{id}", HealthHandler)
+
+	doc, undocumented, err := BuildContract(a.Routes())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DELETE /widgets/{id}"}, undocumented)
+	assert.Len(t, doc.Routes(), 1, "only the routes of the table are documented")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	res := httptest.NewRecorder()
+	App().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Contains(t, doc.Paths["/auth/register"], "post")
+	assert.Contains(t, doc.Paths["/api/v1/profile"], "get")
+}
+
+func TestDocsHandler(t *testing.T) {
+	res := httptest.NewRecorder()
+	App().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, res.Body.String(), "/openapi.json")
+}
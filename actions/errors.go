@@ -0,0 +1,82 @@
+package actions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// useProblemErrors routes every error that reaches buffalo, including
+// panics and router 404/405s, through ProblemHandler
+func useProblemErrors(a *buffalo.App) {
+	a.ErrorHandlers.Default(ProblemHandler)
+	a.ErrorHandlers[http.StatusNotFound] = ProblemHandler
+	a.ErrorHandlers[http.StatusMethodNotAllowed] = ProblemHandler
+	a.ErrorHandlers[http.StatusInternalServerError] = ProblemHandler
+}
+
+// ProblemHandler is a buffalo.ErrorHandler that renders err as an RFC 7807
+// application/problem+json document. Application errors keep their own
+// status; other errors use the status buffalo resolved for them.
+func ProblemHandler(status int, err error, c buffalo.Context) error {
+	appErr := toAppError(status, err)
+	if appErr.Status() >= http.StatusInternalServerError {
+		Log(c).Error("request failed", "error", err)
+	}
+	return renderProblem(c, appErr)
+}
+
+// renderProblem writes appErr as a problem document
+func renderProblem(c buffalo.Context, appErr *apperrors.Error) error {
+	// buffalo appends a trailing slash to every path
+	instance := c.Request().URL.Path
+	if len(instance) > 1 {
+		instance = strings.TrimSuffix(instance, "/")
+	}
+
+	l := newLocalizer(c)
+	problem := l.problem(appErr.Problem(instance, ensureRequestID(c)))
+	if l.lang != "" {
+		c.Response().Header().Set("Content-Language", l.lang)
+	}
+	return c.Render(problem.Status, r.Func(apperrors.ContentType, func(w io.Writer, _ render.Data) error {
+		return json.NewEncoder(w).Encode(problem)
+	}))
+}
+
+// toAppError maps err to an application error. Errors without a code get
+// the generic code for status; only router errors, whose messages hold
+// nothing but the method and path, keep their message as detail.
+func toAppError(status int, err error) *apperrors.Error {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperrors.From(err)
+	}
+
+	var he buffalo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Status
+	}
+
+	code := apperrors.CodeForStatus(status)
+	detail := ""
+	if he.Cause == nil && (status == http.StatusNotFound || status == http.StatusMethodNotAllowed) {
+		detail = err.Error()
+	}
+	return apperrors.Wrap(err, code, detail)
+}
+
+// errorStatus returns the HTTP status a handler error will be rendered with
+func errorStatus(err error) int {
+	return toAppError(http.StatusInternalServerError, err).Status()
+}
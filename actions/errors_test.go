@@ -0,0 +1,141 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+)
+
+func (as *ActionSuite) Test_NotFound_Problem() {
+	res := as.JSON("/does-not-exist").Get()
+	as.Equal(http.StatusNotFound, res.Code)
+	as.Equal(apperrors.ContentType, res.Header().Get("Content-Type"))
+
+	var problem apperrors.Problem
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &problem))
+	as.Equal(apperrors.CodeNotFound, problem.Code)
+	as.Equal("/does-not-exist", problem.Instance)
+	as.Equal(res.Header().Get(RequestIDHeader), problem.RequestID)
+}
+
+func (as *ActionSuite) Test_MethodNotAllowed_Problem() {
+	res := as.JSON("/auth/login").Get()
+	as.Equal(http.StatusMethodNotAllowed, res.Code)
+
+	var problem apperrors.Problem
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &problem))
+	as.Equal(apperrors.CodeMethodNotAllowed, problem.Code)
+}
+
+// failingApp serves routes failing in every way the problem handlers
+// cover
+func failingApp() *buffalo.App {
+	a := newTestApp()
+	a.GET("/forbidden", func(c buffalo.Context) error {
+		return apperrors.New(apperrors.CodeForbidden, "admin_access_required")
+	})
+	a.GET("/invalid", func(c buffalo.Context) error {
+		return apperrors.Validation(map[string][]string{"email": {"user_email_taken"}})
+	})
+	a.GET("/boom", func(c buffalo.Context) error {
+		return errors.New("pq: password authentication failed for user postgres")
+	})
+	a.GET("/panic", func(c buffalo.Context) error {
+		panic("nil map write")
+	})
+	a.GET("/http-error", func(c buffalo.Context) error {
+		return c.Error(http.StatusUnauthorized, errors.New("secret internal reason"))
+	})
+	return a
+}
+
+// serveProblem gets path from failingApp in acceptLanguage and checks the
+// problem details every error response carries
+func serveProblem(t *testing.T, path, acceptLanguage string) (*httptest.ResponseRecorder, apperrors.Problem) {
+	t.Helper()
+	res := serve(failingApp(), http.MethodGet, path, nil, "Accept-Language", acceptLanguage)
+	problem := problemOf(t, res)
+	assert.Equal(t, apperrors.ContentType, res.Header().Get("Content-Type"))
+	assert.Equal(t, res.Code, problem.Status)
+	assert.Equal(t, path, problem.Instance)
+	assert.NotEmpty(t, problem.RequestID)
+	return res, problem
+}
+
+func TestProblemHandler_Application_Error(t *testing.T) {
+	res, problem := serveProblem(t, "/forbidden", "")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Equal(t, apperrors.CodeForbidden, problem.Code)
+	assert.Equal(t, "Admin access required", problem.Detail)
+	assert.Equal(t, apperrors.TypeBase+"forbidden", problem.Type)
+}
+
+func TestProblemHandler_Hides_Internal_Errors(t *testing.T) {
+	res, problem := serveProblem(t, "/boom", "")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, apperrors.CodeInternal, problem.Code)
+	assert.NotContains(t, res.Body.String(), "password authentication")
+}
+
+func TestProblemHandler_Panic(t *testing.T) {
+	res, problem := serveProblem(t, "/panic", "")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, apperrors.CodeInternal, problem.Code)
+	assert.NotContains(t, res.Body.String(), "nil map")
+}
+
+func TestProblemHandler_HTTPError(t *testing.T) {
+	res, problem := serveProblem(t, "/http-error", "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, apperrors.CodeUnauthorized, problem.Code)
+	assert.NotContains(t, res.Body.String(), "secret internal reason")
+}
+
+func TestProblemHandler_NotFound(t *testing.T) {
+	res, problem := serveProblem(t, "/nowhere", "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, apperrors.CodeNotFound, problem.Code)
+	assert.Equal(t, problem.RequestID, res.Header().Get(RequestIDHeader))
+}
+
+func TestProblemHandler_Default_Language(t *testing.T) {
+	res, problem := serveProblem(t, "/forbidden", "")
+	assert.Equal(t, "Forbidden", problem.Title)
+	assert.Equal(t, "en-us", res.Header().Get("Content-Language"))
+}
+
+func TestProblemHandler_Localized(t *testing.T) {
+	res, problem := serveProblem(t, "/forbidden", "es-ES,es;q=0.9,en;q=0.8")
+	assert.Equal(t, "es-es", res.Header().Get("Content-Language"))
+	assert.Equal(t, "Prohibido", problem.Title)
+	assert.Equal(t, "Se requiere acceso de administrador", problem.Detail)
+	assert.Equal(t, apperrors.CodeForbidden, problem.Code)
+}
+
+func TestProblemHandler_Localized_Field_Errors(t *testing.T) {
+	_, problem := serveProblem(t, "/invalid", "es")
+	assert.Equal(t, "La validación ha fallado", problem.Title)
+	assert.Equal(t, []string{"El correo electrónico ya está en uso"}, problem.Errors["email"])
+
+	_, problem = serveProblem(t, "/invalid", "en-US")
+	assert.Equal(t, []string{"Email is already taken"}, problem.Errors["email"])
+}
+
+func TestProblemHandler_Localized_Router_Errors(t *testing.T) {
+	_, problem := serveProblem(t, "/nowhere", "es")
+	assert.Equal(t, "No encontrado", problem.Title)
+	// Router details are not message IDs and pass through untouched
+	assert.Contains(t, problem.Detail, "/nowhere")
+}
+
+func TestProblemHandler_Unsupported_Language_Falls_Back(t *testing.T) {
+	_, problem := serveProblem(t, "/forbidden", "fr-FR,fr")
+	assert.Equal(t, "Forbidden", problem.Title)
+	assert.Equal(t, "Admin access required", problem.Detail)
+}
@@ -0,0 +1,192 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/flags"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+)
+
+// newFlagStore returns the store selected by flags.store. Flags in memory
+// are not shared between replicas.
+func newFlagStore(cfg config.Flags) (flags.Store, error) {
+	switch cfg.Store {
+	case "memory":
+		return flags.NewMemoryStore(), nil
+	case "postgres":
+		return flags.NewPostgresStore(models.DB), nil
+	default:
+		return nil, fmt.Errorf("unknown flags store %q", cfg.Store)
+	}
+}
+
+// FeatureFlags returns a middleware making the flags of cache available
+// to FlagOn and RequireFlag
+func FeatureFlags(cache *flags.Cache) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			c.Set("flags", cache)
+			return next(c)
+		}
+	}
+}
+
+// FlagOn reports whether the flag of key is on for the current user, or
+// for an anonymous request before authentication. Unknown flags are off.
+func FlagOn(c buffalo.Context, key string) bool {
+	cache, ok := c.Value("flags").(*flags.Cache)
+	if !ok {
+		return false
+	}
+	return cache.On(key, flagSubject(c))
+}
+
+// flagSubject returns whom the request evaluates flags for
+func flagSubject(c buffalo.Context) flags.Subject {
+	user, ok := c.Value("currentUser").(*models.User)
+	if !ok {
+		return flags.Subject{}
+	}
+	return flags.Subject{UserID: user.ID, Role: user.Role, Org: user.Org}
+}
+
+// RequireFlag returns a middleware answering not found while the flag of
+// key is off, so routes of a dark feature look like they do not exist.
+// Use it after AuthMiddleware to target users.
+func RequireFlag(key string) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			if !FlagOn(c, key) {
+				return apperrors.New(apperrors.CodeNotFound, "")
+			}
+			return next(c)
+		}
+	}
+}
+
+// FlagRequest sets a flag. Users, roles and orgs get the flag once it is
+// enabled; percentage rolls it out to a stable share of the other users.
+type FlagRequest struct {
+	Description string      `json:"description,omitempty" validate:"max=500"`
+	Enabled     bool        `json:"enabled,omitempty"`
+	Users       []uuid.UUID `json:"users,omitempty" validate:"max=1000"`
+	Roles       []string    `json:"roles,omitempty" validate:"max=100"`
+	Orgs        []string    `json:"orgs,omitempty" validate:"max=1000"`
+	Percentage  int         `json:"percentage,omitempty" validate:"min=0,max=100"`
+}
+
+// CreateFlagRequest creates a flag
+type CreateFlagRequest struct {
+	Key string `json:"key" validate:"required,max=64,flag_key"`
+	FlagRequest
+}
+
+// flag returns the flag of key set by req
+func (req FlagRequest) flag(key string) *flags.Flag {
+	return &flags.Flag{
+		Key: key, Description: req.Description, Enabled: req.Enabled,
+		Users: req.Users, Roles: req.Roles, Orgs: req.Orgs, Percentage: req.Percentage,
+	}
+}
+
+// FlagsResponse lists flags
+type FlagsResponse struct {
+	Flags []flags.Flag `json:"flags"`
+}
+
+// flagError maps an error of the flag store to a problem
+func flagError(err error) error {
+	switch {
+	case errors.Is(err, flags.ErrNotFound):
+		return apperrors.Wrap(err, apperrors.CodeNotFound, "")
+	case errors.Is(err, flags.ErrExists):
+		return apperrors.Wrap(err, apperrors.CodeConflict, "flag_exists")
+	default:
+		return apperrors.Wrap(err, apperrors.CodeInternal, "")
+	}
+}
+
+// changedFlags refreshes cache after a change made through this replica,
+// so it shows at once; the others refresh when notified. A failed refresh
+// does not fail the change, which is stored.
+func changedFlags(c buffalo.Context, cache *flags.Cache) {
+	if err := cache.Refresh(c); err != nil {
+		Log(c).Warn("refreshing flags failed", "error", err)
+	}
+}
+
+// FlagsHandler lists every flag
+// GET /api/v1/admin/flags
+func FlagsHandler(cache *flags.Cache) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		list, err := cache.Store().List(c)
+		if err != nil {
+			return flagError(err)
+		}
+		return c.Render(http.StatusOK, r.JSON(FlagsResponse{Flags: list}))
+	}
+}
+
+// FlagHandler returns one flag
+// GET /api/v1/admin/flags/{key}
+func FlagHandler(cache *flags.Cache) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		f, err := cache.Store().Get(c, c.Param("key"))
+		if err != nil {
+			return flagError(err)
+		}
+		return c.Render(http.StatusOK, r.JSON(f))
+	}
+}
+
+// CreateFlagHandler creates a flag
+// POST /api/v1/admin/flags
+func CreateFlagHandler(cache *flags.Cache) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := &CreateFlagRequest{}
+		if err := bind(c, req); err != nil {
+			return err
+		}
+		f := req.flag(req.Key)
+		if err := cache.Store().Create(c, f); err != nil {
+			return flagError(err)
+		}
+		changedFlags(c, cache)
+		return c.Render(http.StatusCreated, r.JSON(f))
+	}
+}
+
+// UpdateFlagHandler replaces a flag
+// PUT /api/v1/admin/flags/{key}
+func UpdateFlagHandler(cache *flags.Cache) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := &FlagRequest{}
+		if err := bind(c, req); err != nil {
+			return err
+		}
+		f := req.flag(c.Param("key"))
+		if err := cache.Store().Update(c, f); err != nil {
+			return flagError(err)
+		}
+		changedFlags(c, cache)
+		return c.Render(http.StatusOK, r.JSON(f))
+	}
+}
+
+// DeleteFlagHandler deletes a flag, which turns it off
+// DELETE /api/v1/admin/flags/{key}
+func DeleteFlagHandler(cache *flags.Cache) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if err := cache.Store().Delete(c, c.Param("key")); err != nil {
+			return flagError(err)
+		}
+		changedFlags(c, cache)
+		return c.Render(http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/flags"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flagsApp serves the flag admin endpoints under /flags without
+// authentication, and /beta behind the "beta" flag for the user whose
+// role is sent in X-Role
+func flagsApp(cache *flags.Cache) *buffalo.App {
+	a := newTestApp(FeatureFlags(cache))
+	a.Use(func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				c.Set("currentUser", &models.User{ID: uuid.Must(uuid.NewV4()), Role: role})
+			}
+			return next(c)
+		}
+	})
+	a.GET("/flags", FlagsHandler(cache))
+	a.POST("/flags", CreateFlagHandler(cache))
+	a.GET("/flags/{key}", FlagHandler(cache))
+	a.PUT("/flags/{key}", UpdateFlagHandler(cache))
+	a.DELETE("/flags/{key}", DeleteFlagHandler(cache))
+	beta := a.Group("/beta")
+	beta.Use(RequireFlag("beta"))
+	beta.GET("/", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, r.JSON(map[string]bool{"beta": FlagOn(c, "beta")}))
+	})
+	return a
+}
+
+func TestFlags_Admin_Endpoints(t *testing.T) {
+	a := flagsApp(flags.NewCache(flags.NewMemoryStore()))
+
+	res := serve(a, http.MethodPost, "/flags", `{"key":"beta","description":"Beta","enabled":true,"percentage":10}`)
+	require.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+	var f flags.Flag
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &f))
+	assert.Equal(t, "beta", f.Key)
+	assert.Equal(t, 10, f.Percentage)
+	assert.Equal(t, []string{}, f.Roles)
+
+	res = serve(a, http.MethodPost, "/flags", `{"key":"beta"}`)
+	assert.Equal(t, http.StatusConflict, res.Code)
+
+	res = serve(a, http.MethodPost, "/flags", `{"key":"Not A Key"}`)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, res.Body.String(), string(apperrors.CodeValidationFailed))
+
+	res = serve(a, http.MethodPut, "/flags/beta", `{"enabled":true,"roles":["admin"]}`)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &f))
+	assert.Equal(t, []string{"admin"}, f.Roles)
+	assert.Zero(t, f.Percentage, "updates replace the flag")
+
+	res = serve(a, http.MethodPut, "/flags/missing", `{}`)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = serve(a, http.MethodGet, "/flags", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	var list FlagsResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &list))
+	require.Len(t, list.Flags, 1)
+
+	res = serve(a, http.MethodGet, "/flags/beta", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = serve(a, http.MethodDelete, "/flags/beta", nil)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	res = serve(a, http.MethodGet, "/flags/beta", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestRequireFlag(t *testing.T) {
+	a := flagsApp(flags.NewCache(flags.NewMemoryStore()))
+
+	res := serve(a, http.MethodGet, "/beta", nil, "X-Role", "admin")
+	require.Equal(t, http.StatusNotFound, res.Code, "unknown flags are off")
+	assert.Contains(t, res.Body.String(), string(apperrors.CodeNotFound))
+
+	// Changes made through the admin endpoints apply at once
+	res = serve(a, http.MethodPost, "/flags", `{"key":"beta","enabled":true,"roles":["admin"]}`)
+	require.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+
+	res = serve(a, http.MethodGet, "/beta", nil, "X-Role", "admin")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"beta":true}`, res.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(a, http.MethodGet, "/beta", nil, "X-Role", "user").Code)
+	assert.Equal(t, http.StatusNotFound, serve(a, http.MethodGet, "/beta", nil).Code, "anonymous")
+
+	res = serve(a, http.MethodPut, "/flags/beta", `{"enabled":false,"roles":["admin"]}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, http.StatusNotFound, serve(a, http.MethodGet, "/beta", nil, "X-Role", "admin").Code, "switched off")
+}
+
+func TestFlagOn_Without_Flags_Is_Off(t *testing.T) {
+	a := newTestApp()
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, r.JSON(map[string]bool{"beta": FlagOn(c, "beta")}))
+	})
+	res := serve(a, http.MethodGet, "/", nil)
+	assert.JSONEq(t, `{"beta":false}`, res.Body.String())
+}
@@ -2,10 +2,10 @@ package actions
 
 import (
 	"net/http"
-	"os"
 	"runtime"
 	"time"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
 	"github.com/gobuffalo/buffalo"
 )
 
@@ -28,6 +28,13 @@ type SystemInfo struct {
 	Arch          string `json:"arch"`
 }
 
+// ProbeResponse is the body of the liveness and readiness probes
+type ProbeResponse struct {
+	Status    string            `json:"status"`
+	Timestamp string            `json:"timestamp" openapi:"format=date-time"`
+	Services  map[string]string `json:"services,omitempty"`
+}
+
 var startTime = time.Now()
 
 // HealthHandler provides comprehensive health check information
@@ -39,7 +46,7 @@ func HealthHandler(c buffalo.Context) error {
 		Status:    "healthy",
 		Timestamp: time.Now().UTC(),
 		Uptime:    uptime.String(),
-		Version:   "1.0.0",
+		Version:   config.Get().Telemetry.Version,
 		Services: map[string]string{
 			"api":      "healthy",
 			"database": "not_configured", // Will be updated when database is added
@@ -60,9 +67,9 @@ func HealthHandler(c buffalo.Context) error {
 // LivenessHandler provides a simple liveness probe for Kubernetes
 // GET /health/live
 func LivenessHandler(c buffalo.Context) error {
-	return c.Render(http.StatusOK, r.JSON(map[string]string{
-		"status":    "alive",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	return c.Render(http.StatusOK, r.JSON(ProbeResponse{
+		Status:    "alive",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}))
 }
 
@@ -74,7 +81,7 @@ func checkReadiness() (bool, map[string]string) {
 	}
 
 	// Check if we're in a simulated not-ready state (for testing)
-	if os.Getenv("SIMULATE_NOT_READY") == "true" {
+	if config.Get().Server.SimulateNotReady {
 		services["api"] = "not_ready"
 		return false, services
 	}
@@ -101,9 +108,9 @@ func ReadinessHandler(c buffalo.Context) error {
 		httpStatus = http.StatusServiceUnavailable
 	}
 
-	return c.Render(httpStatus, r.JSON(map[string]interface{}{
-		"status":    status,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"services":  services,
+	return c.Render(httpStatus, r.JSON(ProbeResponse{
+		Status:    status,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Services:  services,
 	}))
 }
@@ -3,10 +3,10 @@ package actions
 import (
 	"encoding/json"
 	"net/http"
-	"os"
 	"testing"
 	"time"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -90,9 +90,9 @@ func (as *ActionSuite) Test_ReadinessHandler() {
 
 func (as *ActionSuite) Test_ReadinessHandler_NotReady() {
 	// Test readiness probe when not ready
-	// Set environment variable to simulate not ready state
-	os.Setenv("SIMULATE_NOT_READY", "true")
-	defer os.Unsetenv("SIMULATE_NOT_READY")
+	// Simulate the not ready state
+	config.Get().Server.SimulateNotReady = true
+	defer func() { config.Get().Server.SimulateNotReady = false }()
 
 	res := as.JSON("/health/ready").Get()
 
@@ -257,8 +257,8 @@ func TestCheckReadiness(t *testing.T) {
 	assert.Equal(t, "ready", services["api"])
 
 	// Test not ready state
-	os.Setenv("SIMULATE_NOT_READY", "true")
-	defer os.Unsetenv("SIMULATE_NOT_READY")
+	config.Get().Server.SimulateNotReady = true
+	defer func() { config.Get().Server.SimulateNotReady = false }()
 
 	ready, services = checkReadiness()
 	assert.False(t, ready)
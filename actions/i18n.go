@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/middleware/i18n"
+	goi18n "github.com/nicksnyder/go-i18n/i18n"
+)
+
+// languages returns the language preferences of the request. Requests that
+// went through the translations middleware carry them in the context
+// (with any user preference first); router errors never reach it, so
+// those fall back to Accept-Language.
+func languages(c buffalo.Context) []string {
+	if langs, ok := c.Value("languages").([]string); ok && len(langs) > 0 {
+		return langs
+	}
+	if T == nil {
+		return nil
+	}
+	langs := i18n.HeaderLanguageExtractor(T.LanguageExtractorOptions, c)
+	return append(langs, T.DefaultLanguage)
+}
+
+// localizer translates message IDs into the negotiated language of a
+// request. IDs without a translation are returned unchanged, so plain
+// messages pass through as they are.
+type localizer struct {
+	tfunc goi18n.TranslateFunc
+	lang  string
+}
+
+func newLocalizer(c buffalo.Context) localizer {
+	langs := languages(c)
+	if len(langs) == 0 {
+		return localizer{}
+	}
+	tfunc, lang, err := goi18n.TfuncAndLanguage(langs[0], langs[1:]...)
+	if err != nil || lang == nil {
+		return localizer{}
+	}
+	return localizer{tfunc: tfunc, lang: lang.Tag}
+}
+
+// T translates id, returning fallback when no translation exists
+func (l localizer) T(id, fallback string) string {
+	if l.tfunc == nil || id == "" {
+		return fallback
+	}
+	if s := l.tfunc(id); s != id {
+		return s
+	}
+	return fallback
+}
+
+// message translates a problem message. Messages are plain text, a
+// message ID, or a message ID with a parameter as "id:param", which is
+// available to the translation as {{.Param}}.
+func (l localizer) message(msg string) string {
+	if s := l.T(msg, ""); s != "" {
+		return s
+	}
+	if id, param, ok := strings.Cut(msg, ":"); ok && l.tfunc != nil {
+		if s := l.tfunc(id, map[string]interface{}{"Param": param}); s != id {
+			return s
+		}
+	}
+	return msg
+}
+
+// problem translates the title, detail and field messages of p
+func (l localizer) problem(p apperrors.Problem) apperrors.Problem {
+	p.Title = l.T("error_"+string(p.Code), p.Title)
+	p.Detail = l.message(p.Detail)
+	if len(p.Errors) > 0 {
+		fields := make(map[string][]string, len(p.Errors))
+		for field, msgs := range p.Errors {
+			for _, msg := range msgs {
+				fields[field] = append(fields[field], l.message(msg))
+			}
+		}
+		p.Errors = fields
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	goi18n "github.com/nicksnyder/go-i18n/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocales_Translate_Every_Message(t *testing.T) {
+	translations()
+
+	en := goi18n.LanguageTranslationIDs("en-us")
+	require.NotEmpty(t, en)
+	sort.Strings(en)
+
+	for _, tag := range T.AvailableLanguages() {
+		ids := goi18n.LanguageTranslationIDs(tag)
+		sort.Strings(ids)
+		assert.Equal(t, en, ids, "locale %s is out of sync with en-us", tag)
+	}
+
+	for _, code := range []apperrors.Code{
+		apperrors.CodeInvalidRequest, apperrors.CodeValidationFailed, apperrors.CodePasswordMismatch,
+		apperrors.CodeInvalidCredentials, apperrors.CodeAuthorizationMissing, apperrors.CodeAuthorizationInvalid,
+		apperrors.CodeInvalidToken, apperrors.CodeUnauthorized, apperrors.CodeForbidden, apperrors.CodeNotFound,
+		apperrors.CodeMethodNotAllowed, apperrors.CodeRequestTimeout, apperrors.CodeConflict, apperrors.CodeIdempotencyBusy, apperrors.CodeIdempotencyReused, apperrors.CodePayloadTooLarge, apperrors.CodeRateLimited,
+		apperrors.CodeClientClosed, apperrors.CodeInternal, apperrors.CodeServiceUnavailable, apperrors.CodeDeadlineExceeded, apperrors.CodeMaintenance,
+	} {
+		assert.Contains(t, en, "error_"+string(code))
+	}
+}
+
+func TestLocalizer_Passes_Unknown_Messages_Through(t *testing.T) {
+	var l localizer
+	assert.Equal(t, "plain", l.T("plain", "plain"))
+
+	translations()
+	tfunc, lang, err := goi18n.TfuncAndLanguage("es")
+	require.NoError(t, err)
+	l = localizer{tfunc: tfunc, lang: lang.Tag}
+	assert.Equal(t, "Prohibido", l.T("error_forbidden", "Forbidden"))
+	assert.Equal(t, "not an id", l.T("not an id", "not an id"))
+
+	p := l.problem(apperrors.New(apperrors.CodeInvalidCredentials, "").Problem("/auth/login", ""))
+	assert.Equal(t, "Credenciales no válidas", p.Title)
+	assert.Equal(t, http.StatusUnauthorized, p.Status)
+}
@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/binding"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/idempotency"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lock"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+)
+
+// IdempotencyKeyHeader carries the key a client chose for an unsafe
+// request and reuses when retrying it
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey bounds the length of Idempotency-Key values
+const maxIdempotencyKey = 255
+
+// idempotencyClaimTTL bounds how long a request in progress holds its
+// key, so a crashed instance does not block retries for the whole TTL
+const idempotencyClaimTTL = time.Minute
+
+// replayedHeaders are stored with responses and sent again on replay
+var replayedHeaders = []string{"Content-Type", "Content-Language", "Location"}
+
+// newIdempotencyStore returns the store named by IDEMPOTENCY_STORE:
+// "memory" (the default) or "postgres", which uses models.DB and cleans up
+// expired keys in a job registered with lifecycle.Default
+func newIdempotencyStore() (idempotency.Store, error) {
+	switch store := envy.Get("IDEMPOTENCY_STORE", "memory"); store {
+	case "memory":
+		return idempotency.NewMemoryStore(), nil
+	case "postgres":
+		locker, err := lock.NewPostgres(models.DB)
+		if err != nil {
+			return nil, err
+		}
+		store := idempotency.NewPostgresStore(models.DB)
+		lifecycle.Append(cleanupJob("idempotency", store, locker))
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown IDEMPOTENCY_STORE %q", store)
+	}
+}
+
+// Idempotency returns a middleware that makes unsafe requests carrying an
+// Idempotency-Key safe to retry. The first request runs and its response
+// is kept for ttl; retries with the same key and body get that response
+// again, marked with "Idempotent-Replayed: true". A retry arriving while
+// the first request still runs gets a 409, and reusing a key for a
+// different request a 422. Keys are scoped to the user, or the client IP
+// before sign in, and to the route. Failed requests are not kept, so they
+// can be retried, and neither are responses marked "Cache-Control:
+// no-store", such as those carrying tokens. Requests are fingerprinted
+// with an HMAC keyed with secret.
+func Idempotency(store idempotency.Store, ttl time.Duration, secret []byte) buffalo.MiddlewareFunc {
+	return idempotent(store, ttl, secret, nil)
+}
+
+// ReplayFunc answers a retry from the reference its first request kept
+// with replayAs, with the status that request was answered with
+type ReplayFunc func(c buffalo.Context, status int, ref string) error
+
+// IdempotentReplay is Idempotency for routes whose responses must not be
+// stored, such as sign up, which answers with a token. Their handlers
+// call replayAs with a reference to what they did, such as the ID of the
+// user they created, which is kept instead of the response; retries are
+// answered by rebuild from it. Responses without a reference are not
+// kept.
+func IdempotentReplay(store idempotency.Store, ttl time.Duration, secret []byte, rebuild ReplayFunc) buffalo.MiddlewareFunc {
+	return idempotent(store, ttl, secret, rebuild)
+}
+
+// replayAs keeps ref for IdempotentReplay to answer retries of the request
+// of c with. Outside IdempotentReplay it does nothing.
+func replayAs(c buffalo.Context, ref string) {
+	c.Set("idempotencyRef", ref)
+}
+
+// idempotent returns Idempotency, or IdempotentReplay when rebuild is set
+func idempotent(store idempotency.Store, ttl time.Duration, secret []byte, rebuild ReplayFunc) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !unsafeMethod(req.Method) {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKey {
+				return apperrors.Newf(apperrors.CodeInvalidRequest, "idempotency_key_invalid:%d", maxIdempotencyKey)
+			}
+
+			body, err := peekBody(req, binding.Limit(req))
+			if err != nil {
+				return bodyError(err)
+			}
+			fingerprint := idempotency.Fingerprint(secret, req.Method, req.URL.Path, body)
+			scoped := idempotencyScope(c, key)
+
+			rec, claimed, err := store.Begin(c, scoped, fingerprint, idempotencyClaimTTL)
+			if err != nil {
+				Log(c).Warn("idempotency store unavailable, running request", "error", err)
+				return next(c)
+			}
+			if !claimed {
+				switch {
+				case rec.Fingerprint != fingerprint:
+					return apperrors.New(apperrors.CodeIdempotencyReused, "")
+				case !rec.Done:
+					return apperrors.New(apperrors.CodeIdempotencyBusy, "")
+				case rebuild != nil:
+					c.Response().Header().Set("Idempotent-Replayed", "true")
+					return rebuild(c, rec.Status, string(rec.Body))
+				default:
+					return replay(c, rec)
+				}
+			}
+
+			res, ok := c.Response().(*buffalo.Response)
+			if !ok {
+				defer releaseIdempotencyKey(c, store, scoped)
+				return next(c)
+			}
+			capture := &captureWriter{ResponseWriter: res.ResponseWriter}
+			res.ResponseWriter = capture
+			kept := false
+			defer func() {
+				// Keys of responses not kept are freed for the retry, also
+				// when next panics
+				res.ResponseWriter = capture.ResponseWriter
+				if !kept {
+					releaseIdempotencyKey(c, store, scoped)
+				}
+			}()
+			err = next(c)
+
+			status := res.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// Errors are rendered further up the stack, so their body is not
+			// at hand; like server errors, oversized bodies and responses
+			// that must not be stored they are not kept and the retry runs
+			// again
+			if err != nil || status >= http.StatusInternalServerError {
+				return err
+			}
+
+			var done idempotency.Record
+			if rebuild != nil {
+				ref, ok := c.Value("idempotencyRef").(string)
+				if !ok {
+					return nil
+				}
+				done = idempotency.Record{Fingerprint: fingerprint, Status: status, Body: []byte(ref)}
+			} else {
+				if capture.body() == nil || noStore(res.Header()) {
+					return nil
+				}
+				header := http.Header{}
+				for _, name := range replayedHeaders {
+					if v := res.Header().Values(name); len(v) > 0 {
+						header[name] = v
+					}
+				}
+				done = idempotency.Record{Fingerprint: fingerprint, Status: status, Header: header, Body: capture.body()}
+			}
+			if err := store.Complete(context.WithoutCancel(c), scoped, done, ttl); err != nil {
+				Log(c).Warn("could not store idempotent response", "error", err)
+				return nil
+			}
+			kept = true
+			return nil
+		}
+	}
+}
+
+// idempotencySecret returns the key fingerprints are computed with,
+// derived from the JWT secret of cfg so every instance shares it. Keys
+// claimed before a rotation of that secret no longer match their retries,
+// which then get a 422.
+func idempotencySecret(cfg *config.Config) []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.Auth.JWTSecret))
+	mac.Write([]byte("idempotency"))
+	return mac.Sum(nil)
+}
+
+// noStore tells whether h forbids storing the response
+func noStore(h http.Header) bool {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyScope returns the store key of a client key: the same key
+// sent by another user or to another route is a different key
+func idempotencyScope(c buffalo.Context, key string) string {
+	sum := sha256.Sum256([]byte(ByUser(c) + "\n" + c.Request().Method + " " + routePath(c.Request().URL.Path) + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func releaseIdempotencyKey(c buffalo.Context, store idempotency.Store, scoped string) {
+	if err := store.Release(context.WithoutCancel(c), scoped); err != nil {
+		Log(c).Warn("could not release idempotency key", "error", err)
+	}
+}
+
+// replay writes a stored response
+func replay(c buffalo.Context, rec *idempotency.Record) error {
+	h := c.Response().Header()
+	for name, values := range rec.Header {
+		h[name] = values
+	}
+	h.Set("Idempotent-Replayed", "true")
+	c.Response().WriteHeader(rec.Status)
+	_, err := c.Response().Write(rec.Body)
+	return err
+}
+
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
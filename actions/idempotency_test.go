@@ -0,0 +1,160 @@
+package actions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/errorevents"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/idempotency"
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idempotentApp serves POST /orders behind the Idempotency middleware,
+// counting the requests that reach the handler
+func idempotentApp(handler buffalo.Handler) *buffalo.App {
+	a := newTestApp(Idempotency(idempotency.NewMemoryStore(), time.Hour, []byte("test-secret")))
+	a.POST("/orders", handler)
+	a.GET("/orders", handler)
+	return a
+}
+
+func countingHandler(runs *int32) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		n := atomic.AddInt32(runs, 1)
+		c.Response().Header().Set("Location", "/orders/1")
+		return c.Render(http.StatusCreated, r.JSON(map[string]int32{"run": n}))
+	}
+}
+
+func TestIdempotency_Replays_Response(t *testing.T) {
+	var runs int32
+	a := idempotentApp(countingHandler(&runs))
+
+	first := serve(a, http.MethodPost, "/orders", `{"item":1}`, IdempotencyKeyHeader, "k1")
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	again := serve(a, http.MethodPost, "/orders", `{"item":1}`, IdempotencyKeyHeader, "k1")
+	require.Equal(t, http.StatusCreated, again.Code)
+	assert.Equal(t, "true", again.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "/orders/1", again.Header().Get("Location"))
+	assert.Equal(t, first.Body.String(), again.Body.String())
+	assert.EqualValues(t, 1, atomic.LoadInt32(&runs))
+}
+
+func TestIdempotency_Rejects_Reused_Key(t *testing.T) {
+	var runs int32
+	a := idempotentApp(countingHandler(&runs))
+
+	require.Equal(t, http.StatusCreated, serve(a, http.MethodPost, "/orders", `{"item":1}`, IdempotencyKeyHeader, "k1").Code)
+	res := serve(a, http.MethodPost, "/orders", `{"item":2}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Contains(t, res.Body.String(), apperrors.CodeIdempotencyReused)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&runs))
+}
+
+func TestIdempotency_Conflicts_While_In_Progress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	a := idempotentApp(func(c buffalo.Context) error {
+		close(started)
+		<-release
+		return c.Render(http.StatusCreated, r.JSON(map[string]string{"ok": "yes"}))
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1") }()
+	<-started
+
+	res := serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Contains(t, res.Body.String(), apperrors.CodeIdempotencyBusy)
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestIdempotency_Releases_Failed_Requests(t *testing.T) {
+	var runs int32
+	a := idempotentApp(func(c buffalo.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return apperrors.New(apperrors.CodeInternal, "")
+		}
+		return c.Render(http.StatusCreated, r.JSON(map[string]string{"ok": "yes"}))
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1").Code)
+	res := serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Empty(t, res.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&runs))
+}
+
+func TestIdempotency_Releases_Panicking_Requests(t *testing.T) {
+	var runs int32
+	a := newTestApp(
+		Recovery(errorevents.NewMemoryStore()),
+		Idempotency(idempotency.NewMemoryStore(), time.Hour, []byte("test-secret")),
+	)
+	a.POST("/orders", func(c buffalo.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			panic("boom")
+		}
+		return c.Render(http.StatusCreated, r.JSON(map[string]string{"ok": "yes"}))
+	})
+
+	res := serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Contains(t, res.Body.String(), apperrors.CodeInternal, "Recovery answers on the real writer")
+	res = serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusCreated, res.Code, "the key is not left claimed")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&runs))
+}
+
+func TestIdempotency_Does_Not_Keep_No_Store_Responses(t *testing.T) {
+	var runs int32
+	a := idempotentApp(func(c buffalo.Context) error {
+		n := atomic.AddInt32(&runs, 1)
+		c.Response().Header().Set("Cache-Control", "private, no-store")
+		return c.Render(http.StatusCreated, r.JSON(map[string]int32{"token": n}))
+	})
+
+	serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	res := serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Empty(t, res.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&runs))
+}
+
+func TestIdempotency_Passes_Through(t *testing.T) {
+	var runs int32
+	a := idempotentApp(countingHandler(&runs))
+
+	serve(a, http.MethodPost, "/orders", `{}`)
+	serve(a, http.MethodPost, "/orders", `{}`)
+	serve(a, http.MethodGet, "/orders", nil, IdempotencyKeyHeader, "k1")
+	serve(a, http.MethodGet, "/orders", nil, IdempotencyKeyHeader, "k1")
+	assert.EqualValues(t, 4, atomic.LoadInt32(&runs))
+
+	res := serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKey+1))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestIdempotency_Scopes_Keys_Per_Client(t *testing.T) {
+	var runs int32
+	a := idempotentApp(countingHandler(&runs))
+
+	serve(a, http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	other := newRequest(http.MethodPost, "/orders", `{}`, IdempotencyKeyHeader, "k1")
+	other.RemoteAddr = "10.0.0.2:1234"
+	res := serveRequest(a, other)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Empty(t, res.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&runs))
+}
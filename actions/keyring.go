@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/secrets"
+)
+
+// errUnknownKey rejects tokens signed with a key no longer accepted
+var errUnknownKey = errors.New("token signed with an unknown key")
+
+var (
+	jwtKeyring     *secrets.Keyring
+	jwtKeyringOnce sync.Once
+)
+
+// jwtKeys returns the keyring signing and verifying tokens, built from the
+// JWT secrets of the configuration on first use
+func jwtKeys() *secrets.Keyring {
+	jwtKeyringOnce.Do(func() {
+		auth := config.Get().Auth
+		jwtKeyring = secrets.NewKeyring(auth.JWTSecret, auth.JWTPreviousSecrets...)
+	})
+	return jwtKeyring
+}
+
+// secretsRefreshJob returns a background job rotating the JWT keyring to
+// the secrets of the configuration, reloaded every interval
+func secretsRefreshJob(every time.Duration) lifecycle.Hook {
+	return lifecycle.Hook{Name: "secrets.refresh", Run: func(ctx context.Context) error {
+		refreshSecrets(ctx, config.Get(), jwtKeys(), every)
+		return nil
+	}}
+}
+
+// refreshSecrets reloads cfg every interval until ctx is done and rotates
+// keyring when its JWT secrets changed. Invalid reloads keep the keys in
+// use.
+func refreshSecrets(ctx context.Context, cfg *config.Config, keyring *secrets.Keyring, every time.Duration) {
+	log := logging.For("secrets")
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fresh, err := cfg.Reload(ctx)
+		if err == nil {
+			err = fresh.Validate()
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn("reloading secrets failed", "error", err)
+			}
+			continue
+		}
+		if keyring.Rotate(fresh.Auth.JWTSecret, fresh.Auth.JWTPreviousSecrets...) {
+			log.Info("rotated JWT keys", "key_id", keyring.Current().ID)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/secrets"
+	"github.com/gobuffalo/envy"
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotateJWTKeys rotates the JWT keyring for the test and restores the keys
+// of the configuration afterwards
+func rotateJWTKeys(t *testing.T, current string, previous ...string) {
+	t.Helper()
+	jwtKeys().Rotate(current, previous...)
+	t.Cleanup(func() {
+		auth := config.Get().Auth
+		jwtKeys().Rotate(auth.JWTSecret, auth.JWTPreviousSecrets...)
+	})
+}
+
+func TestJWT_Key_Rotation(t *testing.T) {
+	user := &models.User{Email: "rotate@example.com", Role: models.RoleUser}
+	user.ID = uuid.Must(uuid.NewV4())
+
+	rotateJWTKeys(t, "first-secret-first-secret-first-secret")
+	old, _, err := GenerateJWT(user)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(old, &JWTClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, secrets.NewKey("first-secret-first-secret-first-secret").ID, parsed.Header["kid"])
+
+	jwtKeys().Rotate("second-secret-second-secret-second", "first-secret-first-secret-first-secret")
+	_, err = ValidateJWT(old)
+	assert.NoError(t, err, "tokens of the previous key stay valid")
+	current, _, err := GenerateJWT(user)
+	require.NoError(t, err)
+	_, err = ValidateJWT(current)
+	assert.NoError(t, err)
+
+	jwtKeys().Rotate("second-secret-second-secret-second")
+	_, err = ValidateJWT(old)
+	assert.ErrorIs(t, err, errUnknownKey, "the previous key was retired")
+}
+
+func TestJWT_Accepts_Tokens_Without_Key_ID(t *testing.T) {
+	rotateJWTKeys(t, "legacy-secret-legacy-secret-legacy")
+	claims := &JWTClaims{UserID: uuid.Must(uuid.NewV4()).String(), RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("legacy-secret-legacy-secret-legacy"))
+	require.NoError(t, err)
+
+	got, err := ValidateJWT(token)
+	require.NoError(t, err)
+	assert.Equal(t, claims.UserID, got.UserID)
+}
+
+func TestRefreshSecrets_Rotates_Keys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt_secret")
+	require.NoError(t, os.WriteFile(path, []byte("mounted-secret-one\n"), 0o600))
+
+	envy.Temp(func() {
+		envy.Set("JWT_SECRET_FILE", path)
+		cfg, err := config.Load(nil)
+		require.NoError(t, err)
+		keyring := secrets.NewKeyring(cfg.Auth.JWTSecret)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			refreshSecrets(ctx, cfg, keyring, 10*time.Millisecond)
+		}()
+
+		// Kubernetes updates mounted secrets in place
+		require.NoError(t, os.WriteFile(path, []byte("mounted-secret-two\n"), 0o600))
+		assert.Eventually(t, func() bool {
+			return string(keyring.Current().Secret) == "mounted-secret-two"
+		}, time.Second, 10*time.Millisecond)
+
+		// An unreadable secret keeps the keys in use
+		require.NoError(t, os.Remove(path))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, "mounted-secret-two", string(keyring.Current().Secret))
+
+		cancel()
+		<-done
+	})
+}
@@ -0,0 +1,201 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/binding"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+)
+
+// RouteLimits bounds the duration and body size of requests
+type RouteLimits struct {
+	// Timeout is the deadline of the request context, which handlers pass
+	// on to models.DB; 0 disables it
+	Timeout time.Duration
+	// MaxBody is the largest accepted request body, in bytes
+	MaxBody int64
+}
+
+// merge returns l with the non-zero fields of override applied
+func (l RouteLimits) merge(override RouteLimits) RouteLimits {
+	if override.Timeout != 0 {
+		l.Timeout = override.Timeout
+	}
+	if override.MaxBody != 0 {
+		l.MaxBody = override.MaxBody
+	}
+	return l
+}
+
+// routeLimits are the built-in limits of routes, keyed by "METHOD /path".
+// Probes must answer well within the probe timeout of the orchestrator and
+// sign in requests are small.
+var routeLimits = map[string]RouteLimits{
+	"GET /health/live":    {Timeout: 2 * time.Second},
+	"GET /health/ready":   {Timeout: 5 * time.Second},
+	"POST /auth/register": {MaxBody: 64 << 10},
+	"POST /auth/login":    {MaxBody: 64 << 10},
+}
+
+// requestLimitsFromEnv returns the default limits, read from
+// REQUEST_TIMEOUT (default "30s") and REQUEST_MAX_BODY (default "1MB"), and
+// the limits of routes: routeLimits overridden by REQUEST_LIMITS, a
+// semicolon separated list such as
+// "POST /auth/login=5s; POST /api/v1/imports=2m,10MB"
+func requestLimitsFromEnv() (RouteLimits, map[string]RouteLimits, error) {
+	var defaults RouteLimits
+	var err error
+	if defaults.Timeout, err = time.ParseDuration(envy.Get("REQUEST_TIMEOUT", "30s")); err != nil {
+		return defaults, nil, fmt.Errorf("REQUEST_TIMEOUT: %w", err)
+	}
+	if defaults.MaxBody, err = parseSize(envy.Get("REQUEST_MAX_BODY", "1MB")); err != nil {
+		return defaults, nil, fmt.Errorf("REQUEST_MAX_BODY: %w", err)
+	}
+
+	routes := map[string]RouteLimits{}
+	for route, l := range routeLimits {
+		routes[route] = l
+	}
+	for _, entry := range strings.Split(envy.Get("REQUEST_LIMITS", ""), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, l, err := parseRouteLimits(entry)
+		if err != nil {
+			return defaults, nil, fmt.Errorf("REQUEST_LIMITS: %w", err)
+		}
+		routes[route] = routes[route].merge(l)
+	}
+	return defaults, routes, nil
+}
+
+// parseRouteLimits parses "METHOD /path=limit,limit" where each limit is a
+// duration or a size
+func parseRouteLimits(entry string) (string, RouteLimits, error) {
+	var l RouteLimits
+	route, values, ok := strings.Cut(entry, "=")
+	method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+	if !ok || !hasPath || !strings.HasPrefix(strings.TrimSpace(path), "/") {
+		return "", l, fmt.Errorf("%q is not METHOD /path=limits", entry)
+	}
+	for _, v := range strings.Split(values, ",") {
+		v = strings.TrimSpace(v)
+		if d, err := time.ParseDuration(v); err == nil {
+			l.Timeout = d
+			continue
+		}
+		size, err := parseSize(v)
+		if err != nil {
+			return "", l, fmt.Errorf("%q: %q is neither a duration nor a size", entry, v)
+		}
+		l.MaxBody = size
+	}
+	return strings.ToUpper(method) + " " + routePath(strings.TrimSpace(path)), l, nil
+}
+
+// parseSize parses a byte size such as "512", "64KB" or "10MB"; units are
+// powers of 1024
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// RequestLimits returns a middleware that enforces limits, or the limits
+// of the matched route in routes. Bodies over the limit are rejected with
+// a 413; a body still arriving when the timeout passes gets a 408. Handlers
+// see the timeout as the deadline of their context: queries run with
+// models.DB.WithContext(c) are cancelled once it passes, or as soon as the
+// client disconnects, and the request fails with a 503.
+func RequestLimits(limits RouteLimits, routes map[string]RouteLimits) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			req := c.Request()
+			l := limits
+			if ri, ok := c.Value("current_route").(buffalo.RouteInfo); ok {
+				l = l.merge(routes[req.Method+" "+routePath(ri.Path)])
+			}
+
+			if l.MaxBody > 0 {
+				if req.ContentLength > l.MaxBody {
+					return apperrors.Newf(apperrors.CodePayloadTooLarge, "request_body_too_large:%d", l.MaxBody)
+				}
+				if req.Body != nil && req.Body != http.NoBody {
+					req.Body = http.MaxBytesReader(c.Response(), req.Body, l.MaxBody)
+				}
+			}
+
+			ctx := binding.WithLimit(c, l.MaxBody)
+			if l.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+				defer cancel()
+				// Bound reading the body as well; test recorders cannot
+				// set deadlines and rely on the context alone
+				if res, ok := c.Response().(*buffalo.Response); ok {
+					deadline, _ := ctx.Deadline()
+					_ = http.NewResponseController(res.ResponseWriter).SetReadDeadline(deadline)
+				}
+			}
+
+			err := next(withContext(c, ctx))
+			if err == nil || ctx.Err() == nil {
+				return err
+			}
+			return contextError(ctx, err, l.Timeout)
+		}
+	}
+}
+
+// contextError explains a server error returned after the request context
+// ended: either the deadline passed or the client went away. Client errors
+// are returned as they are.
+func contextError(ctx context.Context, err error, timeout time.Duration) error {
+	if status := errorStatus(err); status < http.StatusInternalServerError && status != apperrors.StatusClientClosedRequest {
+		return err
+	}
+	// A connection read deadline passing cancels the context as well, so
+	// go by the clock rather than by ctx.Err()
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return apperrors.Wrap(err, apperrors.CodeDeadlineExceeded, "request_deadline:"+timeout.String())
+	}
+	return apperrors.Wrap(err, apperrors.CodeClientClosed, "")
+}
+
+// bodyError maps an error reading the request body to an application
+// error
+func bodyError(err error) error {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		return apperrors.Newf(apperrors.CodePayloadTooLarge, "request_body_too_large:%d", maxErr.Limit)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return apperrors.Wrap(err, apperrors.CodeRequestTimeout, "request_body_timeout")
+	default:
+		return apperrors.Wrap(err, apperrors.CodeInvalidRequest, "request_body_malformed")
+	}
+}
@@ -0,0 +1,221 @@
+package actions
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+// limitsApp serves POST /echo, which binds its body, and GET /wait, which
+// runs handler, behind RequestLimits
+func limitsApp(limits RouteLimits, routes map[string]RouteLimits, handler buffalo.Handler) *buffalo.App {
+	a := newTestApp(RequestLimits(limits, routes))
+	a.POST("/echo", func(c buffalo.Context) error {
+		var req echoRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, r.JSON(req))
+	})
+	if handler != nil {
+		a.GET("/wait", handler)
+	}
+	return a
+}
+
+// waitForQuery stands in for a query run with models.DB.WithContext(c)
+func waitForQuery(c buffalo.Context) error {
+	<-c.Done()
+	return fmt.Errorf("query: %w", c.Err())
+}
+
+func TestRequestLimits_Deadline_Is_A_503(t *testing.T) {
+	a := limitsApp(RouteLimits{Timeout: 20 * time.Millisecond}, nil, waitForQuery)
+
+	start := time.Now()
+	res := serve(a, http.MethodGet, "/wait", nil)
+
+	assert.Less(t, time.Since(start), time.Second)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Contains(t, res.Body.String(), apperrors.CodeDeadlineExceeded)
+	assert.Contains(t, res.Body.String(), "20ms")
+}
+
+func TestRequestLimits_Route_Overrides(t *testing.T) {
+	a := limitsApp(RouteLimits{Timeout: time.Hour, MaxBody: 1 << 20},
+		map[string]RouteLimits{"GET /wait": {Timeout: 20 * time.Millisecond}}, waitForQuery)
+
+	res := serve(a, http.MethodGet, "/wait", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
+
+func TestRequestLimits_Body_Size(t *testing.T) {
+	body := `{"text":"` + strings.Repeat("x", 100) + `"}`
+
+	a := limitsApp(RouteLimits{MaxBody: 50}, nil, nil)
+	for _, chunked := range []bool{false, true} {
+		req := newRequest(http.MethodPost, "/echo", body)
+		if chunked {
+			req.ContentLength = -1
+		}
+		res := serveRequest(a, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code, "chunked: %v", chunked)
+		assert.Contains(t, res.Body.String(), apperrors.CodePayloadTooLarge)
+	}
+	short := newRequest(http.MethodPost, "/echo", `{"text":"short"}`)
+	short.ContentLength = -1
+	assert.Equal(t, http.StatusOK, serveRequest(a, short).Code)
+
+	a = limitsApp(RouteLimits{MaxBody: 50}, map[string]RouteLimits{"POST /echo": {MaxBody: 1 << 10}}, nil)
+	long := newRequest(http.MethodPost, "/echo", body)
+	long.ContentLength = -1
+	assert.Equal(t, http.StatusOK, serveRequest(a, long).Code)
+}
+
+func TestRequestLimits_Slow_Body_Is_A_408(t *testing.T) {
+	srv := httptest.NewServer(limitsApp(RouteLimits{Timeout: 100 * time.Millisecond, MaxBody: 1 << 10}, nil, nil))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Promise a body, then stall halfway through it
+	_, err = fmt.Fprint(conn, "POST /echo HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: 20\r\n\r\n{\"text\":")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusRequestTimeout, res.StatusCode)
+}
+
+// disconnect sends GET /wait to a server running a and hangs up once the
+// handler started; it returns the error the handler returned
+func disconnect(t *testing.T, handler func(c buffalo.Context) error) error {
+	t.Helper()
+	started, result := make(chan struct{}), make(chan error, 1)
+	a := limitsApp(RouteLimits{Timeout: time.Minute}, nil, func(c buffalo.Context) error {
+		close(started)
+		err := handler(c)
+		result <- err
+		return err
+	})
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/wait", nil)
+	require.NoError(t, err)
+	if res, err := http.DefaultClient.Do(req); err == nil {
+		res.Body.Close()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after the client disconnected")
+		return nil
+	}
+}
+
+func TestRequestLimits_Cancels_Handlers_When_The_Client_Disconnects(t *testing.T) {
+	err := disconnect(t, waitForQuery)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRequestLimits_Cancels_Slow_Queries_When_The_Client_Disconnects(t *testing.T) {
+	modelstest.DB(t)
+
+	start := time.Now()
+	err := disconnect(t, func(c buffalo.Context) error {
+		return models.DB.WithContext(c).RawQuery("SELECT pg_sleep(30)").Exec()
+	})
+	require.Error(t, err, "the query should have been cancelled")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestContextError(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := contextError(expired, errors.New("pq: canceling statement due to user request"), time.Second)
+	assert.Equal(t, apperrors.CodeDeadlineExceeded, apperrors.From(err).Code)
+
+	err = contextError(gone, context.Canceled, time.Second)
+	assert.Equal(t, apperrors.CodeClientClosed, apperrors.From(err).Code)
+	assert.Equal(t, apperrors.StatusClientClosedRequest, errorStatus(err))
+
+	invalid := apperrors.New(apperrors.CodeInvalidCredentials, "")
+	assert.Same(t, invalid, contextError(expired, invalid, time.Second))
+}
+
+func TestRequestLimitsFromEnv(t *testing.T) {
+	var (
+		limits RouteLimits
+		routes map[string]RouteLimits
+		err    error
+	)
+	envy.Temp(func() {
+		envy.Set("REQUEST_TIMEOUT", "10s")
+		envy.Set("REQUEST_MAX_BODY", "2MB")
+		envy.Set("REQUEST_LIMITS", "post /api/v1/imports/=2m,10MB; POST /auth/login=5s")
+		limits, routes, err = requestLimitsFromEnv()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, RouteLimits{Timeout: 10 * time.Second, MaxBody: 2 << 20}, limits)
+	assert.Equal(t, RouteLimits{Timeout: 2 * time.Minute, MaxBody: 10 << 20}, routes["POST /api/v1/imports"])
+	assert.Equal(t, RouteLimits{Timeout: 5 * time.Second, MaxBody: 64 << 10}, routes["POST /auth/login"], "merged with the built-in limits")
+	assert.Equal(t, routeLimits["GET /health/live"], routes["GET /health/live"])
+
+	for env, value := range map[string]string{
+		"REQUEST_TIMEOUT":  "soon",
+		"REQUEST_MAX_BODY": "big",
+		"REQUEST_LIMITS":   "POST /auth/login=fast",
+	} {
+		envy.Temp(func() {
+			envy.Set(env, value)
+			_, _, err = requestLimitsFromEnv()
+		})
+		assert.ErrorContains(t, err, env)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"512": 512, "512B": 512, "64KB": 64 << 10, "10 mb": 10 << 20, "1GB": 1 << 30} {
+		got, err := parseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "MB", "-1KB", "0", "1TB"} {
+		_, err := parseSize(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"context"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/pgnotify"
+)
+
+// maxListenBackoff bounds the wait between attempts to listen for changes
+// again
+const maxListenBackoff = 30 * time.Second
+
+// listenJob returns a hook calling refresh on start and whenever a replica
+// notifies channel on the database at url, so state shared through the
+// database is loaded before serving and kept current after
+func listenJob(name, url, channel string, refresh func(context.Context) error) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name:    name + ".listen",
+		OnStart: refresh,
+		Run: func(ctx context.Context) error {
+			listenForChanges(ctx, name, url, channel, refresh, time.Second)
+			return nil
+		},
+	}
+}
+
+// listenForChanges calls refresh on every notification on channel until
+// ctx is done. A lost connection is retried with backoff from wait; the
+// state stays as it was in the meantime.
+func listenForChanges(ctx context.Context, name, url, channel string, refresh func(context.Context) error, wait time.Duration) {
+	log := logging.For(name)
+	backoff := wait
+	for {
+		err := pgnotify.Listen(ctx, url, channel, func(payload string) {
+			backoff = wait
+			if err := refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("refreshing failed", "changed", payload, "error", err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("listening for changes failed", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxListenBackoff)
+	}
+}
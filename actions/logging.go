@@ -0,0 +1,179 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits which incoming request IDs are trusted so callers
+// cannot inject arbitrary content into logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware reuses a well-formed incoming X-Request-ID or
+// generates a new one, stores it as "request_id" in the context and
+// returns it in the response headers.
+func RequestIDMiddleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		assignRequestID(c)
+		return next(c)
+	}
+}
+
+// ensureRequestID returns the request ID of c, assigning one first if
+// RequestIDMiddleware has not run, as for router 404/405 errors
+func ensureRequestID(c buffalo.Context) string {
+	if id, ok := c.Value("request_id").(string); ok && id != "" {
+		return id
+	}
+	return assignRequestID(c)
+}
+
+func assignRequestID(c buffalo.Context) string {
+	id := c.Request().Header.Get(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = uuid.Must(uuid.NewV4()).String()
+	}
+
+	c.Set("request_id", id)
+	c.Response().Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// RequestLoggingMiddleware logs one structured record per request once the
+// response is written. It replaces buffalo's default request logger.
+func RequestLoggingMiddleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := http.StatusOK
+		size := 0
+		if res, ok := c.Response().(*buffalo.Response); ok {
+			if res.Status > 0 {
+				status = res.Status
+			}
+			size = res.Size
+		}
+		if err != nil {
+			status = errorStatus(err)
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		// buffalo's logger carries fields added with c.LogField, such as
+		// the request parameters
+		l := logging.For("http")
+		if bl, ok := c.Logger().(*logging.BuffaloLogger); ok {
+			l = bl.Slog()
+		}
+
+		req := c.Request()
+		withRequest(c, l).Log(c, level, "request completed",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", status),
+			slog.Int("size", size),
+			slog.Duration("duration", time.Since(start)),
+		)
+
+		return err
+	}
+}
+
+// maxLoggedBody bounds how much of a JSON request body is logged
+const maxLoggedBody = 4 << 10
+
+// ParameterLoggingMiddleware adds the request parameters, headers and JSON
+// body to the request log record. It replaces buffalo's paramlogger, whose
+// exclusion list misses snake_case keys such as "password_confirm"; values
+// are scrubbed by the logging redactor before they are written.
+func ParameterLoggingMiddleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := c.Request()
+		fields := map[string]interface{}{
+			"headers": req.Header,
+		}
+		if params, ok := c.Params().(url.Values); ok && len(params) > 0 {
+			fields["params"] = params
+		}
+		if body, ok := peekJSONBody(req); ok {
+			fields["body"] = body
+		}
+		c.LogFields(fields)
+
+		return next(c)
+	}
+}
+
+// peekJSONBody decodes a JSON request body for logging and restores it so
+// handlers can still read it
+func peekJSONBody(req *http.Request) (interface{}, bool) {
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return nil, false
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, maxLoggedBody+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+	if err != nil || len(buf) == 0 {
+		return nil, false
+	}
+
+	// A truncated document could leak secrets the redactor cannot parse
+	if len(buf) > maxLoggedBody {
+		return "[body too large to log]", true
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(buf, &body); err != nil {
+		return "[invalid json]", true
+	}
+	return body, true
+}
+
+// Log returns a logger for the current request. Records include the
+// request ID, trace ID, matched route and, once authenticated, the user ID.
+func Log(c buffalo.Context) *slog.Logger {
+	return withRequest(c, logging.For("actions"))
+}
+
+// withRequest adds the request scoped attributes to l
+func withRequest(c buffalo.Context, l *slog.Logger) *slog.Logger {
+	if id, ok := c.Value("request_id").(string); ok {
+		l = l.With("request_id", id)
+	}
+	if traceID := telemetry.TraceID(c); traceID != "" {
+		l = l.With("trace_id", traceID)
+	}
+	if ri, ok := c.Value("current_route").(buffalo.RouteInfo); ok {
+		l = l.With("route", ri.Path)
+	}
+	if userID, ok := c.Value("currentUserID").(uuid.UUID); ok {
+		l = l.With("user_id", userID.String())
+	}
+
+	return l
+}
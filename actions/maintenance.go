@@ -0,0 +1,144 @@
+package actions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/maintenance"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+)
+
+// maintenanceExempt lists paths served during maintenance, so probes keep
+// the pods in rotation and clients get the maintenance problem rather than
+// no answer at all
+var maintenanceExempt = map[string]bool{
+	"/health":       true,
+	"/health/live":  true,
+	"/health/ready": true,
+}
+
+// newMaintenanceStore returns the store selected by maintenance.store
+func newMaintenanceStore(cfg config.Maintenance) (maintenance.Store, error) {
+	switch cfg.Store {
+	case "memory":
+		return maintenance.NewMemoryStore(), nil
+	case "postgres":
+		return maintenance.NewPostgresStore(models.DB), nil
+	default:
+		return nil, fmt.Errorf("unknown maintenance store %q", cfg.Store)
+	}
+}
+
+// forcedMaintenance returns the state configured by cfg
+func forcedMaintenance(cfg config.Maintenance) maintenance.State {
+	return maintenance.State{
+		Mode:       maintenance.Mode(cfg.Mode),
+		Message:    cfg.Message,
+		RetryAfter: int(cfg.RetryAfter.Seconds()),
+	}
+}
+
+// Maintenance returns a middleware answering 503 with Retry-After to the
+// requests the state of sw blocks. Health probes, requests from allowed
+// networks and admins, looked up in users, are served as usual.
+func Maintenance(sw *maintenance.Switch, allowed []*net.IPNet, users models.UserRepository) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			state := sw.State()
+			if !state.Blocks(c.Request().Method) || maintenanceExempt[routePath(c.Request().URL.Path)] {
+				return next(c)
+			}
+			if allowedIP(allowed, clientIP(c.Request())) || maintenanceAdmin(c, users) {
+				return next(c)
+			}
+
+			if state.RetryAfter > 0 {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+			}
+			detail := state.Message
+			if detail == "" {
+				detail = "maintenance_" + string(state.Mode)
+			}
+			return apperrors.New(apperrors.CodeMaintenance, detail)
+		}
+	}
+}
+
+// allowedIP reports whether ip is in one of nets
+func allowedIP(nets []*net.IPNet, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceAdmin reports whether the request is made by an admin, as
+// AdminMiddleware would allow. It only authenticates requests that would
+// otherwise be turned away, so maintenance costs normal traffic no query.
+func maintenanceAdmin(c buffalo.Context, users models.UserRepository) bool {
+	if c.Request().Header.Get("Authorization") == "" {
+		return false
+	}
+	user, err := authenticate(c, users)
+	return err == nil && user.IsAdmin()
+}
+
+// MaintenanceRequest switches maintenance mode
+type MaintenanceRequest struct {
+	Mode    maintenance.Mode `json:"mode" validate:"required,oneof=off read_only offline"`
+	Message string           `json:"message,omitempty" validate:"max=500"`
+	// RetryAfter is in seconds; 0 uses maintenance.retry_after
+	RetryAfter int `json:"retry_after,omitempty" validate:"min=0,max=86400"`
+}
+
+// MaintenanceResponse is the maintenance state in effect
+type MaintenanceResponse struct {
+	maintenance.State
+	// Forced is set while configuration forces the state; changes made
+	// through the API apply once it no longer does
+	Forced bool `json:"forced"`
+}
+
+// maintenanceResponse returns the state of sw
+func maintenanceResponse(sw *maintenance.Switch) MaintenanceResponse {
+	return MaintenanceResponse{State: sw.State(), Forced: sw.Forced()}
+}
+
+// MaintenanceHandler returns the maintenance state
+// GET /api/v1/admin/maintenance
+func MaintenanceHandler(sw *maintenance.Switch) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, r.JSON(maintenanceResponse(sw)))
+	}
+}
+
+// UpdateMaintenanceHandler switches maintenance mode for every replica
+// PUT /api/v1/admin/maintenance
+func UpdateMaintenanceHandler(sw *maintenance.Switch) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := &MaintenanceRequest{}
+		if err := bind(c, req); err != nil {
+			return err
+		}
+		state := &maintenance.State{Mode: req.Mode, Message: req.Message, RetryAfter: req.RetryAfter}
+		if state.RetryAfter == 0 && state.Mode != maintenance.Off {
+			state.RetryAfter = int(config.Get().Maintenance.RetryAfter.Seconds())
+		}
+		if err := sw.Set(c, state); err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
+		Log(c).Info("maintenance mode changed", "mode", state.Mode)
+		return c.Render(http.StatusOK, r.JSON(maintenanceResponse(sw)))
+	}
+}
@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/maintenance"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maintenanceApp serves /things and /health/live behind the maintenance
+// switch sw, and the maintenance admin endpoints under /maintenance. Admins
+// are users of users.
+func maintenanceApp(sw *maintenance.Switch, users models.UserRepository, allowed ...*net.IPNet) *buffalo.App {
+	a := newTestApp(Maintenance(sw, allowed, users))
+	ok := func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, r.JSON(map[string]bool{"ok": true}))
+	}
+	a.GET("/things", ok)
+	a.POST("/things", ok)
+	a.GET("/health/live", ok)
+	a.GET("/maintenance", MaintenanceHandler(sw))
+	a.PUT("/maintenance", UpdateMaintenanceHandler(sw))
+	return a
+}
+
+func setMaintenance(t *testing.T, sw *maintenance.Switch, state maintenance.State) {
+	t.Helper()
+	require.NoError(t, sw.Set(context.Background(), &state))
+}
+
+func TestMaintenance_Offline(t *testing.T) {
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Off})
+	a := maintenanceApp(sw, models.NewMemoryUserRepository())
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodPost, "/things", `{}`).Code, "off")
+
+	setMaintenance(t, sw, maintenance.State{Mode: maintenance.Offline, RetryAfter: 120})
+	res := serve(a, http.MethodGet, "/things", nil)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "120", res.Header().Get("Retry-After"))
+	var p apperrors.Problem
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+	assert.Equal(t, apperrors.CodeMaintenance, p.Code)
+	assert.Equal(t, "The service is down for maintenance", p.Detail)
+
+	res = serve(a, http.MethodGet, "/things", nil, "Accept-Language", "es")
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+	assert.Equal(t, "El servicio está en mantenimiento", p.Detail)
+
+	setMaintenance(t, sw, maintenance.State{Mode: maintenance.Offline, Message: "Back at 10:00 UTC"})
+	res = serve(a, http.MethodPost, "/things", `{}`)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Empty(t, res.Header().Get("Retry-After"))
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+	assert.Equal(t, "Back at 10:00 UTC", p.Detail)
+
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodGet, "/health/live", nil).Code, "probes are served")
+}
+
+func TestMaintenance_Read_Only(t *testing.T) {
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.ReadOnly, RetryAfter: 60})
+	a := maintenanceApp(sw, models.NewMemoryUserRepository())
+
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodGet, "/things", nil).Code)
+	res := serve(a, http.MethodPost, "/things", `{}`)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "60", res.Header().Get("Retry-After"))
+	assert.Contains(t, res.Body.String(), "only accepts reads")
+}
+
+func TestMaintenance_Allowed_Networks(t *testing.T) {
+	_, office, err := net.ParseCIDR("203.0.113.0/24")
+	require.NoError(t, err)
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Offline})
+	a := maintenanceApp(sw, models.NewMemoryUserRepository(), office)
+
+	req := newRequest(http.MethodPost, "/things", `{}`)
+	req.RemoteAddr = "203.0.113.7:4321"
+	assert.Equal(t, http.StatusOK, serveRequest(a, req).Code)
+
+	req = newRequest(http.MethodPost, "/things", `{}`)
+	req.RemoteAddr = "198.51.100.7:4321"
+	assert.Equal(t, http.StatusServiceUnavailable, serveRequest(a, req).Code)
+}
+
+func TestMaintenance_Invalid_Token_Is_Turned_Away(t *testing.T) {
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Offline})
+	res := serve(maintenanceApp(sw, models.NewMemoryUserRepository()), http.MethodGet, "/things", nil, "Authorization", "Bearer not-a-token")
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Contains(t, res.Body.String(), string(apperrors.CodeMaintenance), "not an authentication error")
+}
+
+func TestMaintenance_Admin_Endpoints(t *testing.T) {
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Off})
+	a := maintenanceApp(sw, models.NewMemoryUserRepository(), &net.IPNet{IP: net.IPv4(198, 51, 100, 1), Mask: net.CIDRMask(32, 32)})
+	admin := func(method string, body any) *httptest.ResponseRecorder {
+		req := newRequest(method, "/maintenance", body)
+		req.RemoteAddr = "198.51.100.1:1234"
+		return serveRequest(a, req)
+	}
+
+	res := admin(http.MethodPut, `{"mode":"read_only","message":"Upgrading"}`)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	var state MaintenanceResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &state))
+	assert.Equal(t, maintenance.ReadOnly, state.Mode)
+	assert.Equal(t, 300, state.RetryAfter, "maintenance.retry_after by default")
+	assert.False(t, state.Forced)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(a, http.MethodPost, "/things", `{}`).Code, "applies at once")
+
+	res = admin(http.MethodPut, `{"mode":"closed"}`)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, res.Body.String(), string(apperrors.CodeValidationFailed))
+
+	res = admin(http.MethodPut, `{"mode":"off"}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	res = admin(http.MethodGet, nil)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &state))
+	assert.Equal(t, maintenance.Off, state.Mode)
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodPost, "/things", `{}`).Code)
+}
+
+func TestMaintenance_Forced_By_Configuration(t *testing.T) {
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Offline})
+	a := maintenanceApp(sw, models.NewMemoryUserRepository(), &net.IPNet{IP: net.IPv4(198, 51, 100, 1), Mask: net.CIDRMask(32, 32)})
+
+	req := newRequest(http.MethodPut, "/maintenance", `{"mode":"off"}`)
+	req.RemoteAddr = "198.51.100.1:1234"
+	res := serveRequest(a, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var state MaintenanceResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &state))
+	assert.Equal(t, maintenance.Offline, state.Mode)
+	assert.True(t, state.Forced)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(a, http.MethodGet, "/things", nil).Code)
+}
+
+func TestMaintenance_Serves_Admins(t *testing.T) {
+	users := models.NewMemoryUserRepository()
+	_, adminToken := signUp(t, users, &models.User{Name: "Admin User", Email: "admin@example.com", Role: models.RoleAdmin})
+	_, userToken := signUp(t, users, &models.User{Name: "Regular User", Email: "user@example.com", Role: models.RoleUser})
+	sw := maintenance.NewSwitch(maintenance.NewMemoryStore(), maintenance.State{Mode: maintenance.Offline})
+	a := maintenanceApp(sw, users)
+
+	res := serve(a, http.MethodPost, "/things", `{}`, "Authorization", "Bearer "+adminToken)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = serve(a, http.MethodPost, "/things", `{}`, "Authorization", "Bearer "+userToken)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code, "users are turned away")
+
+	res = serve(a, http.MethodPost, "/things", `{}`)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
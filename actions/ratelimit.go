@@ -0,0 +1,140 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lock"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/ratelimit"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+)
+
+// rateLimitExempt lists paths that are never rate limited, so probes keep
+// working while clients are throttled
+var rateLimitExempt = map[string]bool{
+	"/health":       true,
+	"/health/live":  true,
+	"/health/ready": true,
+}
+
+// RateLimitKey returns the identity a request is counted against
+type RateLimitKey func(c buffalo.Context) string
+
+// ByIP counts requests per client IP
+func ByIP(c buffalo.Context) string {
+	return "ip:" + clientIP(c.Request())
+}
+
+// ByUser counts requests per signed in user, set by AuthMiddleware, and
+// per IP before sign in. The API has no API keys: a key of its own for
+// service clients needs keys that are validated first, and must count
+// requests per validated key, never per raw header value.
+func ByUser(c buffalo.Context) string {
+	if id, ok := c.Value("currentUserID").(uuid.UUID); ok {
+		return "user:" + id.String()
+	}
+	return ByIP(c)
+}
+
+// clientIP returns the IP address of the client that sent r. Behind a
+// trusted proxy it is the address the nearest proxy appended to
+// X-Forwarded-For.
+func clientIP(r *http.Request) string {
+	if config.Get().RateLimit.TrustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newRateLimitStore returns the store named by cfg.Store: "memory", "redis",
+// which connects to cfg.RedisURL, or "postgres",
+// which uses models.DB and cleans up expired windows in the background.
+// Connections and cleanup jobs are registered with lifecycle.Default.
+func newRateLimitStore(cfg config.RateLimit) (ratelimit.Store, error) {
+	switch cfg.Store {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "redis":
+		store, err := ratelimit.NewRedisStore(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		lifecycle.Append(lifecycle.Hook{Name: "ratelimit.redis", OnStop: func(context.Context) error {
+			return store.Close()
+		}})
+		return store, nil
+	case "postgres":
+		locker, err := lock.NewPostgres(models.DB)
+		if err != nil {
+			return nil, err
+		}
+		store := ratelimit.NewPostgresStore(models.DB)
+		lifecycle.Append(cleanupJob("ratelimit", store, locker))
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.Store)
+	}
+}
+
+// RateLimit returns a middleware that allows limit requests per client in
+// the bucket group name, with clients told apart by key. Responses carry
+// RateLimit-* headers; rejected requests get a 429 problem with
+// Retry-After. The limiter fails open: when the store is down requests are
+// let through and a warning is logged.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key RateLimitKey) buffalo.MiddlewareFunc {
+	policy := fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds()))
+	if limit.Burst > 0 {
+		policy += fmt.Sprintf(";burst=%d", limit.Burst)
+	}
+
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			if rateLimitExempt[routePath(c.Request().URL.Path)] {
+				return next(c)
+			}
+
+			res, err := store.Take(c, name+":"+key(c), limit)
+			if err != nil {
+				Log(c).Warn("rate limiter unavailable, allowing request", "group", name, "error", err)
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set("RateLimit-Policy", policy)
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				retry := seconds(res.RetryAfter)
+				h.Set("Retry-After", retry)
+				return apperrors.Newf(apperrors.CodeRateLimited, "rate_limit_retry:%s", retry)
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, as rate limit headers require
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,115 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/ratelimit"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitApp serves /limited and /health behind a limiter allowing two
+// requests per minute
+func rateLimitApp(store ratelimit.Store, key RateLimitKey) *buffalo.App {
+	a := newTestApp(RateLimit(store, "test", ratelimit.PerMinute(2), key))
+	ok := func(c buffalo.Context) error { return c.Render(http.StatusOK, r.JSON(map[string]string{"ok": "yes"})) }
+	a.GET("/limited", ok)
+	a.GET("/health", ok)
+	return a
+}
+
+func TestRateLimit_Rejects_Over_Limit(t *testing.T) {
+	a := rateLimitApp(ratelimit.NewMemoryStore(), ByIP)
+
+	res := serve(a, http.MethodGet, "/limited", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2;w=60", res.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "2", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", res.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodGet, "/limited", nil).Code)
+
+	res = serve(a, http.MethodGet, "/limited", nil, "Accept-Language", "es-ES")
+	require.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+
+	problem := problemOf(t, res)
+	assert.Equal(t, apperrors.CodeRateLimited, problem.Code)
+	assert.Equal(t, "Demasiadas solicitudes", problem.Title)
+	assert.Contains(t, problem.Detail, "30")
+
+	other := newRequest(http.MethodGet, "/limited", nil)
+	other.RemoteAddr = "10.0.0.2:1234"
+	assert.Equal(t, http.StatusOK, serveRequest(a, other).Code, "other clients are not limited")
+}
+
+func TestRateLimit_Exempts_Health_Probes(t *testing.T) {
+	a := rateLimitApp(ratelimit.NewMemoryStore(), ByIP)
+	for i := 0; i < 5; i++ {
+		res := serve(a, http.MethodGet, "/health", nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Header().Get("RateLimit-Limit"))
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit_Fails_Open(t *testing.T) {
+	logs := captureLogs(t)
+	a := rateLimitApp(failingStore{}, ByIP)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(a, http.MethodGet, "/limited", nil).Code)
+	}
+	assert.Contains(t, logs.String(), "rate limiter unavailable")
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	var keys []string
+	userID := uuid.Must(uuid.NewV4())
+
+	a := newTestApp()
+	a.GET("/anonymous", func(c buffalo.Context) error {
+		keys = append(keys, ByIP(c), ByUser(c))
+		return c.Render(http.StatusOK, nil)
+	})
+	a.GET("/signed-in", func(c buffalo.Context) error {
+		c.Set("currentUserID", userID)
+		keys = append(keys, ByUser(c))
+		return c.Render(http.StatusOK, nil)
+	})
+
+	serve(a, http.MethodGet, "/anonymous", nil)
+	serve(a, http.MethodGet, "/signed-in", nil)
+	serve(a, http.MethodGet, "/signed-in", nil, "X-API-Key", "secret-key")
+
+	require.Len(t, keys, 4)
+	assert.Equal(t, []string{"ip:192.0.2.1", "ip:192.0.2.1"}, keys[:2])
+	assert.Equal(t, "user:"+userID.String(), keys[2])
+	assert.Equal(t, "user:"+userID.String(), keys[3], "API key headers do not get buckets of their own")
+}
+
+func TestClientIP_Trusts_Proxy_Only_When_Configured(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.9:443"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+
+	assert.Equal(t, "10.0.0.9", clientIP(req))
+
+	config.Get().RateLimit.TrustProxy = true
+	defer func() { config.Get().RateLimit.TrustProxy = false }()
+	assert.Equal(t, "203.0.113.7", clientIP(req), "the address added by the nearest proxy")
+}
@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/errorevents"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+)
+
+// recordTimeout bounds recording a panic, which must not hold up the
+// response for long
+const recordTimeout = 2 * time.Second
+
+// newErrorEventStore returns the store selected by ERROR_EVENTS_STORE,
+// "postgres" (the default) or "memory"
+func newErrorEventStore() (errorevents.Store, error) {
+	switch store := envy.Get("ERROR_EVENTS_STORE", "postgres"); store {
+	case "memory":
+		return errorevents.NewMemoryStore(), nil
+	case "postgres":
+		return errorevents.NewPostgresStore(models.DB).ReadFrom(readDB), nil
+	default:
+		return nil, fmt.Errorf("unknown ERROR_EVENTS_STORE %q", store)
+	}
+}
+
+// Recovery returns a middleware that turns a panic in the middleware and
+// handlers after it into a 500 problem carrying nothing about the panic
+// but the request ID. The panic is logged with its stack and recorded in
+// store, grouped with the panics of the same fingerprint.
+func Recovery(store errorevents.Store) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) (err error) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				occ := errorevents.Capture(v)
+				occ.RequestID = ensureRequestID(c)
+				occ.Route = c.Request().Method + " " + routePath(c.Request().URL.Path)
+				if ri, ok := c.Value("current_route").(buffalo.RouteInfo); ok {
+					occ.Route = ri.Method + " " + routePath(ri.Path)
+				}
+				Log(c).Error("panic recovered",
+					"fingerprint", occ.Fingerprint, "panic", occ.Message, "stack", occ.Stack)
+
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(c), recordTimeout)
+				defer cancel()
+				if rerr := store.Record(ctx, occ); rerr != nil {
+					Log(c).Warn("recording panic failed", "fingerprint", occ.Fingerprint, "error", rerr)
+				}
+
+				err = apperrors.Wrap(fmt.Errorf("panic %s: %s", occ.Fingerprint, occ.Message), apperrors.CodeInternal, "")
+			}()
+			return next(c)
+		}
+	}
+}
+
+// ErrorEventsResponse lists recorded panics
+type ErrorEventsResponse struct {
+	Events []errorevents.Event `json:"events"`
+}
+
+// defaultErrorEventsLimit is the number of events listed unless the limit
+// parameter asks otherwise
+const defaultErrorEventsLimit = 50
+
+// ErrorEventsHandler lists the panics recorded in store, the most recently
+// seen first
+// GET /api/v1/admin/errors
+func ErrorEventsHandler(store errorevents.Store) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		limit := defaultErrorEventsLimit
+		// The contract validates the parameter
+		if n, err := strconv.Atoi(c.Param("limit")); err == nil {
+			limit = n
+		}
+		events, err := store.List(c, limit)
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
+		return c.Render(http.StatusOK, r.JSON(ErrorEventsResponse{Events: events}))
+	}
+}
+
+// ErrorEventHandler returns one recorded panic with its latest stack
+// GET /api/v1/admin/errors/{fingerprint}
+func ErrorEventHandler(store errorevents.Store) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		event, err := store.Get(c, c.Param("fingerprint"))
+		if errors.Is(err, errorevents.ErrNotFound) {
+			return apperrors.Wrap(err, apperrors.CodeNotFound, "")
+		}
+		if err != nil {
+			return apperrors.Wrap(err, apperrors.CodeInternal, "")
+		}
+		return c.Render(http.StatusOK, r.JSON(event))
+	}
+}
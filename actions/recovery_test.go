@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/errorevents"
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recoveryApp panics on /crash/{n} and lists recorded panics under
+// /errors, without authentication
+func recoveryApp(store errorevents.Store) *buffalo.App {
+	a := newTestApp(Recovery(store))
+	a.GET("/crash/{n}", func(c buffalo.Context) error {
+		var m map[string]int
+		m["n"+c.Param("n")] = 1
+		return nil
+	})
+	a.GET("/errors", ErrorEventsHandler(store))
+	a.GET("/errors/{fingerprint}", ErrorEventHandler(store))
+	return a
+}
+
+func TestRecovery_Answers_With_The_Request_ID_Only(t *testing.T) {
+	store := errorevents.NewMemoryStore()
+	a := recoveryApp(store)
+
+	res := serve(a, http.MethodGet, "/crash/1", nil, RequestIDHeader, "req-1")
+
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, apperrors.ContentType, res.Header().Get("Content-Type"))
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &problem))
+	assert.Equal(t, "req-1", problem["request_id"])
+	assert.Equal(t, string(apperrors.CodeInternal), problem["code"])
+	assert.NotContains(t, problem, "detail")
+	assert.NotContains(t, res.Body.String(), "map", "nothing about the panic leaks")
+}
+
+func TestRecovery_Groups_Panics_By_Fingerprint(t *testing.T) {
+	store := errorevents.NewMemoryStore()
+	a := recoveryApp(store)
+	for _, path := range []string{"/crash/1", "/crash/2", "/crash/3"} {
+		res := serve(a, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusInternalServerError, res.Code)
+	}
+
+	events, err := store.List(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(3), events[0].Count)
+	assert.Equal(t, "GET /crash/{n}", events[0].Route)
+	assert.Contains(t, events[0].Message, "nil map")
+	assert.NotEmpty(t, events[0].LastRequestID)
+	assert.True(t, events[0].FirstSeen.Before(events[0].LastSeen))
+
+	res := serve(a, http.MethodGet, "/errors", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	var list ErrorEventsResponse
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &list))
+	require.Len(t, list.Events, 1)
+
+	res = serve(a, http.MethodGet, "/errors/"+events[0].Fingerprint, nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	var event errorevents.Event
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &event))
+	assert.Contains(t, event.Stack, "goroutine")
+
+	res = serve(a, http.MethodGet, "/errors/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
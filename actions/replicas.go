@@ -0,0 +1,144 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// PrimaryCookie carries the time of the last write of a client, so its
+// reads go to the primary on whichever instance serves them next
+const PrimaryCookie = "primary_after_write"
+
+// ReadReplicas returns a middleware choosing the connection readDB returns
+// for the request: a read replica of set for safe requests, and the
+// primary for writes. Clients read from the primary for pinFor after a
+// write so they see it even before the replicas replay it: successful
+// writes answer with a PrimaryCookie that later requests send back.
+// Clients that drop cookies may not read their own writes.
+func ReadReplicas(set *models.ReplicaSet, pinFor time.Duration) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			now := time.Now()
+			switch {
+			case unsafeMethod(c.Request().Method):
+				c.Set("readDB", set.Primary())
+				res, ok := c.Response().(*buffalo.Response)
+				if !ok {
+					break
+				}
+				// Rejected writes, rendered by the error handler or with a
+				// 4xx, do not pin
+				pw := &pinWriter{ResponseWriter: res.ResponseWriter, cookie: primaryCookie(now, pinFor)}
+				res.ResponseWriter = pw
+				defer func() { res.ResponseWriter = pw.ResponseWriter }()
+			case pinnedToPrimary(c.Request(), now, pinFor):
+				c.Set("readDB", set.Primary())
+			default:
+				c.Set("readDB", set.Reader())
+			}
+			return next(c)
+		}
+	}
+}
+
+// pinWriter sets cookie on successful responses
+type pinWriter struct {
+	http.ResponseWriter
+	cookie      *http.Cookie
+	wroteHeader bool
+}
+
+func (w *pinWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status >= http.StatusOK && status < http.StatusMultipleChoices {
+			http.SetCookie(w.ResponseWriter, w.cookie)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *pinWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *pinWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// primaryCookie returns the cookie recording a write at wrote, kept by
+// clients for pinFor
+func primaryCookie(wrote time.Time, pinFor time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     PrimaryCookie,
+		Value:    strconv.FormatInt(wrote.UnixMilli(), 10),
+		Path:     "/",
+		MaxAge:   int((pinFor + time.Second - 1) / time.Second),
+		Secure:   ENV == "production",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// pinnedToPrimary reports whether req carries a PrimaryCookie of a write
+// within pinFor of now. Writes dated ahead of now, by clock skew between
+// instances or by the client, pin for pinFor at most.
+func pinnedToPrimary(req *http.Request, now time.Time, pinFor time.Duration) bool {
+	cookie, err := req.Cookie(PrimaryCookie)
+	if err != nil {
+		return false
+	}
+	ms, err := strconv.ParseInt(cookie.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.UnixMilli(ms))
+	return age > -pinFor && age < pinFor
+}
+
+// readDB returns the connection for read-only queries of the request of
+// ctx, bound to ctx, or models.DB outside ReadReplicas
+func readDB(ctx context.Context) *pop.Connection {
+	if conn, ok := ctx.Value("readDB").(*pop.Connection); ok {
+		return conn.WithContext(ctx)
+	}
+	return models.DB.WithContext(ctx)
+}
+
+// replicasCheckJob returns a hook checking the replicas of set before
+// serving and every interval after, so lagging or failed replicas stop
+// serving reads until they recover
+func replicasCheckJob(set *models.ReplicaSet, interval time.Duration) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "replicas.check",
+		OnStart: func(ctx context.Context) error {
+			set.Check(ctx)
+			return nil
+		},
+		Run: func(ctx context.Context) error {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+				check, cancel := context.WithTimeout(ctx, interval)
+				set.Check(check)
+				cancel()
+			}
+		},
+	}
+}
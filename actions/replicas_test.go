@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedToPrimary(t *testing.T) {
+	now := time.Now()
+	withCookie := func(c *http.Cookie) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(c)
+		return req
+	}
+	assert.False(t, pinnedToPrimary(httptest.NewRequest(http.MethodGet, "/", nil), now, time.Second))
+
+	cookie := primaryCookie(now, 1500*time.Millisecond)
+	assert.Equal(t, 2, cookie.MaxAge, "rounded up to whole seconds")
+	assert.True(t, pinnedToPrimary(withCookie(cookie), now.Add(1499*time.Millisecond), 1500*time.Millisecond))
+	assert.False(t, pinnedToPrimary(withCookie(cookie), now.Add(1500*time.Millisecond), 1500*time.Millisecond), "pins expire")
+
+	ahead := primaryCookie(now.Add(time.Hour), time.Second)
+	assert.False(t, pinnedToPrimary(withCookie(ahead), now, time.Second), "writes in the future do not pin for longer")
+	bogus := &http.Cookie{Name: PrimaryCookie, Value: "yesterday"}
+	assert.False(t, pinnedToPrimary(withCookie(bogus), now, time.Second))
+}
+
+func TestReadReplicas_Pins_Successful_Writes(t *testing.T) {
+	primary, err := pop.NewConnection(&pop.ConnectionDetails{Dialect: "postgres", URL: "postgres://primary.internal/app"})
+	require.NoError(t, err)
+	a := newTestApp(ReadReplicas(models.NewReplicaSet(primary, nil, time.Second), time.Minute))
+	a.POST("/created", func(c buffalo.Context) error {
+		return c.Render(http.StatusCreated, r.String("ok"))
+	})
+	a.POST("/rejected", func(c buffalo.Context) error {
+		return c.Render(http.StatusConflict, r.String("taken"))
+	})
+	a.POST("/failed", func(c buffalo.Context) error {
+		return apperrors.New(apperrors.CodeRateLimited, "")
+	})
+
+	for path, pins := range map[string]bool{"/created": true, "/rejected": false, "/failed": false} {
+		cookies := serve(a, http.MethodPost, path, nil).Result().Cookies()
+		if pins {
+			require.Len(t, cookies, 1, path)
+			assert.Equal(t, PrimaryCookie, cookies[0].Name)
+		} else {
+			assert.Empty(t, cookies, path)
+		}
+	}
+}
+
+func TestReadDB_Defaults_To_The_Primary(t *testing.T) {
+	require.NoError(t, modelstest.Open())
+	assert.Same(t, models.DB.Dialect, readDB(context.Background()).Dialect)
+}
+
+func TestReadReplicas_Routes_Reads(t *testing.T) {
+	primary := modelstest.DB(t)
+	// A second connection to the database stands in for a replica: a
+	// server not in recovery never lags
+	replica, err := pop.NewConnection(&pop.ConnectionDetails{URL: primary.URL()})
+	require.NoError(t, err)
+	require.NoError(t, replica.Open())
+	defer replica.Close()
+	set := models.NewReplicaSet(primary, []*pop.Connection{replica}, time.Second)
+	set.Check(context.Background())
+
+	a := newTestApp(ReadReplicas(set, time.Minute))
+	handler := func(c buffalo.Context) error {
+		if readDB(c).Dialect == replica.Dialect {
+			return c.Render(http.StatusOK, r.String("replica"))
+		}
+		return c.Render(http.StatusOK, r.String("primary"))
+	}
+	a.GET("/read", handler)
+	a.POST("/write", handler)
+
+	assert.Equal(t, "replica", serve(a, http.MethodGet, "/read", nil).Body.String())
+	wrote := serve(a, http.MethodPost, "/write", nil)
+	assert.Equal(t, "primary", wrote.Body.String())
+	cookies := wrote.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, PrimaryCookie, cookies[0].Name)
+	pinned := cookies[0].Name + "=" + cookies[0].Value
+	assert.Equal(t, "primary", serve(a, http.MethodGet, "/read", nil, "Cookie", pinned).Body.String(), "reads follow the client's writes")
+	assert.Equal(t, "replica", serve(a, http.MethodGet, "/read", nil).Body.String(), "other clients still read from replicas")
+}
@@ -0,0 +1,126 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/openapi"
+	"github.com/rs/cors"
+	"github.com/unrolled/secure"
+)
+
+// SecurityOptions configures SecurityHeaders
+type SecurityOptions struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, sent on
+	// HTTPS responses only; 0 disables it
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ContentSecurityPolicy applies to routes without their own policy in
+	// RoutePolicies, keyed by "METHOD /path"
+	ContentSecurityPolicy string
+	RoutePolicies         map[string]string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	// FrameOptions is the X-Frame-Options value, DENY or SAMEORIGIN
+	FrameOptions string
+}
+
+// securityOptions returns the options of cfg. /docs gets the policy
+// Swagger UI needs.
+func securityOptions(cfg config.Security) (SecurityOptions, error) {
+	docs, err := openapi.ExplorerPolicy("/openapi.json")
+	if err != nil {
+		return SecurityOptions{}, err
+	}
+	return SecurityOptions{
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		HSTSPreload:           cfg.HSTSPreload,
+		ContentSecurityPolicy: cfg.CSP,
+		RoutePolicies:         map[string]string{"GET /docs": docs},
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+		FrameOptions:          strings.ToUpper(cfg.FrameOptions),
+	}, nil
+}
+
+// SecurityHeaders returns a middleware setting HSTS, Content-Security-Policy,
+// X-Content-Type-Options, Referrer-Policy, Permissions-Policy and
+// X-Frame-Options on every response, error and not found pages included.
+// HTTPS is recognised from TLS or X-Forwarded-Proto.
+func SecurityHeaders(opts SecurityOptions) func(http.Handler) http.Handler {
+	newSecure := func(csp string) *secure.Secure {
+		return secure.New(secure.Options{
+			STSSeconds:              int64(opts.HSTSMaxAge.Seconds()),
+			STSIncludeSubdomains:    opts.HSTSIncludeSubdomains,
+			STSPreload:              opts.HSTSPreload,
+			ContentTypeNosniff:      true,
+			ContentSecurityPolicy:   csp,
+			ReferrerPolicy:          opts.ReferrerPolicy,
+			PermissionsPolicy:       opts.PermissionsPolicy,
+			CustomFrameOptionsValue: opts.FrameOptions,
+			SSLProxyHeaders:         map[string]string{"X-Forwarded-Proto": "https"},
+		})
+	}
+	fallback := newSecure(opts.ContentSecurityPolicy)
+	routes := map[string]*secure.Secure{}
+	for route, csp := range opts.RoutePolicies {
+		routes[route] = newSecure(csp)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, ok := routes[r.Method+" "+routePath(r.URL.Path)]
+			if !ok {
+				s = fallback
+			}
+			// Process fails, having answered, on disallowed hosts only
+			if err := s.Process(w, r); err != nil {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsAllowedHeaders are the request headers clients of the API send
+var corsAllowedHeaders = []string{
+	"Accept", "Accept-Language", "Authorization", "Content-Type",
+	"If-Match", "If-None-Match", "If-Modified-Since",
+	IdempotencyKeyHeader, RequestIDHeader, "traceparent", "tracestate",
+}
+
+// corsExposedHeaders are the response headers browsers let clients read,
+// besides the CORS-safelisted ones
+var corsExposedHeaders = []string{
+	RequestIDHeader, "ETag", "Location", "Retry-After", "Idempotent-Replayed",
+	"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+}
+
+// corsOptions returns the options of cfg for the API. Origins may stand
+// for subdomains, as in "https://*.example.com"; without any, no origin is
+// allowed.
+func corsOptions(cfg config.CORS) cors.Options {
+	opts := cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+		AllowedHeaders:   corsAllowedHeaders,
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           int(cfg.MaxAge.Seconds()),
+	}
+	if len(opts.AllowedOrigins) == 0 {
+		// cors allows every origin when given none
+		opts.AllowOriginFunc = func(string) bool { return false }
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		opts.ExposedHeaders = cfg.ExposedHeaders
+	}
+	return opts
+}
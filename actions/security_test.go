@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/rs/cors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	opts, err := securityOptions(config.Defaults("test").Security)
+	require.NoError(t, err)
+	opts.HSTSMaxAge = 24 * time.Hour
+	h := SecurityHeaders(opts)(http.NotFoundHandler())
+
+	res := serve(h, http.MethodGet, "/missing", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "nosniff", res.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", res.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", res.Header().Get("Referrer-Policy"))
+	assert.Contains(t, res.Header().Get("Permissions-Policy"), "camera=()")
+	assert.Equal(t, config.Defaults("test").Security.CSP, res.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, res.Header().Get("Strict-Transport-Security"), "HSTS needs HTTPS")
+
+	res = serve(h, http.MethodGet, "/missing", nil, "X-Forwarded-Proto", "https")
+	assert.Equal(t, "max-age=86400; includeSubDomains", res.Header().Get("Strict-Transport-Security"))
+
+	docs := serve(h, http.MethodGet, "/docs", nil).Header().Get("Content-Security-Policy")
+	assert.Contains(t, docs, "script-src https://unpkg.com 'sha256-")
+	assert.Contains(t, docs, "frame-ancestors 'none'")
+}
+
+func TestApp_Sets_Security_Headers(t *testing.T) {
+	res := serve(App(), http.MethodGet, "/openapi.json", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "nosniff", res.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, config.Defaults("test").Security.CSP, res.Header().Get("Content-Security-Policy"))
+
+	res = serve(App(), http.MethodGet, "/docs", nil)
+	assert.Contains(t, res.Header().Get("Content-Security-Policy"), "https://unpkg.com")
+}
+
+func TestSecurityOptions(t *testing.T) {
+	cfg := config.Defaults("production").Security
+	cfg.HSTSPreload = true
+	cfg.FrameOptions = "sameorigin"
+	opts, err := securityOptions(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 365*24*time.Hour, opts.HSTSMaxAge, "HSTS is on in production")
+	assert.True(t, opts.HSTSPreload)
+	assert.Equal(t, "SAMEORIGIN", opts.FrameOptions)
+	assert.Contains(t, opts.RoutePolicies, "GET /docs")
+
+	opts, err = securityOptions(config.Defaults("development").Security)
+	require.NoError(t, err)
+	assert.Zero(t, opts.HSTSMaxAge, "and off elsewhere")
+}
+
+// preflight sends a CORS preflight from origin through a handler
+// configured by cfg
+func preflight(cfg config.CORS, origin string) *httptest.ResponseRecorder {
+	return serve(cors.New(corsOptions(cfg)).Handler(http.NotFoundHandler()), http.MethodOptions, "/api/v1/profile", nil,
+		"Origin", origin,
+		"Access-Control-Request-Method", http.MethodPost,
+		"Access-Control-Request-Headers", "authorization, idempotency-key",
+	)
+}
+
+func TestCORS(t *testing.T) {
+	origins := config.CORS{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowCredentials: true,
+		MaxAge:           2 * time.Hour,
+	}
+
+	res := preflight(origins, "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", res.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "7200", res.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "authorization, idempotency-key", res.Header().Get("Access-Control-Allow-Headers"))
+
+	res = preflight(origins, "https://admin.example.org")
+	assert.Equal(t, "https://admin.example.org", res.Header().Get("Access-Control-Allow-Origin"), "wildcard subdomains")
+
+	for _, origin := range []string{"https://evil.example.com", "https://example.org", "http://app.example.com"} {
+		res = preflight(origins, origin)
+		assert.Empty(t, res.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	res = preflight(config.Defaults("production").CORS, "https://app.example.com")
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Origin"), "no origin is allowed by default in production")
+}
+
+func TestCORS_Exposes_API_Headers(t *testing.T) {
+	h := cors.New(corsOptions(config.Defaults("test").CORS)).Handler(http.NotFoundHandler())
+	res := serve(h, http.MethodGet, "/", nil, "Origin", "https://app.example.com")
+
+	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"), "any origin outside production")
+	exposed := strings.Split(res.Header().Get("Access-Control-Expose-Headers"), ", ")
+	for _, name := range []string{RequestIDHeader, "Retry-After", "RateLimit-Remaining", "ETag"} {
+		assert.Contains(t, exposed, http.CanonicalHeaderKey(name))
+	}
+}
@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
+	"github.com/gobuffalo/buffalo"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestContext is a buffalo.Context whose context.Context part has been
+// replaced, so values such as the active span travel with the context that
+// handlers pass on to models.DB and other libraries.
+type requestContext struct {
+	buffalo.Context
+	ctx context.Context
+}
+
+func (c requestContext) Value(key interface{}) interface{} { return c.ctx.Value(key) }
+func (c requestContext) Deadline() (time.Time, bool)       { return c.ctx.Deadline() }
+func (c requestContext) Done() <-chan struct{}             { return c.ctx.Done() }
+func (c requestContext) Err() error                        { return c.ctx.Err() }
+
+// withContext returns c with ctx as its underlying context. ctx must be
+// derived from c so buffalo's own context values stay reachable. The
+// request is updated as well for code that reads c.Request().Context().
+func withContext(c buffalo.Context, ctx context.Context) buffalo.Context {
+	*c.Request() = *c.Request().WithContext(ctx)
+	return requestContext{Context: c, ctx: ctx}
+}
+
+// TracingMiddleware starts a server span for every request, continuing the
+// trace from an incoming W3C `traceparent` header. The span is named after
+// the matched route (e.g. "GET /auth/login") and the trace context is
+// echoed back in the response headers.
+func TracingMiddleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		req := c.Request()
+		route := req.URL.Path
+		if ri, ok := c.Value("current_route").(buffalo.RouteInfo); ok {
+			route = ri.Path
+		}
+
+		ctx := telemetry.Extract(c, req.Header)
+		ctx, span := telemetry.Tracer().Start(ctx, fmt.Sprintf("%s %s", req.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+				semconv.UserAgentOriginal(req.UserAgent()),
+				semconv.ClientAddress(req.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		telemetry.Inject(ctx, c.Response().Header())
+
+		err := next(withContext(c, ctx))
+
+		status := http.StatusOK
+		if res, ok := c.Response().(*buffalo.Response); ok && res.Status > 0 {
+			status = res.Status
+		}
+		if err != nil {
+			status = errorStatus(err)
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,60 @@
+package actions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(previous)
+
+	var handlerSpan trace.SpanContext
+	a := buffalo.New(buffalo.Options{})
+	a.Use(TracingMiddleware)
+	a.GET("/widgets/{id}", func(c buffalo.Context) error {
+		handlerSpan = trace.SpanContextFromContext(c)
+		return c.Render(http.StatusTeapot, r.String("ok"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	res := httptest.NewRecorder()
+	a.ServeHTTP(res, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+
+	assert.Equal(t, "GET /widgets/{id}/", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+	// The handler context carries the server span
+	assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+
+	// The trace context is echoed back to the caller
+	assert.Contains(t, res.Header().Get("traceparent"), span.SpanContext().TraceID().String())
+
+	var status int64
+	for _, attr := range span.Attributes() {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	assert.Equal(t, int64(http.StatusTeapot), status)
+}
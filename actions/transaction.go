@@ -0,0 +1,118 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Transaction returns a middleware running the request in a transaction
+// of db, which handlers get from writeDB or c.Value("tx"). It commits when
+// the handler answers 2xx or 3xx and rolls back on errors and other
+// statuses. The response is held back until the commit, so clients never
+// see a success that was not saved. Routes opt in one by one:
+//
+//	app.POST("/register", Transaction(models.DB)(RegisterHandler(users)))
+func Transaction(db *pop.Connection) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			tx, err := db.NewTransactionContext(c)
+			if err != nil {
+				return apperrors.Wrap(err, apperrors.CodeInternal, "")
+			}
+			committed := false
+			defer func() {
+				// The driver already rolled back the transactions of
+				// cancelled requests
+				if !committed {
+					if err := tx.TX.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+						Log(c).Warn("could not roll back transaction", "error", err)
+					}
+				}
+			}()
+			c.Set("tx", tx)
+
+			res, ok := c.Response().(*buffalo.Response)
+			if !ok {
+				if err := next(c); err != nil {
+					return err
+				}
+				committed = true
+				return tx.TX.Commit()
+			}
+			held := &heldWriter{ResponseWriter: res.ResponseWriter}
+			res.ResponseWriter = held
+			returned := false
+			defer func() {
+				// When next panics, Recovery further up answers on the
+				// real writer, as if the handler had not written anything
+				res.ResponseWriter = held.ResponseWriter
+				if !returned {
+					res.Status, res.Size = 0, 0
+				}
+			}()
+			err = next(c)
+			returned = true
+			status := res.Status
+			if err == nil && status < http.StatusBadRequest {
+				committed = true
+				err = tx.TX.Commit()
+				if err != nil {
+					err = apperrors.Wrap(err, apperrors.CodeInternal, "")
+				}
+			}
+			if err != nil {
+				// Nothing was sent yet, so errors are answered as if the
+				// handler had not written anything
+				res.Status, res.Size = 0, 0
+				return err
+			}
+			return held.release()
+		}
+	}
+}
+
+// writeDB returns the transaction of the request of ctx, or models.DB
+// bound to ctx outside Transaction
+func writeDB(ctx context.Context) *pop.Connection {
+	if tx, ok := ctx.Value("tx").(*pop.Connection); ok {
+		return tx
+	}
+	return models.DB.WithContext(ctx)
+}
+
+// heldWriter holds a response back until release
+type heldWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *heldWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *heldWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// release sends the held response
+func (w *heldWriter) release() error {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
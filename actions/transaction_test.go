@@ -0,0 +1,195 @@
+package actions
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/errorevents"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDB_Defaults_To_The_Primary(t *testing.T) {
+	require.NoError(t, modelstest.Open())
+	a := newTestApp()
+	a.GET("/", func(c buffalo.Context) error {
+		assert.Same(t, models.DB.Dialect, writeDB(c).Dialect)
+		assert.Nil(t, writeDB(c).TX, "outside Transaction")
+		return c.Render(http.StatusOK, r.String("ok"))
+	})
+	assert.Equal(t, http.StatusOK, serve(a, http.MethodGet, "/", nil).Code)
+}
+
+// fakeDriver is a database/sql driver whose transactions only record how
+// they ended, so Transaction can be tested without a database
+type fakeDriver struct {
+	mu        sync.Mutex
+	ended     []string
+	commitErr error
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+// end records how a transaction ended and returns the error it fails with
+func (d *fakeDriver) end(how string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ended = append(d.ended, how)
+	if how == "commit" {
+		return d.commitErr
+	}
+	return nil
+}
+
+// last returns how the last transaction ended and forgets it
+func (d *fakeDriver) last() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.ended) == 0 {
+		return ""
+	}
+	how := d.ended[len(d.ended)-1]
+	d.ended = nil
+	return how
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx(c), nil }
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error   { return tx.d.end("commit") }
+func (tx fakeTx) Rollback() error { return tx.d.end("rollback") }
+
+var fakeDB = &fakeDriver{}
+
+func init() {
+	sql.Register("fake", fakeDB)
+}
+
+func TestTransaction_Ends_With_The_Response(t *testing.T) {
+	db, err := pop.NewConnection(&pop.ConnectionDetails{Dialect: "postgres", Driver: "fake", URL: "postgres://fake@localhost/fake"})
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	defer db.Close()
+
+	a := newTestApp(Recovery(errorevents.NewMemoryStore()))
+	inTransaction := Transaction(db)
+	a.POST("/created", inTransaction(func(c buffalo.Context) error {
+		assert.NotNil(t, writeDB(c).TX, "handlers write in the transaction")
+		return c.Render(http.StatusCreated, r.String("saved"))
+	}))
+	a.POST("/conflict", inTransaction(func(c buffalo.Context) error {
+		return c.Render(http.StatusConflict, r.String("taken"))
+	}))
+	a.POST("/fail", inTransaction(func(c buffalo.Context) error {
+		if err := c.Render(http.StatusCreated, r.String("saved")); err != nil {
+			return err
+		}
+		return apperrors.New(apperrors.CodeInternal, "")
+	}))
+	a.POST("/panic", inTransaction(func(c buffalo.Context) error {
+		if err := c.Render(http.StatusCreated, r.String("saved")); err != nil {
+			return err
+		}
+		panic("boom")
+	}))
+	res := serve(a, http.MethodPost, "/created", nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "saved", res.Body.String())
+	assert.Equal(t, "commit", fakeDB.last(), "2xx commits")
+
+	res = serve(a, http.MethodPost, "/conflict", nil)
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "taken", res.Body.String())
+	assert.Equal(t, "rollback", fakeDB.last(), "4xx rolls back")
+
+	res = serve(a, http.MethodPost, "/fail", nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NotContains(t, res.Body.String(), "saved", "the held back success is dropped")
+	assert.Equal(t, "rollback", fakeDB.last(), "errors roll back")
+
+	res = serve(a, http.MethodPost, "/panic", nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code, "Recovery answers on the real writer")
+	assert.Contains(t, res.Body.String(), apperrors.CodeInternal)
+	assert.NotContains(t, res.Body.String(), "saved")
+	assert.Equal(t, "rollback", fakeDB.last(), "panics roll back")
+
+	fakeDB.commitErr = errors.New("connection reset")
+	defer func() { fakeDB.commitErr = nil }()
+	res = serve(a, http.MethodPost, "/created", nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NotContains(t, res.Body.String(), "saved", "nothing held back is sent when the commit fails")
+	assert.Equal(t, "commit", fakeDB.last())
+}
+
+func TestTransaction(t *testing.T) {
+	db := modelstest.DB(t)
+	t.Cleanup(func() {
+		db.RawQuery("DELETE FROM users WHERE email LIKE ?", "%@transaction.test").Exec()
+	})
+
+	a := newTestApp()
+	inTransaction := Transaction(db)
+	users := models.NewPostgresUserRepository(db).WriteTo(writeDB)
+	a.POST("/register", inTransaction(RegisterHandler(users)))
+	// registers, then fails as a later step would
+	a.POST("/fail", inTransaction(func(c buffalo.Context) error {
+		if err := RegisterHandler(users)(c); err != nil {
+			return err
+		}
+		return apperrors.New(apperrors.CodeInternal, "")
+	}))
+	// creates the user, then answers with a client error
+	a.POST("/conflict", inTransaction(func(c buffalo.Context) error {
+		var req RegisterRequest
+		if err := bind(c, &req); err != nil {
+			return err
+		}
+		user := &models.User{Name: req.Name, Email: req.Email, Password: req.Password, Role: models.RoleUser}
+		if _, err := users.Create(c, user); err != nil {
+			return err
+		}
+		return c.Render(http.StatusConflict, r.JSON(user))
+	}))
+
+	register := func(path, email string) *httptest.ResponseRecorder {
+		return serve(a, http.MethodPost, path, RegisterRequest{
+			Name:            "Tx",
+			Email:           email,
+			Password:        "password123",
+			PasswordConfirm: "password123",
+		})
+	}
+	exists := func(email string) bool {
+		ok, err := db.Where("email = ?", email).Exists(&models.User{})
+		require.NoError(t, err)
+		return ok
+	}
+
+	res := register("/register", "ok@transaction.test")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.True(t, exists("ok@transaction.test"), "2xx commits")
+
+	res = register("/fail", "fail@transaction.test")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NotContains(t, res.Body.String(), "token", "the held back success is dropped")
+	assert.False(t, exists("fail@transaction.test"), "errors roll back")
+
+	res = register("/conflict", "conflict@transaction.test")
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.False(t, exists("conflict@transaction.test"), "4xx rolls back")
+}
@@ -0,0 +1,218 @@
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Code is a stable, machine readable error identifier. Codes are part of
+// the API contract: clients switch on them, so never rename one.
+type Code string
+
+// Error codes shared across the application
+const (
+	CodeInvalidRequest       Code = "invalid_request"
+	CodeValidationFailed     Code = "validation_failed"
+	CodePasswordMismatch     Code = "password_mismatch"
+	CodeInvalidCredentials   Code = "invalid_credentials"
+	CodeAuthorizationMissing Code = "authorization_required"
+	CodeAuthorizationInvalid Code = "invalid_authorization_header"
+	CodeInvalidToken         Code = "invalid_token"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeRequestTimeout       Code = "request_timeout"
+	CodeConflict             Code = "conflict"
+	CodeIdempotencyBusy      Code = "idempotency_in_progress"
+	CodeIdempotencyReused    Code = "idempotency_key_reused"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeRateLimited          Code = "rate_limited"
+	CodeClientClosed         Code = "client_closed_request"
+	CodeInternal             Code = "internal_error"
+	CodeServiceUnavailable   Code = "service_unavailable"
+	CodeDeadlineExceeded     Code = "deadline_exceeded"
+	CodeMaintenance          Code = "maintenance"
+)
+
+// StatusClientClosedRequest is the non-standard status logged for requests
+// whose client went away before the response, as popularised by nginx
+const StatusClientClosedRequest = 499
+
+type meta struct {
+	status int
+	title  string
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[Code]meta{
+		CodeInvalidRequest:       {http.StatusBadRequest, "Invalid request format"},
+		CodeValidationFailed:     {http.StatusBadRequest, "Validation failed"},
+		CodePasswordMismatch:     {http.StatusBadRequest, "Password confirmation does not match"},
+		CodeInvalidCredentials:   {http.StatusUnauthorized, "Invalid credentials"},
+		CodeAuthorizationMissing: {http.StatusUnauthorized, "Authorization header required"},
+		CodeAuthorizationInvalid: {http.StatusUnauthorized, "Invalid authorization header format"},
+		CodeInvalidToken:         {http.StatusUnauthorized, "Invalid token"},
+		CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+		CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+		CodeNotFound:             {http.StatusNotFound, "Not found"},
+		CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "Method not allowed"},
+		CodeRequestTimeout:       {http.StatusRequestTimeout, "Request timeout"},
+		CodeConflict:             {http.StatusConflict, "Conflict"},
+		CodeIdempotencyBusy:      {http.StatusConflict, "A request with this idempotency key is in progress"},
+		CodeIdempotencyReused:    {http.StatusUnprocessableEntity, "Idempotency key reused with a different request"},
+		CodePayloadTooLarge:      {http.StatusRequestEntityTooLarge, "Request body too large"},
+		CodeRateLimited:          {http.StatusTooManyRequests, "Too many requests"},
+		CodeClientClosed:         {StatusClientClosedRequest, "Client closed request"},
+		CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+		CodeServiceUnavailable:   {http.StatusServiceUnavailable, "Service unavailable"},
+		CodeDeadlineExceeded:     {http.StatusServiceUnavailable, "Request took too long"},
+		CodeMaintenance:          {http.StatusServiceUnavailable, "Down for maintenance"},
+	}
+)
+
+// Register adds or replaces the HTTP status and title of code. Packages
+// with their own failure modes register their codes from init().
+func Register(code Code, status int, title string) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[code] = meta{status: status, title: title}
+}
+
+// Codes returns every registered code, sorted
+func Codes() []Code {
+	mu.RLock()
+	defer mu.RUnlock()
+	codes := make([]Code, 0, len(registry))
+	for c := range registry {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func lookup(code Code) meta {
+	m, _ := registered(code)
+	return m
+}
+
+// registered returns the metadata of code, falling back to internal_error
+// for unknown codes
+func registered(code Code) (meta, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if m, ok := registry[code]; ok {
+		return m, true
+	}
+	return registry[CodeInternal], false
+}
+
+// Error is an application error with a stable code. Detail is safe to show
+// to clients; the wrapped error is for logs only.
+type Error struct {
+	Code   Code
+	Detail string
+	// Fields holds field-level validation messages keyed by field name
+	Fields map[string][]string
+	err    error
+}
+
+// New returns an Error for code with a client-facing detail message
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Newf is New with a formatted detail message
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Wrap returns an Error for code that keeps err as its cause
+func Wrap(err error, code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail, err: err}
+}
+
+// Validation returns a validation_failed Error carrying field messages
+func Validation(fields map[string][]string) *Error {
+	return &Error{Code: CodeValidationFailed, Fields: fields}
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.err != nil {
+		msg += ": " + e.err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Status returns the HTTP status mapped to the error code
+func (e *Error) Status() int {
+	return lookup(e.Code).status
+}
+
+// Title returns the short, human readable summary of the error code
+func (e *Error) Title() string {
+	return lookup(e.Code).title
+}
+
+// From converts any error into an *Error. Errors that are not application
+// errors become internal errors, except sql.ErrNoRows which maps to
+// not_found and context errors, which map to deadline_exceeded and
+// client_closed_request.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Wrap(err, CodeNotFound, "")
+	case errors.Is(err, context.DeadlineExceeded):
+		return Wrap(err, CodeDeadlineExceeded, "")
+	case errors.Is(err, context.Canceled):
+		return Wrap(err, CodeClientClosed, "")
+	}
+	return Wrap(err, CodeInternal, "")
+}
+
+// CodeForStatus returns the generic code used for errors that only carry
+// an HTTP status, such as router 404/405 errors
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusRequestTimeout:
+		return CodeRequestTimeout
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	default:
+		return CodeInternal
+	}
+}
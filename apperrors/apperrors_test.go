@@ -0,0 +1,73 @@
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Status_And_Title(t *testing.T) {
+	err := New(CodeInvalidCredentials, "")
+	assert.Equal(t, http.StatusUnauthorized, err.Status())
+	assert.Equal(t, "Invalid credentials", err.Title())
+	assert.Equal(t, "invalid_credentials", err.Error())
+}
+
+func TestError_Wrap_Keeps_Cause(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Wrap(cause, CodeInternal, "Failed to create user")
+
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "internal_error: Failed to create user: connection refused", err.Error())
+}
+
+func TestError_Unknown_Code_Is_Internal(t *testing.T) {
+	err := New(Code("made_up"), "")
+	assert.Equal(t, http.StatusInternalServerError, err.Status())
+	assert.Equal(t, CodeInternal, err.Problem("/x", "").Code)
+}
+
+func TestRegister(t *testing.T) {
+	code := Code("test_teapot")
+	Register(code, http.StatusTeapot, "I'm a teapot")
+
+	assert.Equal(t, http.StatusTeapot, New(code, "").Status())
+	assert.Contains(t, Codes(), code)
+}
+
+func TestFrom(t *testing.T) {
+	appErr := New(CodeForbidden, "Admin access required")
+	assert.Same(t, appErr, From(fmt.Errorf("wrapped: %w", appErr)))
+	assert.Equal(t, CodeNotFound, From(sql.ErrNoRows).Code)
+	assert.Equal(t, CodeInternal, From(errors.New("boom")).Code)
+	assert.Equal(t, CodeDeadlineExceeded, From(fmt.Errorf("query: %w", context.DeadlineExceeded)).Code)
+	assert.Equal(t, CodeClientClosed, From(context.Canceled).Code)
+}
+
+func TestError_Problem(t *testing.T) {
+	err := Validation(map[string][]string{"email": {"Email is already taken"}})
+	p := err.Problem("/auth/register", "req-1")
+
+	assert.Equal(t, Problem{
+		Type:      TypeBase + "validation_failed",
+		Title:     "Validation failed",
+		Status:    http.StatusBadRequest,
+		Instance:  "/auth/register",
+		Code:      CodeValidationFailed,
+		RequestID: "req-1",
+		Errors:    map[string][]string{"email": {"Email is already taken"}},
+	}, p)
+}
+
+func TestCodeForStatus(t *testing.T) {
+	assert.Equal(t, CodeNotFound, CodeForStatus(http.StatusNotFound))
+	assert.Equal(t, CodeMethodNotAllowed, CodeForStatus(http.StatusMethodNotAllowed))
+	assert.Equal(t, CodeRateLimited, CodeForStatus(http.StatusTooManyRequests))
+	assert.Equal(t, CodeRequestTimeout, CodeForStatus(http.StatusRequestTimeout))
+	assert.Equal(t, CodeInternal, CodeForStatus(http.StatusBadGateway))
+}
@@ -0,0 +1,39 @@
+package apperrors
+
+// ContentType is the media type of RFC 7807 problem documents
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes error codes to form the problem "type" URI
+var TypeBase = "urn:problem-type:"
+
+// Problem is an RFC 7807 problem details document. Code and RequestID are
+// extension members; Errors holds field-level validation messages.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      Code                `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    map[string][]string `json:"errors,omitempty"`
+}
+
+// Problem renders e as a problem document for the request at instance
+func (e *Error) Problem(instance, requestID string) Problem {
+	code := e.Code
+	m, ok := registered(code)
+	if !ok {
+		code = CodeInternal
+	}
+	return Problem{
+		Type:      TypeBase + string(code),
+		Title:     m.title,
+		Status:    m.status,
+		Detail:    e.Detail,
+		Instance:  instance,
+		Code:      code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	}
+}
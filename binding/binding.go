@@ -0,0 +1,149 @@
+// Package binding decodes JSON request bodies strictly and enforces the
+// `validate:` struct tags of request DTOs, reporting failures as
+// apperrors with field-level messages.
+package binding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+)
+
+// MaxBodySize is the default limit on JSON request bodies, in bytes
+var MaxBodySize int64 = 1 << 20
+
+type limitKey struct{}
+
+// WithLimit returns a copy of ctx in which requests may carry bodies of up
+// to limit bytes instead of MaxBodySize
+func WithLimit(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, limitKey{}, limit)
+}
+
+// Limit returns the body size limit of r: the one set with WithLimit, or
+// MaxBodySize
+func Limit(r *http.Request) int64 {
+	if limit, ok := r.Context().Value(limitKey{}).(int64); ok {
+		return limit
+	}
+	return MaxBodySize
+}
+
+// JSON decodes the body of r into v and validates v. See Decode.
+func JSON(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return Decode(http.NoBody, Limit(r), v)
+	}
+	return Decode(r.Body, Limit(r), v)
+}
+
+// Decode reads a single JSON document of at most limit bytes from body into
+// v, then validates v against its `validate:` tags. Unknown fields and type
+// mismatches are reported per field path like tag violations, so clients
+// get every problem in one validation_failed error. An empty body decodes
+// as an empty object.
+func Decode(body io.Reader, limit int64, v interface{}) error {
+	lr := &limitedReader{r: body, n: limit}
+	dec := json.NewDecoder(lr)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	var maxErr *http.MaxBytesError
+	switch {
+	case lr.exceeded:
+		return apperrors.Newf(apperrors.CodePayloadTooLarge, "request_body_too_large:%d", limit)
+	case errors.As(err, &maxErr):
+		return apperrors.Newf(apperrors.CodePayloadTooLarge, "request_body_too_large:%d", maxErr.Limit)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		// The read deadline of the connection passed: the client sends
+		// too slowly
+		return apperrors.Wrap(err, apperrors.CodeRequestTimeout, "request_body_timeout")
+	}
+	switch {
+	case errors.Is(err, io.EOF):
+		// Empty body: report the missing required fields below
+	case err != nil:
+		return decodeError(err)
+	case dec.More():
+		return apperrors.New(apperrors.CodeInvalidRequest, "request_body_malformed")
+	}
+
+	if fields := Validate(v); len(fields) > 0 {
+		return apperrors.Validation(fields)
+	}
+	return nil
+}
+
+// decodeError maps a json decoding error to an application error
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return apperrors.Validation(map[string][]string{field: {"validation_type:" + jsonType(typeErr.Type)}})
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if name, ok := strings.CutPrefix(err.Error(), `json: unknown field "`); ok {
+		field := strings.TrimSuffix(name, `"`)
+		return apperrors.Validation(map[string][]string{field: {"validation_unknown_field"}})
+	}
+
+	return apperrors.Wrap(err, apperrors.CodeInvalidRequest, "request_body_malformed")
+}
+
+// jsonType names the JSON type expected for a Go type
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// limitedReader is io.LimitReader that remembers whether the limit was hit
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Probe for one more byte to tell "exactly limit" from "too large"
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		var maxErr *http.MaxBytesError
+		if n > 0 || errors.As(err, &maxErr) {
+			l.exceeded = true
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,158 @@
+package binding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type signup struct {
+	Name      string    `json:"name" validate:"required,min=2,max=5"`
+	Email     string    `json:"email" validate:"required,email"`
+	Role      string    `json:"role,omitempty" validate:"omitempty,oneof=user admin"`
+	Age       int       `json:"age" validate:"min=18"`
+	Tags      []string  `json:"tags" validate:"max=2"`
+	Address   *address  `json:"address"`
+	Addresses []address `json:"addresses"`
+}
+
+func decode(t *testing.T, body string, v interface{}) *apperrors.Error {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	err := JSON(req, v)
+	if err == nil {
+		return nil
+	}
+	appErr, ok := err.(*apperrors.Error)
+	require.True(t, ok, "%T is not an application error", err)
+	return appErr
+}
+
+func TestJSON_Valid(t *testing.T) {
+	var s signup
+	err := decode(t, `{"name":"Ann","email":"ann@example.com","age":30,"address":{"city":"Oslo"}}`, &s)
+	require.Nil(t, err)
+	assert.Equal(t, "Ann", s.Name)
+	assert.Equal(t, "Oslo", s.Address.City)
+}
+
+func TestJSON_Tag_Violations(t *testing.T) {
+	var s signup
+	err := decode(t, `{"name":"A","email":"nope","role":"root","age":12,"tags":["a","b","c"],
+		"address":{"city":""},"addresses":[{"city":"Oslo"},{"city":" "}]}`, &s)
+	require.NotNil(t, err)
+	assert.Equal(t, apperrors.CodeValidationFailed, err.Code)
+	assert.Equal(t, map[string][]string{
+		"name":              {"validation_min_length:2"},
+		"email":             {"validation_email"},
+		"role":              {"validation_oneof:user admin"},
+		"age":               {"validation_min:18"},
+		"tags":              {"validation_max_items:2"},
+		"address.city":      {"validation_required"},
+		"addresses[1].city": {"validation_required"},
+	}, err.Fields)
+}
+
+func TestJSON_Empty_Body_Reports_Required_Fields(t *testing.T) {
+	var s signup
+	err := decode(t, "", &s)
+	require.NotNil(t, err)
+	assert.Equal(t, []string{"validation_required"}, err.Fields["name"])
+	assert.Equal(t, []string{"validation_required"}, err.Fields["email"])
+}
+
+func TestJSON_Unknown_Field(t *testing.T) {
+	var s signup
+	err := decode(t, `{"name":"Ann","email":"ann@example.com","age":30,"is_admin":true}`, &s)
+	require.NotNil(t, err)
+	assert.Equal(t, apperrors.CodeValidationFailed, err.Code)
+	assert.Equal(t, map[string][]string{"is_admin": {"validation_unknown_field"}}, err.Fields)
+}
+
+func TestJSON_Type_Error_Has_Field_Path(t *testing.T) {
+	var s signup
+	err := decode(t, `{"name":"Ann","address":{"city":42}}`, &s)
+	require.NotNil(t, err)
+	assert.Equal(t, map[string][]string{"address.city": {"validation_type:string"}}, err.Fields)
+}
+
+func TestJSON_Malformed(t *testing.T) {
+	var s signup
+	for _, body := range []string{`{"name":`, `{} {}`, `[1,2`} {
+		err := decode(t, body, &s)
+		require.NotNil(t, err, body)
+		assert.Equal(t, apperrors.CodeInvalidRequest, err.Code, body)
+		assert.Equal(t, "request_body_malformed", err.Detail, body)
+	}
+}
+
+func TestDecode_Size_Limit(t *testing.T) {
+	var s signup
+	body := `{"name":"Ann","email":"ann@example.com","age":30}`
+
+	err := Decode(strings.NewReader(body), int64(len(body)), &s)
+	assert.NoError(t, err)
+
+	err = Decode(strings.NewReader(body), int64(len(body)-1), &s)
+	require.Error(t, err)
+	assert.Equal(t, apperrors.CodePayloadTooLarge, apperrors.From(err).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, apperrors.From(err).Status())
+}
+
+func TestJSON_Uses_The_Request_Limit(t *testing.T) {
+	body := `{"name":"Ann","email":"ann@example.com","age":30}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req = req.WithContext(WithLimit(req.Context(), 10))
+	assert.Equal(t, int64(10), Limit(req))
+
+	var s signup
+	err := JSON(req, &s)
+	assert.Equal(t, apperrors.CodePayloadTooLarge, apperrors.From(err).Code)
+	assert.Equal(t, "request_body_too_large:10", apperrors.From(err).Detail)
+
+	// A body capped by http.MaxBytesReader at the same limit is too large
+	// as well, not malformed
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Body = http.MaxBytesReader(rec, req.Body, 10)
+	err = Decode(req.Body, 10, &s)
+	assert.Equal(t, apperrors.CodePayloadTooLarge, apperrors.From(err).Code)
+}
+
+func TestDecode_Read_Timeout(t *testing.T) {
+	var s signup
+	err := Decode(iotest.ErrReader(os.ErrDeadlineExceeded), MaxBodySize, &s)
+	assert.Equal(t, apperrors.CodeRequestTimeout, apperrors.From(err).Code)
+	assert.Equal(t, http.StatusRequestTimeout, apperrors.From(err).Status())
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("even", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.Int && v.Int()%2 == 0
+	})
+	type form struct {
+		N int `json:"n" validate:"even"`
+	}
+
+	assert.Empty(t, Validate(form{N: 2}))
+	assert.Equal(t, map[string][]string{"n": {"validation_even"}}, Validate(&form{N: 3}))
+}
+
+func TestValidate_Unknown_Rule_Panics(t *testing.T) {
+	type form struct {
+		N int `validate:"nope"`
+	}
+	assert.Panics(t, func() { Validate(form{}) })
+}
@@ -0,0 +1,236 @@
+package binding
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Rule reports whether v satisfies a validation rule. param is the text
+// after "=" in the tag, e.g. "8" for `validate:"min=8"`.
+type Rule func(v reflect.Value, param string) bool
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"required": required,
+		"email":    email,
+		"uuid":     isUUID,
+		"oneof":    oneOf,
+		"min":      compare(func(n, p float64) bool { return n >= p }),
+		"max":      compare(func(n, p float64) bool { return n <= p }),
+		"len":      compare(func(n, p float64) bool { return n == p }),
+	}
+)
+
+// RegisterRule adds or replaces the rule used for `validate:"name"`. A
+// failure is reported with the message ID "validation_<name>", so add a
+// translation for it to every locale.
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+}
+
+func lookupRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// Validate checks v, a struct or pointer to one, against its `validate:`
+// tags and returns the failures keyed by JSON field path, e.g.
+// "items[0].name". Messages are translation IDs, followed by ":param" for
+// rules that take one. Rules are comma separated; "omitempty" skips the
+// remaining rules for zero values. Nested structs and slices of structs
+// are validated too.
+func Validate(v interface{}) map[string][]string {
+	fields := map[string][]string{}
+	validateValue(reflect.ValueOf(v), "", fields)
+	return fields
+}
+
+func validateValue(v reflect.Value, path string, fields map[string][]string) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		validateStruct(v, path, fields)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	}
+}
+
+func validateStruct(v reflect.Value, path string, fields map[string][]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		fv := v.Field(i)
+
+		if tag, ok := sf.Tag.Lookup("validate"); ok && tag != "-" {
+			for _, msg := range check(fv, tag) {
+				fields[fieldPath] = append(fields[fieldPath], msg)
+			}
+		}
+		if sf.Anonymous && indirect(fv).Kind() == reflect.Struct {
+			// Embedded structs share the parent's namespace, as in JSON
+			validateValue(fv, path, fields)
+			continue
+		}
+		validateValue(fv, fieldPath, fields)
+	}
+}
+
+// check applies the rules in tag to v and returns the failure messages
+func check(v reflect.Value, tag string) []string {
+	var msgs []string
+	for _, spec := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(spec), "=")
+		if name == "" {
+			continue
+		}
+		if name == "omitempty" {
+			if iv := indirect(v); !iv.IsValid() || iv.IsZero() {
+				return nil
+			}
+			continue
+		}
+
+		rule, ok := lookupRule(name)
+		if !ok {
+			panic(fmt.Sprintf("binding: unknown validation rule %q", name))
+		}
+		if rule(indirect(v), param) {
+			continue
+		}
+		msgs = append(msgs, message(name, param, indirect(v)))
+		if name == "required" {
+			// Everything else is noise for a missing value
+			break
+		}
+	}
+	return msgs
+}
+
+// message returns the translation ID for a failed rule. Size rules name
+// what they measure, since "at least 8" means different things for a
+// password and for a quantity.
+func message(name, param string, v reflect.Value) string {
+	id := "validation_" + name
+	switch name {
+	case "min", "max", "len":
+		switch v.Kind() {
+		case reflect.String:
+			id += "_length"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			id += "_items"
+		}
+	}
+	if param != "" {
+		id += ":" + param
+	}
+	return id
+}
+
+// fieldName returns the JSON name of a struct field
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func required(v reflect.Value, _ string) bool {
+	if !v.IsValid() {
+		return false
+	}
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) != ""
+	}
+	return !v.IsZero()
+}
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+func email(v reflect.Value, _ string) bool {
+	return v.Kind() == reflect.String && emailRegex.MatchString(v.String())
+}
+
+func isUUID(v reflect.Value, _ string) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+	_, err := uuid.FromString(v.String())
+	return err == nil
+}
+
+// oneOf takes a space separated list of allowed values
+func oneOf(v reflect.Value, param string) bool {
+	if !v.IsValid() {
+		return false
+	}
+	s := fmt.Sprint(v.Interface())
+	for _, allowed := range strings.Fields(param) {
+		if s == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// compare returns a rule comparing the size of a value with its param:
+// the rune count of strings, the length of collections and the value of
+// numbers
+func compare(ok func(n, param float64) bool) Rule {
+	return func(v reflect.Value, param string) bool {
+		p, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("binding: invalid rule parameter %q", param))
+		}
+		switch v.Kind() {
+		case reflect.String:
+			return ok(float64(utf8.RuneCountInString(v.String())), p)
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return ok(float64(v.Len()), p)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return ok(float64(v.Int()), p)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return ok(float64(v.Uint()), p)
+		case reflect.Float32, reflect.Float64:
+			return ok(v.Float(), p)
+		default:
+			// Absent values are the business of "required"
+			return true
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// Package client is a typed Go client for the API, for services that call
+// it instead of hand-rolling HTTP requests. It keeps the bearer token
+// returned by Register and Login, refreshes it shortly before it expires,
+// and retries calls that failed with 429 or 5xx using exponential backoff.
+// POSTs that are not safe to repeat, such as Login, are only retried on
+// 429 and 503, which the API answers without running them. Register sends
+// an Idempotency-Key and the API replays its retries, so retrying it never
+// creates a second account. Failed calls return an *Error holding the
+// problem document of the API.
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+)
+
+// RetryPolicy controls how failed calls are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first;
+	// 1 disables retries
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry; it doubles on each
+	// retry up to MaxBackoff, with full jitter
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetryPolicy is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	retry         RetryPolicy
+	refreshWithin time.Duration
+	language      string
+
+	// mu guards the token; it is held during a refresh so concurrent
+	// calls wait for the new token instead of refreshing in parallel
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc, e.g. to set timeouts or an
+// instrumented transport. Without a cookie jar, reads right after a write
+// may not see it when the API serves reads from replicas.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// WithToken starts the client with a token obtained earlier
+func WithToken(token string, expiresAt time.Time) Option {
+	return func(c *Client) { c.token, c.expiresAt = token, expiresAt }
+}
+
+// WithRefreshWithin refreshes the token when it expires within d, one
+// minute by default. Zero disables automatic refresh.
+func WithRefreshWithin(d time.Duration) Option {
+	return func(c *Client) { c.refreshWithin = d }
+}
+
+// WithLanguage asks for API messages in lang, e.g. "es-ES"
+func WithLanguage(lang string) Option {
+	return func(c *Client) { c.language = lang }
+}
+
+// New returns a Client for the API at baseURL, e.g.
+// "https://api.example.com". Its HTTP client keeps cookies: the API pins
+// the reads of a client to its primary database for a while after a
+// write, with a cookie, so they see the write.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be absolute", baseURL)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	c := &Client{
+		baseURL:       u,
+		httpClient:    &http.Client{Jar: jar},
+		retry:         DefaultRetryPolicy,
+		refreshWithin: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// Token returns the current bearer token and its expiry
+func (c *Client) Token() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.expiresAt
+}
+
+// SetToken replaces the bearer token, e.g. with one issued to another
+// process
+func (c *Client) SetToken(token string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.expiresAt = token, expiresAt
+}
+
+// Register creates an account and signs the client in as the new user
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (*AuthResponse, error) {
+	res := &AuthResponse{}
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/auth/register", in: req, out: res, keyed: true}); err != nil {
+		return nil, err
+	}
+	c.SetToken(res.Token, res.ExpiresAt)
+	return res, nil
+}
+
+// Login signs the client in
+func (c *Client) Login(ctx context.Context, req LoginRequest) (*AuthResponse, error) {
+	res := &AuthResponse{}
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/auth/login", in: req, out: res}); err != nil {
+		return nil, err
+	}
+	c.SetToken(res.Token, res.ExpiresAt)
+	return res, nil
+}
+
+// Refresh exchanges the current token for a new one. Calls refresh the
+// token on their own when it is about to expire; use Refresh to force it.
+func (c *Client) Refresh(ctx context.Context) (*AuthResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh(ctx)
+}
+
+// refresh renews the token; c.mu must be held
+func (c *Client) refresh(ctx context.Context) (*AuthResponse, error) {
+	res := &AuthResponse{}
+	// Refreshing twice is harmless, so retry it like a GET
+	refresh := call{method: http.MethodPost, path: "/auth/refresh", out: res, idempotent: true}
+	if err := c.send(ctx, refresh, c.token); err != nil {
+		return nil, err
+	}
+	c.token, c.expiresAt = res.Token, res.ExpiresAt
+	return res, nil
+}
+
+// Me returns the signed in user
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	res := &User{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: "/auth/me", out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Health returns the detailed health report
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	res := &HealthResponse{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: "/health", out: res}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Live returns the liveness probe
+func (c *Client) Live(ctx context.Context) (*ProbeResponse, error) {
+	res := &ProbeResponse{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: "/health/live", out: res}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Ready returns the readiness probe. When the API is not ready the probe
+// is returned together with a 503 *Error.
+func (c *Client) Ready(ctx context.Context) (*ProbeResponse, error) {
+	res := &ProbeResponse{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/health/ready", out: res, bodyOn: []int{http.StatusServiceUnavailable}, noRetry: true})
+	if err != nil && StatusCode(err) != http.StatusServiceUnavailable {
+		return nil, err
+	}
+	return res, err
+}
+
+// ErrorEvents returns up to limit recorded panics, the most recently seen
+// first; limit 0 uses the default of the API. Admins only.
+func (c *Client) ErrorEvents(ctx context.Context, limit int) ([]ErrorEvent, error) {
+	path := "/api/v1/admin/errors"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	res := &ErrorEventsResponse{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: path, out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res.Events, nil
+}
+
+// ErrorEvent returns the recorded panic with fingerprint. Admins only.
+func (c *Client) ErrorEvent(ctx context.Context, fingerprint string) (*ErrorEvent, error) {
+	res := &ErrorEvent{}
+	path := "/api/v1/admin/errors/" + url.PathEscape(fingerprint)
+	if err := c.do(ctx, call{method: http.MethodGet, path: path, out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Flags returns every feature flag, ordered by key. Admins only.
+func (c *Client) Flags(ctx context.Context) ([]Flag, error) {
+	res := &FlagsResponse{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/admin/flags", out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res.Flags, nil
+}
+
+// Flag returns the feature flag with key. Admins only.
+func (c *Client) Flag(ctx context.Context, key string) (*Flag, error) {
+	res := &Flag{}
+	path := "/api/v1/admin/flags/" + url.PathEscape(key)
+	if err := c.do(ctx, call{method: http.MethodGet, path: path, out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CreateFlag creates a feature flag. Admins only.
+func (c *Client) CreateFlag(ctx context.Context, req CreateFlagRequest) (*Flag, error) {
+	res := &Flag{}
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/admin/flags", in: req, out: res, auth: true, keyed: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateFlag replaces the targeting of the feature flag with key. Admins
+// only.
+func (c *Client) UpdateFlag(ctx context.Context, key string, req FlagRequest) (*Flag, error) {
+	res := &Flag{}
+	path := "/api/v1/admin/flags/" + url.PathEscape(key)
+	if err := c.do(ctx, call{method: http.MethodPut, path: path, in: req, out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteFlag deletes the feature flag with key, which turns it off. Admins
+// only.
+func (c *Client) DeleteFlag(ctx context.Context, key string) error {
+	path := "/api/v1/admin/flags/" + url.PathEscape(key)
+	return c.do(ctx, call{method: http.MethodDelete, path: path, auth: true})
+}
+
+// Maintenance returns the maintenance mode in effect. Admins only.
+func (c *Client) Maintenance(ctx context.Context) (*Maintenance, error) {
+	res := &Maintenance{}
+	if err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/admin/maintenance", out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateMaintenance switches maintenance mode for every replica. Admins
+// only.
+func (c *Client) UpdateMaintenance(ctx context.Context, req MaintenanceRequest) (*Maintenance, error) {
+	res := &Maintenance{}
+	if err := c.do(ctx, call{method: http.MethodPut, path: "/api/v1/admin/maintenance", in: req, out: res, auth: true}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// call describes one API operation
+type call struct {
+	method string
+	path   string
+	in     interface{}
+	out    interface{}
+	// auth sends the bearer token, refreshing it first when needed
+	auth bool
+	// idempotent calls are retried on any 5xx and network error
+	idempotent bool
+	// keyed calls send an Idempotency-Key, the same for every attempt, and
+	// are thereby idempotent
+	keyed bool
+	// noRetry disables retries, for calls whose failures are answers
+	noRetry bool
+	// bodyOn lists error statuses whose body still decodes into out
+	bodyOn []int
+}
+
+// do performs call, authenticating it when asked to
+func (c *Client) do(ctx context.Context, cl call) error {
+	var token string
+	if cl.auth {
+		var err error
+		if token, err = c.authToken(ctx); err != nil {
+			return err
+		}
+	}
+	return c.send(ctx, cl, token)
+}
+
+// authToken returns the token for an authenticated call, refreshing it
+// when it expires within refreshWithin. A failed refresh is not fatal: the
+// old token is used until it expires.
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && c.refreshWithin > 0 && !c.expiresAt.IsZero() {
+		left := time.Until(c.expiresAt)
+		if left > 0 && left < c.refreshWithin {
+			if _, err := c.refresh(ctx); err != nil && ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+		}
+	}
+	return c.token, nil
+}
+
+// send performs call with token, retrying as the retry policy allows
+func (c *Client) send(ctx context.Context, cl call, token string) error {
+	var body []byte
+	if cl.in != nil {
+		var err error
+		if body, err = json.Marshal(cl.in); err != nil {
+			return fmt.Errorf("client: encode request: %w", err)
+		}
+	}
+	var key string
+	if cl.keyed {
+		key = newIdempotencyKey()
+	}
+	idempotent := cl.keyed || cl.idempotent || cl.method == http.MethodGet || cl.method == http.MethodHead ||
+		cl.method == http.MethodPut || cl.method == http.MethodDelete
+
+	for attempt := 1; ; attempt++ {
+		req, err := c.newRequest(ctx, cl.method, cl.path, body, token, key)
+		if err != nil {
+			return err
+		}
+		res, err := c.httpClient.Do(req)
+		last := cl.noRetry || attempt >= c.retry.MaxAttempts
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if last || !idempotent {
+				return fmt.Errorf("client: %s %s: %w", cl.method, cl.path, err)
+			}
+			if err := c.wait(ctx, attempt, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !last && retryable(res.StatusCode, idempotent) {
+			after := retryAfter(res.Header)
+			drain(res)
+			if err := c.wait(ctx, attempt, after); err != nil {
+				return err
+			}
+			continue
+		}
+		return decode(res, cl)
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte, token, key string) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, r)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return req, nil
+}
+
+// newIdempotencyKey returns a random key for one keyed call
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// retryable reports whether a response with status is worth retrying.
+// Only 429 and 503 promise the request was not processed, so other 5xx
+// responses are retried for idempotent calls only.
+func retryable(status int, idempotent bool) bool {
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable:
+		return true
+	case status >= 500:
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// wait sleeps before the next attempt: for after when the server asked
+// for it, otherwise for an exponential backoff with full jitter
+func (c *Client) wait(ctx context.Context, attempt int, after time.Duration) error {
+	d := after
+	if d <= 0 {
+		d = c.backoff(attempt)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retry.MinBackoff << (attempt - 1)
+	if d <= 0 || (c.retry.MaxBackoff > 0 && d > c.retry.MaxBackoff) {
+		d = c.retry.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 1 << 20
+
+// decode reads res into cl.out, or into an *Error when it failed
+func decode(res *http.Response, cl call) error {
+	defer drain(res)
+
+	ok := res.StatusCode >= 200 && res.StatusCode < 300
+	if ok || contains(cl.bodyOn, res.StatusCode) {
+		if cl.out != nil {
+			if err := json.NewDecoder(res.Body).Decode(cl.out); err != nil {
+				return fmt.Errorf("client: decode %s %s: %w", cl.method, cl.path, err)
+			}
+		}
+		if ok {
+			return nil
+		}
+		return problem(res, nil)
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	return problem(res, data)
+}
+
+// problem builds the *Error for a failed response from its problem
+// document, filling in what a non-problem body leaves out
+func problem(res *http.Response, data []byte) *Error {
+	e := &Error{}
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &e.Problem)
+	}
+	if e.Status == 0 {
+		e.Status = res.StatusCode
+	}
+	if e.Code == "" {
+		e.Code = apperrors.CodeForStatus(res.StatusCode)
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(res.StatusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = res.Header.Get("X-Request-ID")
+	}
+	return e
+}
+
+// drain lets the transport reuse the connection
+func drain(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxErrorBody))
+	res.Body.Close()
+}
+
+func contains(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
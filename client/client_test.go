@@ -0,0 +1,411 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/actions"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/client"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noWait keeps retry tests fast
+var noWait = client.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func contract(t *testing.T) *openapi.Document {
+	t.Helper()
+	// The contract is read off actions.App(), which holds on to models.DB
+	require.NoError(t, modelstest.Open())
+	doc, err := actions.Contract()
+	require.NoError(t, err)
+	return doc
+}
+
+func keys(s *openapi.Schema) []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTypes_Match_The_Contract(t *testing.T) {
+	doc := contract(t)
+	g := openapi.NewGenerator(openapi.Info{})
+
+	for name, v := range map[string]interface{}{
+		"User":                client.User{},
+		"RegisterRequest":     client.RegisterRequest{},
+		"LoginRequest":        client.LoginRequest{},
+		"AuthResponse":        client.AuthResponse{},
+		"HealthResponse":      client.HealthResponse{},
+		"ProbeResponse":       client.ProbeResponse{},
+		"ErrorEvent":          client.ErrorEvent{},
+		"Flag":                client.Flag{},
+		"FlagRequest":         client.FlagRequest{},
+		"CreateFlagRequest":   client.CreateFlagRequest{},
+		"MaintenanceRequest":  client.MaintenanceRequest{},
+		"MaintenanceResponse": client.Maintenance{},
+	} {
+		want, ok := doc.Components.Schemas[name]
+		require.True(t, ok, name)
+		got := g.SchemaFor(v)
+		assert.Equal(t, keys(want), keys(got), "fields of %s", name)
+		assert.Equal(t, want.Required, got.Required, "required fields of %s", name)
+	}
+}
+
+// fixtures are contract-valid response bodies keyed by operation ID
+var fixtures = map[string]string{
+	"register":          `{"token":"t1","expires_at":"2030-01-01T00:00:00Z","user":{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","name":"Jane","email":"jane@example.com","role":"user","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}}`,
+	"login":             `{"token":"t2","expires_at":"2030-01-01T00:00:00Z","user":{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","name":"Jane","email":"jane@example.com","role":"admin","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}}`,
+	"refresh":           `{"token":"t3","expires_at":"2030-01-01T00:00:00Z","user":{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","name":"Jane","email":"jane@example.com","role":"user","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}}`,
+	"me":                `{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","name":"Jane","email":"jane@example.com","role":"user","locale":"es-ES","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}`,
+	"health":            `{"status":"healthy","timestamp":"2024-01-01T00:00:00Z","uptime":"1s","version":"1.0.0","services":{"api":"healthy"},"system":{"go_version":"go1.22","num_goroutines":1,"num_cpu":1,"os":"linux","arch":"amd64"}}`,
+	"liveness":          `{"status":"alive","timestamp":"2024-01-01T00:00:00Z"}`,
+	"readiness":         `{"status":"ready","timestamp":"2024-01-01T00:00:00Z","services":{"api":"ready"}}`,
+	"listErrorEvents":   `{"events":[{"fingerprint":"5f1c0d2e9a7b3c4d","type":"runtime.boundsError","message":"index out of range [5] with length 1","stack":"goroutine 1","route":"GET /api/v1/profile","last_request_id":"r1","count":3,"first_seen":"2024-01-01T00:00:00Z","last_seen":"2024-01-02T00:00:00Z"}]}`,
+	"listFlags":         `{"flags":[{"key":"checkout.new-flow","description":"New checkout","enabled":true,"users":["6ba7b810-9dad-11d1-80b4-00c04fd430c8"],"roles":["admin"],"orgs":[],"percentage":25,"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-02T00:00:00Z"}]}`,
+	"createFlag":        `{"key":"checkout.new-flow","description":"New checkout","enabled":true,"users":["6ba7b810-9dad-11d1-80b4-00c04fd430c8"],"roles":["admin"],"orgs":[],"percentage":25,"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-02T00:00:00Z"}`,
+	"getFlag":           `{"key":"checkout.new-flow","description":"New checkout","enabled":true,"users":["6ba7b810-9dad-11d1-80b4-00c04fd430c8"],"roles":["admin"],"orgs":[],"percentage":25,"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-02T00:00:00Z"}`,
+	"updateFlag":        `{"key":"checkout.new-flow","description":"New checkout","enabled":true,"users":["6ba7b810-9dad-11d1-80b4-00c04fd430c8"],"roles":["admin"],"orgs":[],"percentage":25,"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-02T00:00:00Z"}`,
+	"deleteFlag":        ``,
+	"getMaintenance":    `{"mode":"off","message":"","retry_after":0,"updated_at":"2024-01-01T00:00:00Z","forced":false}`,
+	"updateMaintenance": `{"mode":"read_only","message":"Upgrading","retry_after":300,"updated_at":"2024-01-02T00:00:00Z","forced":false}`,
+	"getErrorEvent":     `{"fingerprint":"5f1c0d2e9a7b3c4d","type":"runtime.boundsError","message":"index out of range [5] with length 1","stack":"goroutine 1","route":"GET /api/v1/profile","last_request_id":"r1","count":3,"first_seen":"2024-01-01T00:00:00Z","last_seen":"2024-01-02T00:00:00Z"}`,
+}
+
+// contractServer answers every documented operation with its fixture. It
+// fails the test when the client sends a request the contract rejects or
+// a fixture drifts from the contract.
+func contractServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	doc := contract(t)
+	var calls []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, ok := doc.Find(r.Method, r.URL.Path)
+		if !assert.True(t, ok, "%s %s is not in the contract", r.Method, r.URL.Path) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		op := route.Operation.OperationID
+		calls = append(calls, op)
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Empty(t, route.ValidateRequest(r, params, body), "request of %s", op)
+		if len(route.Operation.Security) > 0 {
+			assert.Contains(t, r.Header.Get("Authorization"), "Bearer ", "%s is secured", op)
+		}
+
+		status := http.StatusOK
+		switch op {
+		case "register", "createFlag":
+			status = http.StatusCreated
+		case "deleteFlag":
+			status = http.StatusNoContent
+		}
+		header := http.Header{"Content-Type": {"application/json"}}
+		assert.Empty(t, route.ValidateResponse(status, header, []byte(fixtures[op])), "fixture of %s", op)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, fixtures[op])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestClient_Follows_The_Contract(t *testing.T) {
+	srv, calls := contractServer(t)
+	c, err := client.New(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	auth, err := c.Register(ctx, client.RegisterRequest{
+		Name: "Jane", Email: "jane@example.com", Password: "password123", PasswordConfirm: "password123", Locale: "es-ES",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "t1", auth.Token)
+	assert.Equal(t, "jane@example.com", auth.User.Email)
+
+	auth, err = c.Login(ctx, client.LoginRequest{Email: "jane@example.com", Password: "password123"})
+	require.NoError(t, err)
+	assert.True(t, auth.User.IsAdmin())
+	token, _ := c.Token()
+	assert.Equal(t, "t2", token)
+
+	me, err := c.Me(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "es-ES", me.Locale)
+
+	auth, err = c.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "t3", auth.Token)
+
+	health, err := c.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "linux", health.System.OS)
+
+	live, err := c.Live(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "alive", live.Status)
+
+	ready, err := c.Ready(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ready", ready.Services["api"])
+
+	events, err := c.ErrorEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(3), events[0].Count)
+
+	event, err := c.ErrorEvent(ctx, events[0].Fingerprint)
+	require.NoError(t, err)
+	assert.Equal(t, "GET /api/v1/profile", event.Route)
+
+	flag, err := c.CreateFlag(ctx, client.CreateFlagRequest{Key: "checkout.new-flow", FlagRequest: client.FlagRequest{Enabled: true, Percentage: 25}})
+	require.NoError(t, err)
+	assert.Equal(t, 25, flag.Percentage)
+
+	flags, err := c.Flags(ctx)
+	require.NoError(t, err)
+	require.Len(t, flags, 1)
+
+	flag, err = c.Flag(ctx, flags[0].Key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, flag.Roles)
+
+	flag, err = c.UpdateFlag(ctx, flag.Key, client.FlagRequest{Enabled: true, Roles: []string{"admin"}})
+	require.NoError(t, err)
+	assert.True(t, flag.Enabled)
+
+	require.NoError(t, c.DeleteFlag(ctx, flag.Key))
+
+	state, err := c.Maintenance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "off", state.Mode)
+
+	state, err = c.UpdateMaintenance(ctx, client.MaintenanceRequest{Mode: "read_only", Message: "Upgrading"})
+	require.NoError(t, err)
+	assert.Equal(t, 300, state.RetryAfter)
+
+	assert.Equal(t, []string{"register", "login", "me", "refresh", "health", "liveness", "readiness", "listErrorEvents", "getErrorEvent",
+		"createFlag", "listFlags", "getFlag", "updateFlag", "deleteFlag", "getMaintenance", "updateMaintenance"}, *calls)
+}
+
+func TestClient_Refreshes_Expiring_Tokens(t *testing.T) {
+	srv, calls := contractServer(t)
+	c, err := client.New(srv.URL, client.WithToken("old", time.Now().Add(10*time.Second)))
+	require.NoError(t, err)
+
+	_, err = c.Me(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"refresh", "me"}, *calls)
+
+	token, expiresAt := c.Token()
+	assert.Equal(t, "t3", token)
+	assert.Equal(t, 2030, expiresAt.Year())
+
+	_, err = c.Me(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"refresh", "me", "me"}, *calls, "fresh tokens are not refreshed")
+}
+
+func TestClient_Returns_Problems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", apperrors.ContentType)
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(apperrors.New(apperrors.CodeInvalidCredentials, "").Problem("/auth/login", "req-1"))
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithRetryPolicy(noWait))
+	require.NoError(t, err)
+	_, err = c.Login(context.Background(), client.LoginRequest{Email: "jane@example.com", Password: "wrong"})
+	require.Error(t, err)
+
+	assert.True(t, client.IsCode(err, apperrors.CodeInvalidCredentials))
+	assert.Equal(t, http.StatusUnauthorized, client.StatusCode(err))
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		call     func(*client.Client) error
+		attempts int32
+	}{
+		{"GET on 500", http.StatusInternalServerError, func(c *client.Client) error { _, err := c.Health(context.Background()); return err }, 3},
+		{"GET on 429", http.StatusTooManyRequests, func(c *client.Client) error { _, err := c.Health(context.Background()); return err }, 3},
+		{"POST on 503", http.StatusServiceUnavailable, func(c *client.Client) error {
+			_, err := c.Login(context.Background(), client.LoginRequest{})
+			return err
+		}, 3},
+		{"no POST on 500", http.StatusInternalServerError, func(c *client.Client) error {
+			_, err := c.Login(context.Background(), client.LoginRequest{})
+			return err
+		}, 1},
+		{"keyed POST on 500", http.StatusInternalServerError, func(c *client.Client) error {
+			_, err := c.Register(context.Background(), client.RegisterRequest{})
+			return err
+		}, 3},
+		{"no 4xx", http.StatusBadRequest, func(c *client.Client) error { _, err := c.Health(context.Background()); return err }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			c, err := client.New(srv.URL, client.WithRetryPolicy(noWait))
+			require.NoError(t, err)
+			err = tt.call(c)
+			assert.Equal(t, tt.status, client.StatusCode(err))
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestClient_Retries_With_The_Same_Idempotency_Key(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithRetryPolicy(noWait))
+	require.NoError(t, err)
+	_, err = c.Register(context.Background(), client.RegisterRequest{})
+	require.Error(t, err)
+	_, err = c.Register(context.Background(), client.RegisterRequest{})
+	require.Error(t, err)
+
+	require.Len(t, keys, 6)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, []string{keys[0], keys[0], keys[0]}, keys[:3])
+	assert.NotEqual(t, keys[0], keys[3], "every call has its own key")
+}
+
+func TestClient_Recovers_After_Retry(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, fixtures["liveness"])
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithRetryPolicy(noWait))
+	require.NoError(t, err)
+	live, err := c.Live(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "alive", live.Status)
+}
+
+func TestClient_Ready_Returns_The_Probe_When_Not_Ready(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `{"status":"not_ready","timestamp":"2024-01-01T00:00:00Z","services":{"api":"not_ready"}}`)
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL)
+	require.NoError(t, err)
+	probe, err := c.Ready(context.Background())
+	assert.True(t, client.IsCode(err, apperrors.CodeServiceUnavailable))
+	require.NotNil(t, probe)
+	assert.Equal(t, "not_ready", probe.Services["api"])
+}
+
+func TestClient_Stops_Retrying_When_Cancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour}))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.Health(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestClient_Uses_The_Given_HTTP_Client(t *testing.T) {
+	var sent *http.Request
+	hc := &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		sent = r
+		rec := httptest.NewRecorder()
+		_, _ = rec.WriteString(fixtures["liveness"])
+		return rec.Result(), nil
+	})}
+
+	c, err := client.New("https://api.example.com/", client.WithHTTPClient(hc), client.WithLanguage("es-ES"))
+	require.NoError(t, err)
+	_, err = c.Live(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/health/live", sent.URL.String())
+	assert.Equal(t, "es-ES", sent.Header.Get("Accept-Language"))
+}
+
+func TestClient_Keeps_Cookies(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pin string
+		if cookie, err := r.Cookie("primary_after_write"); err == nil {
+			pin = cookie.Value
+		}
+		sent = append(sent, pin)
+		if r.Method == http.MethodPost {
+			http.SetCookie(w, &http.Cookie{Name: "primary_after_write", Value: "1", Path: "/"})
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, fixtures["register"])
+			return
+		}
+		_, _ = io.WriteString(w, fixtures["me"])
+	}))
+	defer srv.Close()
+
+	c, err := client.New(srv.URL)
+	require.NoError(t, err)
+	_, err = c.Register(context.Background(), client.RegisterRequest{})
+	require.NoError(t, err)
+	_, err = c.Me(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "1"}, sent, "reads after a write go to the primary")
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestNew_Rejects_Relative_URLs(t *testing.T) {
+	_, err := client.New("/api")
+	assert.Error(t, err)
+}
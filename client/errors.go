@@ -0,0 +1,41 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+)
+
+// Error is a failed API call. The API answers errors with RFC 7807 problem
+// documents; Problem holds the decoded document, or just the status when
+// the response was not a problem.
+type Error struct {
+	apperrors.Problem
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("api: %d %s", e.Status, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// IsCode reports whether err is an API error with code
+func IsCode(err error, code apperrors.Code) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// StatusCode returns the HTTP status of an API error, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package client
+
+import "time"
+
+// User is an account as returned by the API
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Locale    string    `json:"locale,omitempty"`
+	Org       string    `json:"org,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsAdmin reports whether u has the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == "admin"
+}
+
+// RegisterRequest is the body of Register
+type RegisterRequest struct {
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	PasswordConfirm string `json:"password_confirm"`
+	// Locale is the preferred language of API messages, e.g. "es-ES"
+	Locale string `json:"locale,omitempty"`
+}
+
+// LoginRequest is the body of Login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AuthResponse is returned by Register, Login and Refresh
+type AuthResponse struct {
+	Token     string    `json:"token"`
+	User      User      `json:"user"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HealthResponse is the detailed health report of the API
+type HealthResponse struct {
+	Status    string            `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Uptime    string            `json:"uptime"`
+	Version   string            `json:"version"`
+	Services  map[string]string `json:"services"`
+	System    SystemInfo        `json:"system"`
+}
+
+// SystemInfo describes the runtime of the API
+type SystemInfo struct {
+	GoVersion     string `json:"go_version"`
+	NumGoroutines int    `json:"num_goroutines"`
+	NumCPU        int    `json:"num_cpu"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+}
+
+// ProbeResponse is the body of the liveness and readiness probes
+type ProbeResponse struct {
+	Status    string            `json:"status"`
+	Timestamp time.Time         `json:"timestamp"`
+	Services  map[string]string `json:"services,omitempty"`
+}
+
+// ErrorEvent groups the recorded panics of one fingerprint. Message,
+// Stack, Route and LastRequestID are those of the latest occurrence.
+type ErrorEvent struct {
+	Fingerprint   string    `json:"fingerprint"`
+	Type          string    `json:"type"`
+	Message       string    `json:"message"`
+	Stack         string    `json:"stack"`
+	Route         string    `json:"route"`
+	LastRequestID string    `json:"last_request_id"`
+	Count         int64     `json:"count"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// ErrorEventsResponse is returned by ErrorEvents
+type ErrorEventsResponse struct {
+	Events []ErrorEvent `json:"events"`
+}
+
+// Flag is a feature flag. A disabled flag is off for everyone; an enabled
+// flag is on for the listed users, roles and orgs and for Percentage
+// percent of the other users.
+type Flag struct {
+	Key         string    `json:"key"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	Users       []string  `json:"users"`
+	Roles       []string  `json:"roles"`
+	Orgs        []string  `json:"orgs"`
+	Percentage  int       `json:"percentage"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FlagRequest is the body of UpdateFlag. It replaces the whole flag:
+// fields left out are cleared.
+type FlagRequest struct {
+	Description string   `json:"description,omitempty"`
+	Enabled     bool     `json:"enabled,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Orgs        []string `json:"orgs,omitempty"`
+	Percentage  int      `json:"percentage,omitempty"`
+}
+
+// CreateFlagRequest is the body of CreateFlag
+type CreateFlagRequest struct {
+	Key string `json:"key"`
+	FlagRequest
+}
+
+// FlagsResponse is returned by Flags
+type FlagsResponse struct {
+	Flags []Flag `json:"flags"`
+}
+
+// Maintenance is the maintenance mode in effect. While it is not "off",
+// other users get 503 problems with the code "maintenance".
+type Maintenance struct {
+	// Mode is "off", "read_only" or "offline"
+	Mode    string `json:"mode"`
+	Message string `json:"message"`
+	// RetryAfter is sent to clients in Retry-After, in seconds
+	RetryAfter int       `json:"retry_after"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Forced is set while the server configuration forces the mode
+	Forced bool `json:"forced"`
+}
+
+// MaintenanceRequest is the body of UpdateMaintenance
+type MaintenanceRequest struct {
+	Mode    string `json:"mode"`
+	Message string `json:"message,omitempty"`
+	// RetryAfter is in seconds; 0 uses the server default
+	RetryAfter int `json:"retry_after,omitempty"`
+}
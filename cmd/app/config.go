@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+)
+
+// configCommand runs "config show [flags]", which prints the configuration
+// the server would start with, secrets masked, followed by any validation
+// errors. It returns the exit code: 1 if the configuration is invalid.
+func configCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(stderr, "usage: app config show [-config file] [-section.key=value ...]")
+		return 2
+	}
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration: %v\n", err)
+		return 1
+	}
+	if err := cfg.Show(stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -1,20 +1,104 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/akingundogdu/production-ready-go-backend-architecture/actions"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/lifecycle"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
 )
 
 // main is the starting point for your Buffalo application.
-// You can feel free and add to this `main` method, change
-// what it does, etc...
-// All we ask is that, at some point, you make sure to
-// call `app.Serve()`, unless you don't want to start your
-// application that is. :)
+// Components are started in order and stopped in reverse on SIGINT or
+// SIGTERM: the HTTP server drains first, then background workers stop,
+// telemetry is flushed and the database closes last. Packages register
+// their own components, such as cleanup workers, with lifecycle.Append
+// while actions.App() builds the application, which happens once the
+// database answers.
+//
+// Settings come from defaults, the file named by -config or CONFIG_FILE,
+// env and flags such as -server.port=8080; "config show" prints them.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	config.Set(cfg)
+
+	logCfg, err := logging.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.Setup(logCfg)
+
+	m := lifecycle.Default
+	m.ShutdownTimeout = cfg.Server.ShutdownTimeout
+
+	// Wait for the database before building the application, which holds
+	// on to it. A signal stops the wait.
+	ctx, stopWaiting := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = models.Connect(ctx, cfg)
+	stopWaiting()
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.Append(lifecycle.Hook{
+		Name: "database",
+		OnStop: func(context.Context) error {
+			return models.Close()
+		},
+	})
+
+	var flush telemetry.ShutdownFunc
+	m.Append(lifecycle.Hook{
+		Name: "telemetry",
+		OnStart: func(ctx context.Context) (err error) {
+			flush, err = telemetry.Setup(ctx, telemetry.Config{
+				ServiceName:    cfg.Telemetry.ServiceName,
+				ServiceVersion: cfg.Telemetry.Version,
+				Environment:    cfg.Env,
+				Exporter:       cfg.Telemetry.Exporter,
+				FilePath:       cfg.Telemetry.File,
+			})
+			return err
+		},
+		OnStop: func(ctx context.Context) error {
+			return flush(ctx)
+		},
+	})
+
 	app := actions.App()
-	if err := app.Serve(); err != nil {
+	if app.Context.Err() != nil {
+		// App() stops the application on invalid configuration and logs
+		// the reason
+		log.Fatal("application stopped during setup")
+	}
+	handler, err := actions.Handler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.Append(lifecycle.HTTPServer("http", &http.Server{
+		Addr:              app.Options.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}))
+
+	if err := m.Run(app.Context); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -31,8 +115,9 @@ for you. https://gobuffalo.io/en/docs/proxy
 ## Buffalo Build
 
 When `buffalo build` is run to compile your binary, this `main`
-function will be at the heart of that binary. It is expected
-that your `main` function will start your application using
-the `app.Serve()` method.
+function will be at the heart of that binary. Rather than
+`app.Serve()`, this `main` serves the application through the
+lifecycle manager, which also owns the database, telemetry and
+background workers.
 
 */
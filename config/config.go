@@ -0,0 +1,457 @@
+// Package config holds the typed settings of the application. They are
+// loaded from defaults, an optional YAML or TOML file, environment
+// variables and command line flags, each overriding the ones before;
+// secrets may come from files, an encrypted file or Vault instead.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/ratelimit"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DevelopmentJWTSecret is the JWT secret used unless one is configured;
+// it is rejected in production
+const DevelopmentJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
+// minJWTSecret is the shortest JWT secret accepted in production, in bytes
+const minJWTSecret = 32
+
+// Config holds the settings of the application. Each setting has a key
+// such as "server.port", used in files and as the flag name, and most can
+// be set with an environment variable, named in the env tag.
+type Config struct {
+	// Env is GO_ENV, "development" by default. buffalo, pop and envy read
+	// it directly, so it can only be set in the environment.
+	Env       string    `yaml:"env" config:"-"`
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Auth      Auth      `yaml:"auth"`
+	CORS      CORS      `yaml:"cors"`
+	Security  Security  `yaml:"security"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Telemetry Telemetry `yaml:"telemetry"`
+	Secrets   Secrets   `yaml:"secrets"`
+
+	Flags       Flags       `yaml:"flags"`
+	Maintenance Maintenance `yaml:"maintenance"`
+
+	// args are the flags the configuration was loaded with, kept for
+	// Reload
+	args []string
+}
+
+// Server configures the HTTP server
+type Server struct {
+	// Host is the interface listened on, or a "unix:" socket path
+	Host              string        `yaml:"host" env:"ADDR"`
+	Port              int           `yaml:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	// ShutdownTimeout bounds the graceful shutdown of all components
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// SimulateNotReady fails the readiness probe, for testing deployments
+	SimulateNotReady bool `yaml:"simulate_not_ready" env:"SIMULATE_NOT_READY"`
+}
+
+// Addr returns the address the server listens on
+func (s Server) Addr() string {
+	if strings.HasPrefix(s.Host, "unix:") {
+		return s.Host
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Database overrides the connection of the current environment in
+// database.yml. Zero settings keep what database.yml says.
+type Database struct {
+	// URL replaces the connection details; under test it is read from
+	// TEST_DATABASE_URL, as in database.yml
+	URL string `yaml:"url" env:"DATABASE_URL" test_env:"TEST_DATABASE_URL" secret:"true"`
+	// Pool is the maximum number of open connections, IdlePool of idle
+	// ones kept for reuse
+	Pool     int `yaml:"pool" env:"DATABASE_POOL"`
+	IdlePool int `yaml:"idle_pool" env:"DATABASE_IDLE_POOL"`
+	// ConnMaxLifetime closes connections once they are this old, so they
+	// follow failovers and DNS changes; ConnMaxIdleTime once they are
+	// idle this long
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DATABASE_CONN_MAX_IDLE_TIME"`
+	// StatementTimeout makes the server cancel statements running longer,
+	// including blocking lock waits; 0 lets them run
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DATABASE_STATEMENT_TIMEOUT"`
+	// ConnectTimeout bounds how long startup waits for the database; 0
+	// waits until shutdown
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DATABASE_CONNECT_TIMEOUT"`
+	// ReplicaURLs are read replicas of the database. They serve read-only
+	// queries while they answer and lag at most ReplicaMaxLag, checked
+	// every ReplicaCheckInterval.
+	ReplicaURLs          []string      `yaml:"replica_urls" env:"DATABASE_REPLICA_URLS" secret:"true"`
+	ReplicaMaxLag        time.Duration `yaml:"replica_max_lag" env:"DATABASE_REPLICA_MAX_LAG"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env:"DATABASE_REPLICA_CHECK_INTERVAL"`
+	// PrimaryAfterWrite sends the reads of a client to the primary for this
+	// long after it wrote, so it reads its writes. Writes are remembered in
+	// a cookie, so this holds across instances.
+	PrimaryAfterWrite time.Duration `yaml:"primary_after_write" env:"DATABASE_PRIMARY_AFTER_WRITE"`
+}
+
+// Auth configures authentication
+type Auth struct {
+	// JWTSecret signs tokens. After a rotation, the secrets it replaced
+	// go in JWTPreviousSecrets until the tokens they signed expire.
+	JWTSecret          string   `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	JWTPreviousSecrets []string `yaml:"jwt_previous_secrets" env:"JWT_PREVIOUS_SECRETS" secret:"true"`
+	// TokenTTL is the lifetime of issued and refreshed tokens
+	TokenTTL   time.Duration `yaml:"token_ttl" env:"AUTH_TOKEN_TTL"`
+	BcryptCost int           `yaml:"bcrypt_cost" env:"AUTH_BCRYPT_COST"`
+}
+
+// CORS configures cross-origin requests
+type CORS struct {
+	// AllowedOrigins lists origins such as "https://app.example.com" or
+	// "https://*.example.com"; "*" allows any origin
+	AllowedOrigins   []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowCredentials bool     `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	// ExposedHeaders replaces the response headers exposed to browsers;
+	// empty exposes those of the API
+	ExposedHeaders []string `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// Security configures the security headers sent on every response
+type Security struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, sent on
+	// HTTPS responses only; 0 disables it
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS"`
+	HSTSPreload           bool          `yaml:"hsts_preload" env:"SECURITY_HSTS_PRELOAD"`
+	// CSP is the Content-Security-Policy of routes without a policy of
+	// their own, such as /docs
+	CSP               string `yaml:"csp" env:"SECURITY_CSP"`
+	ReferrerPolicy    string `yaml:"referrer_policy" env:"SECURITY_REFERRER_POLICY"`
+	PermissionsPolicy string `yaml:"permissions_policy" env:"SECURITY_PERMISSIONS_POLICY"`
+	// FrameOptions is the X-Frame-Options value, "DENY" or "SAMEORIGIN"
+	FrameOptions string `yaml:"frame_options" env:"SECURITY_FRAME_OPTIONS"`
+}
+
+// RateLimit configures rate limiting
+type RateLimit struct {
+	// Store is "memory", "redis" or "postgres"
+	Store    string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	RedisURL string `yaml:"redis_url" env:"REDIS_URL" secret:"true"`
+	// TrustProxy reads client addresses from X-Forwarded-For; only enable
+	// it behind a proxy that sets it
+	TrustProxy bool `yaml:"trust_proxy" env:"RATE_LIMIT_TRUST_PROXY"`
+	// Auth limits sign in and sign up per IP, API the API per user or key
+	Auth ratelimit.Limit `yaml:"auth" env:"RATE_LIMIT_AUTH"`
+	API  ratelimit.Limit `yaml:"api" env:"RATE_LIMIT_API"`
+}
+
+// Telemetry configures tracing
+type Telemetry struct {
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	Version     string `yaml:"version" env:"APP_VERSION"`
+	// Exporter is "none", "otlp", "stdout" or "file". The OTLP exporter
+	// reads its endpoint and headers from the OTEL_EXPORTER_OTLP_*
+	// variables.
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	// File is where spans are written with the "file" exporter
+	File string `yaml:"file" env:"OTEL_TRACES_FILE"`
+}
+
+// Secrets selects where secret settings are looked up, by the name of
+// their environment variable, such as JWT_SECRET. Secrets found there
+// override the file and env; flags still override them.
+type Secrets struct {
+	// Provider is "env" (the default), "file", "encrypted" or "vault"
+	Provider string `yaml:"provider" env:"SECRETS_PROVIDER"`
+	// Dir holds one file per secret for the file provider
+	Dir string `yaml:"dir" env:"SECRETS_DIR"`
+	// Path is the age encrypted YAML file of the encrypted provider,
+	// decrypted with AgeIdentity
+	Path        string `yaml:"path" env:"SECRETS_PATH"`
+	AgeIdentity string `yaml:"age_identity" env:"SECRETS_AGE_IDENTITY" secret:"true"`
+	// VaultPath is the KV version 2 secret of the vault provider
+	VaultAddr  string `yaml:"vault_addr" env:"VAULT_ADDR"`
+	VaultToken string `yaml:"vault_token" env:"VAULT_TOKEN" secret:"true"`
+	VaultMount string `yaml:"vault_mount" env:"VAULT_MOUNT"`
+	VaultPath  string `yaml:"vault_path" env:"VAULT_SECRET_PATH"`
+	// Refresh is how often secrets are reloaded so that rotated ones, such
+	// as JWT secrets, take effect; 0 disables it
+	Refresh time.Duration `yaml:"refresh" env:"SECRETS_REFRESH"`
+}
+
+// Flags configures feature flags, switched at runtime through the API
+type Flags struct {
+	// Store keeps the flags: "postgres", shared by every replica, or
+	// "memory"
+	Store string `yaml:"store" env:"FLAGS_STORE"`
+}
+
+// Maintenance configures maintenance mode. Admins switch it at runtime
+// through the API; a mode set here overrides theirs until it is "off"
+// again.
+type Maintenance struct {
+	// Store keeps the mode set through the API: "postgres", shared by
+	// every replica, or "memory"
+	Store string `yaml:"store" env:"MAINTENANCE_STORE"`
+	// Mode is "off", "read_only", which only serves GET, HEAD and OPTIONS,
+	// or "offline"
+	Mode string `yaml:"mode" env:"MAINTENANCE_MODE"`
+	// Message replaces the generic maintenance message
+	Message string `yaml:"message" env:"MAINTENANCE_MESSAGE"`
+	// RetryAfter is sent in Retry-After when the mode does not set it
+	RetryAfter time.Duration `yaml:"retry_after" env:"MAINTENANCE_RETRY_AFTER"`
+	// AllowedIPs lists addresses and CIDR ranges served during maintenance
+	AllowedIPs []string `yaml:"allowed_ips" env:"MAINTENANCE_ALLOWED_IPS"`
+}
+
+// Networks returns AllowedIPs as networks, single addresses as /32 or /128
+func (m Maintenance) Networks() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(m.AllowedIPs))
+	for _, s := range m.AllowedIPs {
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR range", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Defaults returns the settings used in env unless configured otherwise
+func Defaults(env string) *Config {
+	byEnv := func(production, other string) string {
+		if env == "production" {
+			return production
+		}
+		return other
+	}
+	cfg := &Config{
+		Env: env,
+		Server: Server{
+			Host:              byEnv("0.0.0.0", "127.0.0.1"),
+			Port:              3000,
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Pool:             10,
+			IdlePool:         5,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			StatementTimeout: 30 * time.Second,
+			ConnectTimeout:   time.Minute,
+
+			ReplicaMaxLag:        5 * time.Second,
+			ReplicaCheckInterval: 5 * time.Second,
+			PrimaryAfterWrite:    10 * time.Second,
+		},
+		Auth: Auth{
+			JWTSecret:  DevelopmentJWTSecret,
+			TokenTTL:   24 * time.Hour,
+			BcryptCost: bcrypt.DefaultCost,
+		},
+		CORS: CORS{
+			MaxAge: time.Minute,
+		},
+		Security: Security{
+			HSTSIncludeSubdomains: true,
+			// Nothing may be loaded, run or framed by JSON responses
+			CSP:               "default-src 'none'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'",
+			ReferrerPolicy:    "no-referrer",
+			PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+			FrameOptions:      "DENY",
+		},
+		RateLimit: RateLimit{
+			Store:    "memory",
+			RedisURL: "redis://localhost:6379/0",
+			Auth:     ratelimit.PerMinute(10),
+			API:      ratelimit.PerMinute(300),
+		},
+		Telemetry: Telemetry{
+			ServiceName: "production-ready-go-backend",
+			Version:     "1.0.0",
+			Exporter:    "none",
+			File:        "traces.json",
+		},
+		Secrets: Secrets{
+			Provider:   "env",
+			Dir:        "/run/secrets",
+			VaultMount: "secret",
+			Refresh:    5 * time.Minute,
+		},
+		Flags: Flags{
+			Store: "postgres",
+		},
+		Maintenance: Maintenance{
+			Store:      "postgres",
+			Mode:       "off",
+			RetryAfter: 5 * time.Minute,
+		},
+	}
+	if env == "production" {
+		cfg.CORS.MaxAge = time.Hour
+		cfg.Security.HSTSMaxAge = 365 * 24 * time.Hour
+	} else {
+		cfg.CORS.AllowedOrigins = []string{"*"}
+	}
+	return cfg
+}
+
+// Validate reports every invalid setting
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Server.Host != "", "server.host", "must be set")
+	check(c.Server.Port > 0 && c.Server.Port < 1<<16, "server.port", "%d is not a port", c.Server.Port)
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	check(c.Database.Pool >= 0, "database.pool", "must not be negative")
+	check(c.Database.IdlePool >= 0, "database.idle_pool", "must not be negative")
+	check(c.Database.Pool == 0 || c.Database.IdlePool <= c.Database.Pool, "database.idle_pool", "must not exceed database.pool")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "must not be negative")
+	check(c.Database.StatementTimeout >= 0, "database.statement_timeout", "must not be negative")
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout", "must not be negative")
+	for _, replica := range c.Database.ReplicaURLs {
+		u, err := url.Parse(replica)
+		check(err == nil && u.Scheme != "", "database.replica_urls", "is not a list of URLs")
+	}
+	if len(c.Database.ReplicaURLs) > 0 {
+		check(c.Database.ReplicaCheckInterval > 0, "database.replica_check_interval", "must be positive")
+		check(c.Database.PrimaryAfterWrite >= c.Database.ReplicaMaxLag, "database.primary_after_write",
+			"must be at least database.replica_max_lag, or clients may not read their writes")
+	}
+	if c.Database.URL != "" {
+		u, err := url.Parse(c.Database.URL)
+		check(err == nil && u.Scheme != "", "database.url", "is not a URL")
+	}
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret", "must be set")
+	if c.Env == "production" {
+		check(c.Auth.JWTSecret != DevelopmentJWTSecret, "auth.jwt_secret", "the development secret cannot be used in production")
+		check(len(c.Auth.JWTSecret) >= minJWTSecret, "auth.jwt_secret", "must be at least %d bytes in production", minJWTSecret)
+	}
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl", "must be positive")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"auth.bcrypt_cost", "must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if err := validOrigin(origin); err != nil {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins: %w", err))
+		}
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowed_origins", "\"*\" cannot be combined with cors.allow_credentials")
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age", "must not be negative")
+
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age", "must not be negative")
+	check(oneOf(strings.ToUpper(c.Security.FrameOptions), "DENY", "SAMEORIGIN"),
+		"security.frame_options", "%q is neither DENY nor SAMEORIGIN", c.Security.FrameOptions)
+
+	check(oneOf(c.RateLimit.Store, "memory", "redis", "postgres"), "rate_limit.store", "unknown store %q", c.RateLimit.Store)
+	if c.RateLimit.Store == "redis" {
+		u, err := url.Parse(c.RateLimit.RedisURL)
+		check(err == nil && (u.Scheme == "redis" || u.Scheme == "rediss"), "rate_limit.redis_url", "is not a redis:// or rediss:// URL")
+	}
+	check(c.RateLimit.Auth.Requests > 0 && c.RateLimit.Auth.Period > 0, "rate_limit.auth", "must be set")
+	check(c.RateLimit.Auth.Period <= 0 || c.RateLimit.Auth.Period >= ratelimit.MinPeriod, "rate_limit.auth", "must have a period of at least %s", ratelimit.MinPeriod)
+	check(c.RateLimit.API.Requests > 0 && c.RateLimit.API.Period > 0, "rate_limit.api", "must be set")
+	check(c.RateLimit.API.Period <= 0 || c.RateLimit.API.Period >= ratelimit.MinPeriod, "rate_limit.api", "must have a period of at least %s", ratelimit.MinPeriod)
+
+	check(c.Telemetry.ServiceName != "", "telemetry.service_name", "must be set")
+	check(oneOf(c.Telemetry.Exporter, "none", "otlp", "stdout", "file"), "telemetry.exporter", "unknown exporter %q", c.Telemetry.Exporter)
+	check(c.Telemetry.Exporter != "file" || c.Telemetry.File != "", "telemetry.file", "must be set with the file exporter")
+
+	check(c.Secrets.Refresh >= 0, "secrets.refresh", "must not be negative")
+
+	check(oneOf(c.Flags.Store, "memory", "postgres"), "flags.store", "unknown store %q", c.Flags.Store)
+	check(oneOf(c.Maintenance.Store, "memory", "postgres"), "maintenance.store", "unknown store %q", c.Maintenance.Store)
+	check(oneOf(c.Maintenance.Mode, "off", "read_only", "offline"), "maintenance.mode", "unknown mode %q", c.Maintenance.Mode)
+	check(c.Maintenance.RetryAfter >= 0, "maintenance.retry_after", "must not be negative")
+	if _, err := c.Maintenance.Networks(); err != nil {
+		check(false, "maintenance.allowed_ips", "%v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// oneOf reports whether s is one of values
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validOrigin checks origin is "*" or scheme://host[:port], with at most
+// one "*" standing for subdomains
+func validOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("%q has more than one wildcard", origin)
+	}
+	u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("%q is not an origin such as https://app.example.com", origin)
+	}
+	if strings.Contains(origin, "*") && !strings.HasPrefix(u.Host, "wildcard.") {
+		return fmt.Errorf("%q: a wildcard may only stand for subdomains, as in https://*.example.com", origin)
+	}
+	return nil
+}
+
+var (
+	mu      sync.Mutex
+	current *Config
+)
+
+// Get returns the configuration installed by Set. Before that, as in
+// tests and package initialisation, it loads the configuration without
+// flags once and exits if that fails.
+func Get() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		cfg, err := Load(nil)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		current = cfg
+	}
+	return current
+}
+
+// Set installs cfg as the configuration returned by Get
+func Set(cfg *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = cfg
+}
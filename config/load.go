@@ -0,0 +1,355 @@
+package config
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/secrets"
+	"github.com/gobuffalo/envy"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a configurable field of Config
+type setting struct {
+	// Key is the dotted path of the field, as in files and flags
+	Key string
+	// Env is the environment variable setting the field, if any
+	Env    string
+	Secret bool
+	// Flag reports whether the field can be set with a flag
+	Flag  bool
+	value reflect.Value
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// settings lists the configurable fields of cfg
+func settings(cfg *Config) []setting {
+	var list []setting
+	var walk func(v reflect.Value, prefix string, flags bool)
+	walk = func(v reflect.Value, prefix string, flags bool) {
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.Tag.Get("config") == "-" {
+				continue
+			}
+			key := prefix + f.Tag.Get("yaml")
+			canFlag := flags && f.Tag.Get("flag") != "-"
+			if f.Type.Kind() == reflect.Struct && !reflect.PointerTo(f.Type).Implements(textUnmarshalerType) {
+				walk(v.Field(i), key+".", canFlag)
+				continue
+			}
+			env := f.Tag.Get("env")
+			if testEnv := f.Tag.Get("test_env"); testEnv != "" && cfg.Env == "test" {
+				env = testEnv
+			}
+			list = append(list, setting{
+				Key:    key,
+				Env:    env,
+				Secret: f.Tag.Get("secret") == "true",
+				Flag:   canFlag,
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "", true)
+	return list
+}
+
+// set parses s into the field of st. Lists are comma separated.
+func (st setting) set(s string) error {
+	v := st.value
+	if v.Kind() == reflect.Slice {
+		return st.setList(splitList(s))
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// setList sets a list field to items
+func (st setting) setList(items []string) error {
+	if st.value.Kind() != reflect.Slice {
+		return fmt.Errorf("%s takes a single value, not a list", st.Key)
+	}
+	st.value.Set(reflect.ValueOf(items))
+	return nil
+}
+
+// Load returns the defaults of GO_ENV overridden, in order, by the file
+// named by the -config flag or CONFIG_FILE, environment variables and
+// flags such as -server.port=8080 parsed from args. A variable NAME may be
+// set as NAME_FILE, the path of a file holding the value. Secret settings
+// are then looked up in the provider configured by Secrets. The
+// configuration is not validated.
+func Load(args []string) (*Config, error) {
+	return LoadContext(context.Background(), args)
+}
+
+// LoadContext is Load with ctx bounding secret lookups
+func LoadContext(ctx context.Context, args []string) (*Config, error) {
+	cfg := Defaults(envy.Get("GO_ENV", "development"))
+	cfg.args = args
+	list := settings(cfg)
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", envy.Get("CONFIG_FILE", ""), "YAML or TOML configuration file")
+	flags := map[string]*flagValue{}
+	for _, st := range list {
+		if st.Flag {
+			flags[st.Key] = &flagValue{isBool: st.value.Kind() == reflect.Bool}
+			fs.Var(flags[st.Key], st.Key, "")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, list); err != nil {
+			return nil, err
+		}
+	}
+	for _, st := range list {
+		if st.Env == "" {
+			continue
+		}
+		s, ok, err := lookupEnv(st.Env)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := st.set(s); err != nil {
+			return nil, fmt.Errorf("%s: %w", st.Env, err)
+		}
+	}
+	for _, st := range list {
+		if f, ok := flags[st.Key]; ok && f.set {
+			if err := st.set(f.raw); err != nil {
+				return nil, fmt.Errorf("flag -%s: %w", st.Key, err)
+			}
+		}
+	}
+	if err := loadSecrets(ctx, cfg.Secrets, list, flags); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Reload loads the configuration again, with the flags c was loaded with,
+// picking up rotated secrets
+func (c *Config) Reload(ctx context.Context) (*Config, error) {
+	return LoadContext(ctx, c.args)
+}
+
+// lookupEnv returns the value of the variable name or, when name_FILE is
+// set instead, the content of that file
+func lookupEnv(name string) (string, bool, error) {
+	v, err := envy.MustGet(name)
+	set := err == nil
+	path, err := envy.MustGet(name + "_FILE")
+	if err != nil {
+		return v, set, nil
+	}
+	if set {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	}
+	if v, err = secrets.ReadFile(path); err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return v, true, nil
+}
+
+// loadSecrets sets the secret settings found in the provider of s, but
+// those set by flags. The settings of the provider itself are not looked
+// up.
+func loadSecrets(ctx context.Context, s Secrets, list []setting, flags map[string]*flagValue) error {
+	if s.Provider == "env" {
+		return nil
+	}
+	provider, err := s.provider()
+	if err != nil {
+		return err
+	}
+	for _, st := range list {
+		if !st.Secret || st.Env == "" || strings.HasPrefix(st.Key, "secrets.") {
+			continue
+		}
+		if f, ok := flags[st.Key]; ok && f.set {
+			continue
+		}
+		v, err := provider.Get(ctx, st.Env)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", st.Key, err)
+		}
+		if err := st.set(v); err != nil {
+			return fmt.Errorf("%s from the %s provider: %w", st.Env, s.Provider, err)
+		}
+	}
+	return nil
+}
+
+// provider returns the secrets provider s configures
+func (s Secrets) provider() (secrets.Provider, error) {
+	switch s.Provider {
+	case "env":
+		return secrets.EnvProvider{}, nil
+	case "file":
+		if s.Dir == "" {
+			return nil, errors.New("secrets.dir: must be set with the file provider")
+		}
+		return secrets.FileProvider{Dir: s.Dir}, nil
+	case "encrypted":
+		if s.Path == "" || s.AgeIdentity == "" {
+			return nil, errors.New("secrets.path and secrets.age_identity: must be set with the encrypted provider")
+		}
+		return secrets.NewEncryptedFileProvider(s.Path, s.AgeIdentity)
+	case "vault":
+		if s.VaultAddr == "" || s.VaultToken == "" || s.VaultPath == "" {
+			return nil, errors.New("secrets.vault_addr, secrets.vault_token and secrets.vault_path: must be set with the vault provider")
+		}
+		return &secrets.VaultProvider{Addr: s.VaultAddr, Token: s.VaultToken, Mount: s.VaultMount, Path: s.VaultPath}, nil
+	default:
+		return nil, fmt.Errorf("secrets.provider: unknown provider %q", s.Provider)
+	}
+}
+
+// flagValue records the value of a flag, applied after the file and env
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.raw }
+
+func (f *flagValue) Set(s string) error {
+	f.raw, f.set = s, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// loadFile applies the settings of a .yaml, .yml or .toml file. Unknown
+// keys are errors, so that typos do not go unnoticed.
+func loadFile(path string, list []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc := map[string]interface{}{}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("%s: unsupported configuration format %q", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	byKey := map[string]setting{}
+	for _, st := range list {
+		byKey[st.Key] = st
+	}
+	values := map[string]interface{}{}
+	flatten(doc, "", values)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		st, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if items, ok := values[key].([]interface{}); ok {
+			list := make([]string, len(items))
+			for i, item := range items {
+				list[i] = fmt.Sprint(item)
+			}
+			err = st.setList(list)
+		} else {
+			err = st.set(fmt.Sprint(values[key]))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// flatten collects the leaves of doc into values, keyed by dotted path
+func flatten(doc map[string]interface{}, prefix string, values map[string]interface{}) {
+	for k, v := range doc {
+		if section, ok := v.(map[string]interface{}); ok {
+			flatten(section, prefix+k+".", values)
+			continue
+		}
+		values[prefix+k] = v
+	}
+}
+
+// splitList splits a comma separated list, dropping blank entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
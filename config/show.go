@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mask replaces secrets
+const mask = "********"
+
+// Masked returns a copy of c with secrets masked. URLs keep everything
+// but their password, shown as "xxxxx".
+func (c *Config) Masked() *Config {
+	masked := *c
+	for _, st := range settings(&masked) {
+		switch {
+		case !st.Secret:
+		case st.value.Kind() == reflect.Slice:
+			list := make([]string, st.value.Len())
+			for i := range list {
+				list[i] = maskSecret(st.value.Index(i).String())
+			}
+			st.value.Set(reflect.ValueOf(list))
+		case st.value.String() != "":
+			st.value.SetString(maskSecret(st.value.String()))
+		}
+	}
+	return &masked
+}
+
+// maskSecret masks s, or only the password of a URL
+func maskSecret(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return mask
+	}
+	return u.Redacted()
+}
+
+// Show writes c as YAML with secrets masked
+func (c *Config) Show(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Masked()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
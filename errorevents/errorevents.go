@@ -0,0 +1,179 @@
+// Package errorevents groups the panics of the API by fingerprint, keeping
+// how often each happened, when it was first and last seen and the stack
+// of its latest occurrence.
+package errorevents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown fingerprints
+var ErrNotFound = errors.New("errorevents: event not found")
+
+// maxMessage and maxStack bound what is kept of an occurrence
+const (
+	maxMessage = 1 << 10
+	maxStack   = 16 << 10
+)
+
+// fingerprintFrames is how many frames below the panic make up the
+// fingerprint
+const fingerprintFrames = 8
+
+// Occurrence is one panic
+type Occurrence struct {
+	Fingerprint string
+	// Type is the Go type of the panic value
+	Type    string
+	Message string
+	Stack   string
+	// Route is the "METHOD /path" of the route that panicked
+	Route     string
+	RequestID string
+	At        time.Time
+}
+
+// Event groups the occurrences of a fingerprint. Message, Stack, Route and
+// LastRequestID are those of the latest occurrence.
+type Event struct {
+	Fingerprint   string    `json:"fingerprint" db:"fingerprint"`
+	Type          string    `json:"type" db:"type"`
+	Message       string    `json:"message" db:"message"`
+	Stack         string    `json:"stack" db:"stack"`
+	Route         string    `json:"route" db:"route"`
+	LastRequestID string    `json:"last_request_id" db:"last_request_id"`
+	Count         int64     `json:"count" db:"count"`
+	FirstSeen     time.Time `json:"first_seen" db:"first_seen"`
+	LastSeen      time.Time `json:"last_seen" db:"last_seen"`
+}
+
+// Store keeps events
+type Store interface {
+	// Record adds occ to the event of its fingerprint, creating it on the
+	// first occurrence
+	Record(ctx context.Context, occ Occurrence) error
+	// List returns up to limit events, the most recently seen first
+	List(ctx context.Context, limit int) ([]Event, error)
+	// Get returns the event of fingerprint, or ErrNotFound
+	Get(ctx context.Context, fingerprint string) (*Event, error)
+}
+
+// Capture describes the panic with value v. It must be called from the
+// deferred function that recovered v, while the stack still holds the
+// panicking frames.
+func Capture(v interface{}) Occurrence {
+	occ := Occurrence{
+		Type:  fmt.Sprintf("%T", v),
+		Stack: truncate(string(debug.Stack()), maxStack),
+		At:    time.Now(),
+	}
+	if err, ok := v.(error); ok {
+		occ.Message = err.Error()
+	} else {
+		occ.Message = fmt.Sprint(v)
+	}
+	occ.Message = truncate(occ.Message, maxMessage)
+
+	pcs := make([]uintptr, 64)
+	occ.Fingerprint = Fingerprint(occ.Type, panicFrames(pcs[:runtime.Callers(2, pcs)]))
+	return occ
+}
+
+// panicFrames returns the functions below runtime.gopanic, leaving out the
+// runtime functions that raise runtime errors
+func panicFrames(pcs []uintptr) []string {
+	var funcs []string
+	panicking := false
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		switch {
+		case f.Function == "runtime.gopanic":
+			panicking = true
+		case panicking && !strings.HasPrefix(f.Function, "runtime."):
+			funcs = append(funcs, f.Function)
+		}
+		if !more || len(funcs) == fingerprintFrames {
+			return funcs
+		}
+	}
+}
+
+// Fingerprint identifies a panic by the type of its value and the
+// functions it went through. Messages and line numbers are left out: they
+// vary between occurrences and deployments of the same bug.
+func Fingerprint(typ string, funcs []string) string {
+	sum := sha256.Sum256([]byte(typ + "\n" + strings.Join(funcs, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// truncate cuts s to at most n bytes, dropping a rune split by the cut:
+// Postgres rejects invalid UTF-8
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// MemoryStore keeps events in process memory, for tests and development
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[string]*Event
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: map[string]*Event{}}
+}
+
+// Record adds occ to its event
+func (s *MemoryStore) Record(_ context.Context, occ Occurrence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.events[occ.Fingerprint]
+	if !ok {
+		e = &Event{Fingerprint: occ.Fingerprint, Type: occ.Type, FirstSeen: occ.At}
+		s.events[occ.Fingerprint] = e
+	}
+	e.Count++
+	e.Message, e.Stack, e.Route, e.LastRequestID, e.LastSeen = occ.Message, occ.Stack, occ.Route, occ.RequestID, occ.At
+	return nil
+}
+
+// List returns the most recently seen events
+func (s *MemoryStore) List(_ context.Context, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]Event, 0, len(s.events))
+	for _, e := range s.events {
+		events = append(events, *e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].LastSeen.After(events[j].LastSeen) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// Get returns the event of fingerprint
+func (s *MemoryStore) Get(_ context.Context, fingerprint string) (*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.events[fingerprint]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *e
+	return &cp, nil
+}
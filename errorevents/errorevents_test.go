@@ -0,0 +1,110 @@
+package errorevents
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore runs the behaviour every store must share
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	occ := func(fp, requestID string, at time.Duration) Occurrence {
+		return Occurrence{
+			Fingerprint: fp, Type: "*errors.errorString", Message: "boom " + requestID, Stack: "goroutine 1",
+			Route: "GET /boom", RequestID: requestID, At: start.Add(at),
+		}
+	}
+
+	require.NoError(t, s.Record(ctx, occ("fp1", "r1", 0)))
+	require.NoError(t, s.Record(ctx, occ("fp2", "r2", time.Second)))
+	require.NoError(t, s.Record(ctx, occ("fp1", "r3", 2*time.Second)))
+
+	e, err := s.Get(ctx, "fp1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), e.Count)
+	assert.Equal(t, "r3", e.LastRequestID)
+	assert.Equal(t, "boom r3", e.Message)
+	assert.True(t, start.Equal(e.FirstSeen), "first seen")
+	assert.True(t, start.Add(2*time.Second).Equal(e.LastSeen), "last seen")
+
+	events, err := s.List(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "fp1", events[0].Fingerprint, "most recently seen first")
+
+	events, err = s.List(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	_, err = s.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestPostgresStore(t *testing.T) {
+	modelstest.DB(t)
+	require.NoError(t, models.DB.RawQuery("DELETE FROM error_events").Exec())
+	testStore(t, NewPostgresStore(models.DB))
+}
+
+// capture returns the occurrence of the panic raised by f
+func capture(f func()) (occ Occurrence) {
+	defer func() {
+		occ = Capture(recover())
+	}()
+	f()
+	return
+}
+
+func indexOutOfRange(s []int, i int) int { return s[i] }
+
+func failWith(msg string) { panic(errors.New(msg)) }
+
+func TestCapture(t *testing.T) {
+	var occs []Occurrence
+	for i := 5; i < 7; i++ {
+		occs = append(occs, capture(func() { indexOutOfRange([]int{1}, i) }))
+	}
+	a, b := occs[0], occs[1]
+	assert.Equal(t, a.Fingerprint, b.Fingerprint, "messages do not split events")
+	assert.Equal(t, "runtime.boundsError", a.Type)
+	assert.Contains(t, a.Message, "index out of range [5]")
+	assert.Contains(t, a.Stack, "indexOutOfRange")
+
+	c := capture(func() { failWith("boom") })
+	assert.NotEqual(t, a.Fingerprint, c.Fingerprint)
+	assert.Equal(t, "*errors.errorString", c.Type)
+	assert.Equal(t, "boom", c.Message)
+
+	d := capture(func() { panic("boom") })
+	assert.NotEqual(t, c.Fingerprint, d.Fingerprint, "a different site and type")
+	assert.Equal(t, "string", d.Type)
+}
+
+func TestCapture_Truncates_On_Rune_Boundaries(t *testing.T) {
+	// an odd prefix puts the cut in the middle of a two byte rune
+	occ := capture(func() { failWith("x" + strings.Repeat("é", maxMessage)) })
+	assert.True(t, utf8.ValidString(occ.Message))
+	assert.Equal(t, "x"+strings.Repeat("é", maxMessage/2-1), occ.Message)
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("string", []string{"main.handler"})
+	assert.Len(t, a, 16)
+	assert.Equal(t, a, Fingerprint("string", []string{"main.handler"}))
+	assert.NotEqual(t, a, Fingerprint("error", []string{"main.handler"}))
+	assert.NotEqual(t, a, Fingerprint("string", []string{"main.other"}))
+}
@@ -0,0 +1,73 @@
+package errorevents
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// PostgresStore keeps events in the error_events table
+type PostgresStore struct {
+	db *pop.Connection
+	// read returns the connection List and Get read from
+	read func(ctx context.Context) *pop.Connection
+}
+
+// NewPostgresStore returns a PostgresStore on db
+func NewPostgresStore(db *pop.Connection) *PostgresStore {
+	s := &PostgresStore{db: db}
+	s.read = func(ctx context.Context) *pop.Connection { return s.db.WithContext(ctx) }
+	return s
+}
+
+// ReadFrom makes List and Get read from the connection read returns for
+// their context, such as a read replica, and returns s
+func (s *PostgresStore) ReadFrom(read func(ctx context.Context) *pop.Connection) *PostgresStore {
+	s.read = read
+	return s
+}
+
+// Record adds occ to its event in a single upsert, so concurrent panics
+// of replicas are all counted
+func (s *PostgresStore) Record(ctx context.Context, occ Occurrence) error {
+	err := s.db.WithContext(ctx).RawQuery(`INSERT INTO error_events
+			(fingerprint, type, message, stack, route, last_request_id, count, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT (fingerprint) DO UPDATE SET count = error_events.count + 1,
+			message = EXCLUDED.message, stack = EXCLUDED.stack, route = EXCLUDED.route,
+			last_request_id = EXCLUDED.last_request_id,
+			last_seen = GREATEST(error_events.last_seen, EXCLUDED.last_seen)`,
+		occ.Fingerprint, occ.Type, occ.Message, occ.Stack, occ.Route, occ.RequestID, occ.At, occ.At).Exec()
+	if err != nil {
+		return fmt.Errorf("errorevents: postgres: %w", err)
+	}
+	return nil
+}
+
+// List returns the most recently seen events
+func (s *PostgresStore) List(ctx context.Context, limit int) ([]Event, error) {
+	events := []Event{}
+	err := s.read(ctx).RawQuery(`SELECT fingerprint, type, message, stack, route, last_request_id, count, first_seen, last_seen
+		FROM error_events ORDER BY last_seen DESC LIMIT ?`, limit).All(&events)
+	if err != nil {
+		return nil, fmt.Errorf("errorevents: postgres: %w", err)
+	}
+	return events, nil
+}
+
+// Get returns the event of fingerprint
+func (s *PostgresStore) Get(ctx context.Context, fingerprint string) (*Event, error) {
+	var e Event
+	err := s.read(ctx).RawQuery(`SELECT fingerprint, type, message, stack, route, last_request_id, count, first_seen, last_seen
+		FROM error_events WHERE fingerprint = ?`, fingerprint).First(&e)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errorevents: postgres: %w", err)
+	}
+	return &e, nil
+}
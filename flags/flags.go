@@ -0,0 +1,241 @@
+// Package flags turns features on at runtime, for everyone, for chosen
+// users, roles or organizations, or for a stable percentage of users, so
+// features can ship dark and roll out gradually.
+package flags
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	// ErrNotFound is returned for unknown keys
+	ErrNotFound = errors.New("flags: flag not found")
+	// ErrExists is returned when creating a flag whose key is taken
+	ErrExists = errors.New("flags: flag exists")
+)
+
+// KeyPattern is the format of flag keys, such as "checkout.new-flow"
+var KeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Flag is a feature switch. A disabled flag is off for everyone. An
+// enabled flag is on for the listed users, roles and orgs, and for
+// Percentage percent of the other users.
+type Flag struct {
+	Key         string      `json:"key" db:"key"`
+	Description string      `json:"description" db:"description"`
+	Enabled     bool        `json:"enabled" db:"enabled"`
+	Users       []uuid.UUID `json:"users" db:"-"`
+	Roles       []string    `json:"roles" db:"-"`
+	Orgs        []string    `json:"orgs" db:"-"`
+	// Percentage of users, 0 to 100, the flag is on for. 100 includes
+	// anonymous requests.
+	Percentage int       `json:"percentage" db:"percentage"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Subject is who a flag is evaluated for. The zero Subject is an
+// anonymous request.
+type Subject struct {
+	UserID uuid.UUID
+	Role   string
+	Org    string
+}
+
+// On reports whether f is on for s
+func (f *Flag) On(s Subject) bool {
+	switch {
+	case !f.Enabled:
+		return false
+	case f.Percentage >= 100:
+		return true
+	case s.UserID == uuid.Nil:
+		return false
+	}
+	for _, id := range f.Users {
+		if id == s.UserID {
+			return true
+		}
+	}
+	if s.Role != "" && contains(f.Roles, s.Role) {
+		return true
+	}
+	if s.Org != "" && contains(f.Orgs, s.Org) {
+		return true
+	}
+	return Bucket(f.Key, s.UserID) < f.Percentage
+}
+
+// Bucket places userID in one of 100 buckets for key. The bucket depends
+// on nothing else, so a user stays in or out of a rollout on every replica
+// and across restarts, and raising the percentage only adds users. Flags
+// hash differently, so the same users are not always the first to get a
+// feature.
+func Bucket(key string, userID uuid.UUID) int {
+	sum := sha256.Sum256(append([]byte(key+"\x00"), userID.Bytes()...))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// normalize replaces missing lists of f with empty ones
+func (f *Flag) normalize() {
+	if f.Users == nil {
+		f.Users = []uuid.UUID{}
+	}
+	if f.Roles == nil {
+		f.Roles = []string{}
+	}
+	if f.Orgs == nil {
+		f.Orgs = []string{}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps flags
+type Store interface {
+	// List returns every flag, ordered by key
+	List(ctx context.Context) ([]Flag, error)
+	// Get returns the flag of key, or ErrNotFound
+	Get(ctx context.Context, key string) (*Flag, error)
+	// Create adds f, or returns ErrExists. The timestamps of f are set.
+	Create(ctx context.Context, f *Flag) error
+	// Update replaces the flag of f.Key, or returns ErrNotFound. The
+	// timestamps of f are set.
+	Update(ctx context.Context, f *Flag) error
+	// Delete removes the flag of key, or returns ErrNotFound
+	Delete(ctx context.Context, key string) error
+}
+
+// Cache evaluates flags from memory, so checking a flag costs no query.
+// Refresh it when the store changes. It is safe for concurrent use.
+type Cache struct {
+	store Store
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewCache returns an empty cache of store; call Refresh to fill it
+func NewCache(store Store) *Cache {
+	return &Cache{store: store, flags: map[string]Flag{}}
+}
+
+// Store returns the store c caches
+func (c *Cache) Store() Store {
+	return c.store
+}
+
+// Refresh loads every flag from the store. On error the cache keeps the
+// flags it had.
+func (c *Cache) Refresh(ctx context.Context) error {
+	list, err := c.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	flags := make(map[string]Flag, len(list))
+	for _, f := range list {
+		flags[f.Key] = f
+	}
+	c.mu.Lock()
+	c.flags = flags
+	c.mu.Unlock()
+	return nil
+}
+
+// On reports whether the flag of key is on for s. Unknown flags are off.
+func (c *Cache) On(key string, s Subject) bool {
+	c.mu.RLock()
+	f, ok := c.flags[key]
+	c.mu.RUnlock()
+	return ok && f.On(s)
+}
+
+// MemoryStore keeps flags in process memory, for tests and development
+type MemoryStore struct {
+	mu    sync.Mutex
+	flags map[string]Flag
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: map[string]Flag{}}
+}
+
+// List returns every flag
+func (s *MemoryStore) List(_ context.Context) ([]Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// Get returns the flag of key
+func (s *MemoryStore) Get(_ context.Context, key string) (*Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+// Create adds f
+func (s *MemoryStore) Create(_ context.Context, f *Flag) error {
+	f.normalize()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.flags[f.Key]; ok {
+		return ErrExists
+	}
+	f.CreatedAt = time.Now().UTC()
+	f.UpdatedAt = f.CreatedAt
+	s.flags[f.Key] = *f
+	return nil
+}
+
+// Update replaces the flag of f.Key
+func (s *MemoryStore) Update(_ context.Context, f *Flag) error {
+	f.normalize()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.flags[f.Key]
+	if !ok {
+		return ErrNotFound
+	}
+	f.CreatedAt = old.CreatedAt
+	f.UpdatedAt = time.Now().UTC()
+	s.flags[f.Key] = *f
+	return nil
+}
+
+// Delete removes the flag of key
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.flags[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.flags, key)
+	return nil
+}
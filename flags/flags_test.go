@@ -0,0 +1,163 @@
+package flags
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/pgnotify"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func users(n int) []uuid.UUID {
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.Must(uuid.NewV4())
+	}
+	return ids
+}
+
+func TestFlag_On(t *testing.T) {
+	alice, bob := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	f := &Flag{Key: "beta", Enabled: true, Users: []uuid.UUID{alice}, Roles: []string{"admin"}, Orgs: []string{"acme"}}
+
+	assert.True(t, f.On(Subject{UserID: alice}), "listed user")
+	assert.True(t, f.On(Subject{UserID: bob, Role: "admin"}), "listed role")
+	assert.True(t, f.On(Subject{UserID: bob, Org: "acme"}), "listed org")
+	assert.False(t, f.On(Subject{UserID: bob, Role: "user", Org: "other"}))
+	assert.False(t, f.On(Subject{Role: "admin"}), "anonymous requests are not targeted")
+
+	f.Enabled = false
+	assert.False(t, f.On(Subject{UserID: alice}), "disabled flags are off for everyone")
+
+	f = &Flag{Key: "everyone", Enabled: true, Percentage: 100}
+	assert.True(t, f.On(Subject{}), "100% includes anonymous requests")
+}
+
+func TestFlag_On_Percentage(t *testing.T) {
+	ids := users(2000)
+	on := func(f *Flag) map[uuid.UUID]bool {
+		set := map[uuid.UUID]bool{}
+		for _, id := range ids {
+			if f.On(Subject{UserID: id}) {
+				set[id] = true
+			}
+		}
+		return set
+	}
+
+	ten := on(&Flag{Key: "rollout", Enabled: true, Percentage: 10})
+	assert.InDelta(t, 200, len(ten), 60, "about 10%% of users")
+	assert.Equal(t, ten, on(&Flag{Key: "rollout", Enabled: true, Percentage: 10}), "stable")
+
+	fifty := on(&Flag{Key: "rollout", Enabled: true, Percentage: 50})
+	for id := range ten {
+		assert.True(t, fifty[id], "raising the percentage keeps users in")
+	}
+	assert.NotEqual(t, ten, on(&Flag{Key: "other", Enabled: true, Percentage: 10}), "flags hash differently")
+	assert.Empty(t, on(&Flag{Key: "rollout", Enabled: true}))
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	cache := NewCache(store)
+	require.NoError(t, store.Create(ctx, &Flag{Key: "beta", Enabled: true, Roles: []string{"admin"}}))
+
+	admin := Subject{UserID: uuid.Must(uuid.NewV4()), Role: "admin"}
+	assert.False(t, cache.On("beta", admin), "not refreshed yet")
+	require.NoError(t, cache.Refresh(ctx))
+	assert.True(t, cache.On("beta", admin))
+	assert.False(t, cache.On("unknown", admin))
+
+	require.NoError(t, store.Delete(ctx, "beta"))
+	require.NoError(t, cache.Refresh(ctx))
+	assert.False(t, cache.On("beta", admin))
+}
+
+// testStore runs the behaviour every store must share
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := uuid.Must(uuid.NewV4())
+
+	f := &Flag{Key: "beta", Description: "Beta features", Enabled: true, Users: []uuid.UUID{id}, Percentage: 5}
+	require.NoError(t, s.Create(ctx, f))
+	assert.False(t, f.CreatedAt.IsZero())
+	assert.Equal(t, []string{}, f.Roles, "lists are never null")
+	assert.ErrorIs(t, s.Create(ctx, &Flag{Key: "beta"}), ErrExists)
+	require.NoError(t, s.Create(ctx, &Flag{Key: "alpha"}))
+
+	got, err := s.Get(ctx, "beta")
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{id}, got.Users)
+	assert.Equal(t, 5, got.Percentage)
+
+	time.Sleep(time.Millisecond)
+	update := &Flag{Key: "beta", Roles: []string{"admin"}, Orgs: []string{"acme"}}
+	require.NoError(t, s.Update(ctx, update))
+	assert.True(t, f.CreatedAt.Equal(update.CreatedAt), "created at is kept")
+	assert.True(t, update.UpdatedAt.After(f.UpdatedAt))
+	got, err = s.Get(ctx, "beta")
+	require.NoError(t, err)
+	assert.False(t, got.Enabled)
+	assert.Equal(t, []uuid.UUID{}, got.Users, "updates replace the flag")
+	assert.Equal(t, []string{"acme"}, got.Orgs)
+	assert.ErrorIs(t, s.Update(ctx, &Flag{Key: "missing"}), ErrNotFound)
+
+	list, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "alpha", list[0].Key, "ordered by key")
+
+	require.NoError(t, s.Delete(ctx, "beta"))
+	assert.ErrorIs(t, s.Delete(ctx, "beta"), ErrNotFound)
+	_, err = s.Get(ctx, "beta")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestPostgresStore(t *testing.T) {
+	modelstest.DB(t)
+	require.NoError(t, models.DB.RawQuery("DELETE FROM feature_flags").Exec())
+	testStore(t, NewPostgresStore(models.DB))
+}
+
+func TestPostgresStore_Notifies(t *testing.T) {
+	modelstest.DB(t)
+	require.NoError(t, models.DB.RawQuery("DELETE FROM feature_flags").Exec())
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- pgnotify.Listen(ctx, models.DB.URL(), Channel, func(key string) { changes <- key })
+	}()
+
+	receive := func() string {
+		select {
+		case key := <-changes:
+			return key
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+			return ""
+		}
+	}
+	assert.Equal(t, "", receive(), "listening")
+
+	// Another replica changes a flag
+	store := NewPostgresStore(models.DB)
+	require.NoError(t, store.Create(ctx, &Flag{Key: "beta"}))
+	assert.Equal(t, "beta", receive())
+	assert.ErrorIs(t, store.Create(ctx, &Flag{Key: "beta"}), ErrExists)
+	require.NoError(t, store.Delete(ctx, "beta"))
+	assert.Equal(t, "beta", receive(), "failed changes are not notified")
+
+	cancel()
+	assert.NoError(t, <-done)
+}
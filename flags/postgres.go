@@ -0,0 +1,162 @@
+package flags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/pop/v6/slices"
+)
+
+// Channel is the Postgres notification channel PostgresStore announces
+// changes on; the payload is the key of the changed flag
+const Channel = "flags_changed"
+
+// PostgresStore keeps flags in the feature_flags table and notifies
+// Channel of every change
+type PostgresStore struct {
+	db *pop.Connection
+}
+
+// NewPostgresStore returns a PostgresStore on db
+func NewPostgresStore(db *pop.Connection) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// row is a feature_flags row; the lists are Postgres arrays
+type row struct {
+	Key         string        `db:"key"`
+	Description string        `db:"description"`
+	Enabled     bool          `db:"enabled"`
+	Users       slices.UUID   `db:"users"`
+	Roles       slices.String `db:"roles"`
+	Orgs        slices.String `db:"orgs"`
+	Percentage  int           `db:"percentage"`
+	CreatedAt   time.Time     `db:"created_at"`
+	UpdatedAt   time.Time     `db:"updated_at"`
+}
+
+func (r row) flag() Flag {
+	f := Flag{
+		Key: r.Key, Description: r.Description, Enabled: r.Enabled,
+		Users: r.Users, Roles: r.Roles, Orgs: r.Orgs, Percentage: r.Percentage,
+		CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+	}
+	f.normalize()
+	return f
+}
+
+// lists returns the lists of f as arrays, empty rather than NULL
+func lists(f *Flag) (slices.UUID, slices.String, slices.String) {
+	f.normalize()
+	return slices.UUID(f.Users), slices.String(f.Roles), slices.String(f.Orgs)
+}
+
+const selectFlags = `SELECT key, description, enabled, users, roles, orgs, percentage, created_at, updated_at
+	FROM feature_flags`
+
+// List returns every flag
+func (s *PostgresStore) List(ctx context.Context) ([]Flag, error) {
+	rows := []row{}
+	if err := s.db.WithContext(ctx).RawQuery(selectFlags + ` ORDER BY key`).All(&rows); err != nil {
+		return nil, fmt.Errorf("flags: postgres: %w", err)
+	}
+	list := make([]Flag, len(rows))
+	for i, r := range rows {
+		list[i] = r.flag()
+	}
+	return list, nil
+}
+
+// Get returns the flag of key
+func (s *PostgresStore) Get(ctx context.Context, key string) (*Flag, error) {
+	var r row
+	err := s.db.WithContext(ctx).RawQuery(selectFlags+` WHERE key = ?`, key).First(&r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("flags: postgres: %w", err)
+	}
+	f := r.flag()
+	return &f, nil
+}
+
+// Create adds f
+func (s *PostgresStore) Create(ctx context.Context, f *Flag) error {
+	now := time.Now().UTC()
+	users, roles, orgs := lists(f)
+	return s.change(ctx, f.Key, func(tx *pop.Connection) error {
+		n, err := tx.RawQuery(`INSERT INTO feature_flags
+				(key, description, enabled, users, roles, orgs, percentage, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (key) DO NOTHING`,
+			f.Key, f.Description, f.Enabled, users, roles, orgs, f.Percentage, now, now).ExecWithCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrExists
+		}
+		f.CreatedAt, f.UpdatedAt = now, now
+		return nil
+	})
+}
+
+// Update replaces the flag of f.Key
+func (s *PostgresStore) Update(ctx context.Context, f *Flag) error {
+	now := time.Now().UTC()
+	users, roles, orgs := lists(f)
+	return s.change(ctx, f.Key, func(tx *pop.Connection) error {
+		n, err := tx.RawQuery(`UPDATE feature_flags SET description = ?, enabled = ?, users = ?, roles = ?,
+				orgs = ?, percentage = ?, updated_at = ?
+			WHERE key = ?`,
+			f.Description, f.Enabled, users, roles, orgs, f.Percentage, now, f.Key).ExecWithCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		var r row
+		if err := tx.RawQuery(selectFlags+` WHERE key = ?`, f.Key).First(&r); err != nil {
+			return err
+		}
+		f.CreatedAt, f.UpdatedAt = r.CreatedAt, now
+		return nil
+	})
+}
+
+// Delete removes the flag of key
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.change(ctx, key, func(tx *pop.Connection) error {
+		n, err := tx.RawQuery(`DELETE FROM feature_flags WHERE key = ?`, key).ExecWithCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// change runs fn and notifies Channel of key in one transaction, so the
+// notification is sent if and only if the change commits
+func (s *PostgresStore) change(ctx context.Context, key string, fn func(tx *pop.Connection) error) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *pop.Connection) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.RawQuery(`SELECT pg_notify(?, ?)`, Channel, key).Exec()
+	})
+	if errors.Is(err, ErrExists) || errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("flags: postgres: %w", err)
+	}
+	return nil
+}
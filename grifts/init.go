@@ -1,11 +1,19 @@
 package grifts
 
 import (
+	"log"
+
 	"github.com/akingundogdu/production-ready-go-backend-architecture/actions"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
 
 	"github.com/gobuffalo/buffalo"
 )
 
 func init() {
+	// Tasks connect when they first query
+	if err := models.Open(config.Get()); err != nil {
+		log.Fatal(err)
+	}
 	buffalo.Grifts(actions.App())
 }
@@ -0,0 +1,109 @@
+// Package idempotency stores the responses of unsafe requests under the
+// Idempotency-Key chosen by the client, so retries replay the original
+// response instead of running the request again.
+package idempotency
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record is the state of a key. A record that is not Done belongs to a
+// request still in progress.
+type Record struct {
+	// Fingerprint identifies the request that claimed the key
+	Fingerprint string
+	Done        bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Store keeps records. Claims must be atomic: of two concurrent Begin
+// calls for a key only one may claim it.
+type Store interface {
+	// Begin claims key for the request with fingerprint until ttl passes.
+	// When the key is held by an unexpired record it returns that record
+	// and claimed is false.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (rec *Record, claimed bool, err error)
+	// Complete stores the response of the claiming request, kept for ttl
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release gives up a claim, e.g. after the request failed, so the
+	// request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// Fingerprint hashes the parts of a request that must match for a retry
+// to be replayed. Bodies may hold passwords and other secrets, so the hash
+// is an HMAC keyed with secret: stored fingerprints cannot be brute forced
+// without it.
+func Fingerprint(secret []byte, method, path string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sweepInterval is how often MemoryStore drops expired records
+const sweepInterval = time.Minute
+
+// MemoryStore keeps records in process memory, for single instance
+// deployments and tests
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}, now: time.Now}
+}
+
+// Begin claims key unless an unexpired record holds it
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string, ttl time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, rec := range s.records {
+			if !now.Before(rec.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if rec, ok := s.records[key]; ok && now.Before(rec.ExpiresAt) {
+		cp := *rec
+		return &cp, false, nil
+	}
+	s.records[key] = &Record{Fingerprint: fingerprint, ExpiresAt: now.Add(ttl)}
+	return nil, true, nil
+}
+
+// Complete stores the response for key
+func (s *MemoryStore) Complete(_ context.Context, key string, rec Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec.Done = true
+	rec.ExpiresAt = s.now().Add(ttl)
+	s.records[key] = &rec
+	return nil
+}
+
+// Release forgets key
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
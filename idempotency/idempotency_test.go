@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// testStore runs the behaviour every store must share
+func testStore(t *testing.T, s Store, c *clock) {
+	ctx := context.Background()
+
+	rec, claimed, err := s.Begin(ctx, "k1", "fp1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Nil(t, rec)
+
+	rec, claimed, err = s.Begin(ctx, "k1", "fp1", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.False(t, rec.Done, "in progress")
+	assert.Equal(t, "fp1", rec.Fingerprint)
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	require.NoError(t, s.Complete(ctx, "k1", Record{Fingerprint: "fp1", Status: 201, Header: header, Body: []byte(`{"id":1}`)}, time.Hour))
+
+	rec, claimed, err = s.Begin(ctx, "k1", "fp2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.True(t, rec.Done)
+	assert.Equal(t, "fp1", rec.Fingerprint)
+	assert.Equal(t, 201, rec.Status)
+	assert.Equal(t, header, rec.Header)
+	assert.Equal(t, `{"id":1}`, string(rec.Body))
+
+	c.t = c.t.Add(2 * time.Hour)
+	_, claimed, err = s.Begin(ctx, "k1", "fp2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed, "expired records are taken over")
+
+	require.NoError(t, s.Release(ctx, "k1"))
+	_, claimed, err = s.Begin(ctx, "k1", "fp3", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed, "released keys can be claimed again")
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := &clock{t: time.Now()}
+	s := NewMemoryStore()
+	s.now = c.now
+	testStore(t, s, c)
+}
+
+func TestPostgresStore(t *testing.T) {
+	modelstest.DB(t)
+	require.NoError(t, models.DB.RawQuery("DELETE FROM idempotency_keys").Exec())
+
+	c := &clock{t: time.Now().UTC().Truncate(time.Millisecond)}
+	s := NewPostgresStore(models.DB)
+	s.now = c.now
+	testStore(t, s, c)
+
+	c.t = c.t.Add(2 * time.Minute)
+	deleted, err := s.DeleteExpired(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestFingerprint(t *testing.T) {
+	secret := []byte("server-secret")
+	a := Fingerprint(secret, "POST", "/orders", []byte(`{"a":1}`))
+	assert.Equal(t, a, Fingerprint(secret, "POST", "/orders", []byte(`{"a":1}`)))
+	assert.NotEqual(t, a, Fingerprint(secret, "POST", "/orders", []byte(`{"a":2}`)))
+	assert.NotEqual(t, a, Fingerprint(secret, "POST", "/flags", []byte(`{"a":1}`)))
+	assert.NotEqual(t, a, Fingerprint([]byte("other-secret"), "POST", "/orders", []byte(`{"a":1}`)), "the hash depends on the secret")
+	sum := sha256.Sum256([]byte("POST /orders\n{\"a\":1}"))
+	assert.NotEqual(t, hex.EncodeToString(sum[:]), a, "not a bare hash")
+}
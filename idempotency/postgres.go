@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// PostgresStore keeps records in the idempotency_keys table, so retries
+// are recognised whichever replica they reach
+type PostgresStore struct {
+	db  *pop.Connection
+	now func() time.Time
+}
+
+// NewPostgresStore returns a PostgresStore on db
+func NewPostgresStore(db *pop.Connection) *PostgresStore {
+	return &PostgresStore{db: db, now: time.Now}
+}
+
+type postgresRecord struct {
+	Fingerprint string    `db:"fingerprint"`
+	Done        bool      `db:"done"`
+	Status      int       `db:"status"`
+	Headers     string    `db:"headers"`
+	Body        []byte    `db:"body"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Begin claims key unless an unexpired record holds it
+func (s *PostgresStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, bool, error) {
+	db := s.db.WithContext(ctx)
+	now := s.now()
+
+	// Insert, or take over an expired record; the WHERE clause makes the
+	// upsert a no-op while the record is live
+	var claimed string
+	err := db.RawQuery(`INSERT INTO idempotency_keys (key, fingerprint, done, status, headers, body, expires_at)
+		VALUES (?, ?, false, 0, '{}', '', ?)
+		ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, done = false, status = 0,
+			headers = '{}', body = '', expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= ?
+		RETURNING key`, key, fingerprint, now.Add(ttl), now).First(&claimed)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("idempotency: postgres: %w", err)
+	}
+
+	var row postgresRecord
+	err = db.RawQuery(`SELECT fingerprint, done, status, headers, body, expires_at
+		FROM idempotency_keys WHERE key = ?`, key).First(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the two statements: report it as in progress
+		// and let the client retry
+		return &Record{Fingerprint: fingerprint}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("idempotency: postgres: %w", err)
+	}
+
+	rec := &Record{
+		Fingerprint: row.Fingerprint,
+		Done:        row.Done,
+		Status:      row.Status,
+		Body:        row.Body,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if err := json.Unmarshal([]byte(row.Headers), &rec.Header); err != nil {
+		return nil, false, fmt.Errorf("idempotency: postgres: headers of %s: %w", key, err)
+	}
+	return rec, false, nil
+}
+
+// Complete stores the response for key
+func (s *PostgresStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	header := rec.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("idempotency: postgres: %w", err)
+	}
+	err = s.db.WithContext(ctx).RawQuery(`UPDATE idempotency_keys
+		SET done = true, status = ?, headers = ?, body = ?, expires_at = ?
+		WHERE key = ?`, rec.Status, string(headers), rec.Body, s.now().Add(ttl), key).Exec()
+	if err != nil {
+		return fmt.Errorf("idempotency: postgres: %w", err)
+	}
+	return nil
+}
+
+// Release forgets key
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	if err := s.db.WithContext(ctx).RawQuery(`DELETE FROM idempotency_keys WHERE key = ?`, key).Exec(); err != nil {
+		return fmt.Errorf("idempotency: postgres: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired records
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := s.db.WithContext(ctx).RawQuery(`WITH gone AS (DELETE FROM idempotency_keys WHERE expires_at <= ? RETURNING 1)
+		SELECT count(*) FROM gone`, s.now()).First(&deleted)
+	if err != nil {
+		return 0, fmt.Errorf("idempotency: postgres cleanup: %w", err)
+	}
+	return deleted, nil
+}
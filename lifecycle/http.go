@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPServer returns a hook serving srv on srv.Addr, or on the Unix socket
+// of an address such as "unix:/run/app.sock". The listener is opened on
+// start, so a taken port fails startup. On stop the server stops accepting
+// connections and drains the requests in flight; requests still running
+// when the shutdown timeout passes are cut off.
+func HTTPServer(name string, srv *http.Server) Hook {
+	var ln net.Listener
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			network, addr := "tcp", srv.Addr
+			if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+				network, addr = "unix", path
+			}
+			var err error
+			ln, err = (&net.ListenConfig{}).Listen(ctx, network, addr)
+			return err
+		},
+		Run: func(context.Context) error {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if err := srv.Shutdown(ctx); err != nil {
+				_ = srv.Close()
+				return err
+			}
+			return nil
+		},
+	}
+}
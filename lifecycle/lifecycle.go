@@ -0,0 +1,217 @@
+// Package lifecycle starts the components of the application in the order
+// they were registered and stops them in reverse order on shutdown, so
+// the HTTP server drains before the workers stop and the database, which
+// everything else uses, closes last.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+)
+
+// DefaultShutdownTimeout bounds shutdown unless Manager.ShutdownTimeout is
+// set
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Hook is a component of the application. Every field but Name is
+// optional.
+type Hook struct {
+	Name string
+	// OnStart prepares the component, e.g. connects to a service. Startup
+	// stops at the first error and the components started so far are
+	// stopped again.
+	OnStart func(ctx context.Context) error
+	// Run runs in the background once every component started, until its
+	// context is cancelled on shutdown. Returning earlier shuts the
+	// application down.
+	Run func(ctx context.Context) error
+	// OnStop releases the component before its Run context is cancelled.
+	// ctx expires with the shutdown timeout.
+	OnStop func(ctx context.Context) error
+}
+
+// Manager runs hooks. The zero value is not usable; use New.
+type Manager struct {
+	// ShutdownTimeout bounds Stop when called by Run
+	ShutdownTimeout time.Duration
+
+	mu       sync.Mutex
+	hooks    []Hook
+	started  []*running
+	stopping bool
+	failed   chan error
+	log      *slog.Logger
+}
+
+// running is a started hook
+type running struct {
+	Hook
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns a Manager without hooks
+func New() *Manager {
+	return &Manager{
+		ShutdownTimeout: DefaultShutdownTimeout,
+		failed:          make(chan error, 1),
+		log:             logging.For("lifecycle"),
+	}
+}
+
+// Default is the manager cmd/app runs; packages register their components
+// into it with Append
+var Default = New()
+
+// Append registers h with Default
+func Append(h Hook) {
+	Default.Append(h)
+}
+
+// Append registers h to start after the hooks registered before it and
+// stop before them. Hooks must be registered before Start.
+func (m *Manager) Append(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started != nil {
+		panic(fmt.Sprintf("lifecycle: %s registered after start", h.Name))
+	}
+	m.hooks = append(m.hooks, h)
+}
+
+// Start starts every hook in order, then launches the Run functions. When
+// a hook fails to start, the hooks started before it are stopped and the
+// error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.hooks
+	m.started = []*running{}
+	m.mu.Unlock()
+
+	for _, h := range hooks {
+		start := time.Now()
+		if h.OnStart != nil {
+			if err := h.OnStart(ctx); err != nil {
+				err = fmt.Errorf("lifecycle: starting %s: %w", h.Name, err)
+				stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.ShutdownTimeout)
+				defer cancel()
+				return errors.Join(err, m.Stop(stopCtx))
+			}
+		}
+		m.log.Debug("started", "component", h.Name, "duration", time.Since(start))
+
+		m.mu.Lock()
+		m.started = append(m.started, &running{Hook: h})
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.started {
+		r.done = make(chan struct{})
+		if r.Run == nil {
+			close(r.done)
+			continue
+		}
+		var runCtx context.Context
+		runCtx, r.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		go m.run(runCtx, r)
+	}
+	return nil
+}
+
+// run runs the Run function of r and reports it when it returns before
+// shutdown
+func (m *Manager) run(ctx context.Context, r *running) {
+	defer close(r.done)
+	err := r.Run(ctx)
+
+	m.mu.Lock()
+	stopping := m.stopping
+	m.mu.Unlock()
+	if stopping || ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("exited")
+	}
+	select {
+	case m.failed <- fmt.Errorf("lifecycle: %s: %w", r.Name, err):
+	default:
+		// Another component already triggered shutdown
+	}
+}
+
+// Stop stops the started hooks in reverse order: OnStop is called, then
+// the Run context is cancelled and Run awaited. Hooks are stopped even
+// after ctx expired, so every resource gets the chance to close; the
+// errors are joined.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopping = true
+	started := m.started
+	m.started = []*running{}
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		r := started[i]
+		start := time.Now()
+		if r.OnStop != nil {
+			if err := r.OnStop(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", r.Name, err))
+			}
+		}
+		if r.cancel != nil {
+			r.cancel()
+		}
+		if r.done != nil {
+			select {
+			case <-r.done:
+			case <-ctx.Done():
+				errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", r.Name, ctx.Err()))
+			}
+		}
+		m.log.Debug("stopped", "component", r.Name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the hooks and blocks until ctx is done, SIGINT or SIGTERM
+// arrives or a Run function returns early, then stops the hooks within
+// ShutdownTimeout. A second signal during shutdown kills the process.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+	m.log.Info("started")
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		m.log.Info("shutting down", "timeout", m.ShutdownTimeout)
+	case failure = <-m.failed:
+		m.log.Error("component failed, shutting down", "error", failure, "timeout", m.ShutdownTimeout)
+	}
+	stopSignals()
+
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.ShutdownTimeout)
+	defer cancel()
+	err := errors.Join(failure, m.Stop(stopCtx))
+	if err == nil {
+		m.log.Info("shutdown completed")
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records the calls made to its hooks
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *recorder) hook(name string, startErr error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			r.add("start " + name)
+			return startErr
+		},
+		OnStop: func(context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestManager_Starts_In_Order_And_Stops_In_Reverse(t *testing.T) {
+	var rec recorder
+	m := New()
+	m.Append(rec.hook("database", nil))
+	m.Append(rec.hook("cache", nil))
+	m.Append(Hook{Name: "worker", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		rec.add("stop worker")
+		return nil
+	}})
+	m.Append(rec.hook("http", nil))
+
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Stop(context.Background()))
+	assert.Equal(t, []string{
+		"start database", "start cache", "start http",
+		"stop http", "stop worker", "stop cache", "stop database",
+	}, rec.get())
+}
+
+func TestManager_Start_Failure_Stops_Started_Hooks(t *testing.T) {
+	var rec recorder
+	m := New()
+	m.Append(rec.hook("database", nil))
+	m.Append(rec.hook("cache", errors.New("connection refused")))
+	m.Append(rec.hook("http", nil))
+
+	err := m.Start(context.Background())
+	assert.ErrorContains(t, err, "starting cache: connection refused")
+	assert.Equal(t, []string{"start database", "start cache", "stop database"}, rec.get())
+}
+
+func TestManager_Stop_Is_Bounded(t *testing.T) {
+	var rec recorder
+	m := New()
+	m.Append(rec.hook("database", nil))
+	m.Append(Hook{Name: "stuck", Run: func(context.Context) error {
+		select {}
+	}})
+
+	require.NoError(t, m.Start(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := m.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "stopping stuck")
+	assert.Equal(t, []string{"start database", "stop database"}, rec.get(), "later hooks still stop")
+}
+
+func TestManager_Run_Stops_When_Cancelled(t *testing.T) {
+	var rec recorder
+	m := New()
+	m.Append(rec.hook("database", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	require.NoError(t, <-done)
+	assert.Equal(t, []string{"start database", "stop database"}, rec.get())
+}
+
+func TestManager_Run_Stops_When_A_Component_Fails(t *testing.T) {
+	var rec recorder
+	m := New()
+	m.Append(rec.hook("database", nil))
+	m.Append(Hook{Name: "worker", Run: func(context.Context) error {
+		return errors.New("queue closed")
+	}})
+
+	err := m.Run(context.Background())
+	assert.ErrorContains(t, err, "worker: queue closed")
+	assert.Equal(t, []string{"start database", "stop database"}, rec.get())
+}
+
+func TestManager_Append_After_Start_Panics(t *testing.T) {
+	m := New()
+	require.NoError(t, m.Start(context.Background()))
+	assert.Panics(t, func() { m.Append(Hook{Name: "late"}) })
+}
+
+func TestHTTPServer_Drains_Requests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})}
+	m := New()
+	m.Append(HTTPServer("http", srv))
+	require.NoError(t, m.Start(context.Background()))
+
+	body := make(chan string)
+	go func() {
+		res, err := http.Get("http://" + addr)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- m.Stop(context.Background()) }()
+
+	// New connections are refused while the request in flight finishes
+	require.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", addr)
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, <-stopped)
+}
+
+func TestHTTPServer_Cuts_Off_Requests_After_The_Timeout(t *testing.T) {
+	started := make(chan struct{})
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}
+	m := New()
+	m.Append(HTTPServer("http", srv))
+	require.NoError(t, m.Start(context.Background()))
+
+	go func() { _, _ = http.Get("http://" + addr) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestHTTPServer_Fails_On_A_Taken_Port(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	m := New()
+	m.Append(HTTPServer("http", &http.Server{Addr: ln.Addr().String()}))
+	assert.ErrorContains(t, m.Start(context.Background()), "starting http")
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
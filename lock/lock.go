@@ -0,0 +1,105 @@
+// Package lock provides named locks for coordinating work across
+// instances, such as jobs that must run on a single replica at a time.
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotHeld is returned when unlocking a lock that is no longer held
+var ErrNotHeld = errors.New("lock: not held")
+
+// Locker hands out named locks
+type Locker interface {
+	// TryLock acquires name without waiting; ok is false when another
+	// holder has it
+	TryLock(ctx context.Context, name string) (l Lock, ok bool, err error)
+	// Lock waits until name is acquired or ctx is done
+	Lock(ctx context.Context, name string) (Lock, error)
+}
+
+// Lock is a held lock
+type Lock interface {
+	Unlock(ctx context.Context) error
+}
+
+// Singleton runs fn unless another holder of name is already running it,
+// and reports whether it ran. Use it for periodic jobs every replica
+// schedules but only one should execute.
+func Singleton(ctx context.Context, locker Locker, name string, fn func(context.Context) error) (ran bool, err error) {
+	l, ok, err := locker.TryLock(ctx, name)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer func() {
+		// Unlock even when ctx is done, or the lock outlives the job
+		if uerr := l.Unlock(context.WithoutCancel(ctx)); err == nil {
+			err = uerr
+		}
+	}()
+	return true, fn(ctx)
+}
+
+// Memory is a Locker for a single instance, and for tests
+type Memory struct {
+	mu   sync.Mutex
+	held map[string]chan struct{}
+}
+
+// NewMemory returns a Memory locker
+func NewMemory() *Memory {
+	return &Memory{held: map[string]chan struct{}{}}
+}
+
+// TryLock acquires name without waiting
+func (m *Memory) TryLock(_ context.Context, name string) (Lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.held[name]; ok {
+		return nil, false, nil
+	}
+	released := make(chan struct{})
+	m.held[name] = released
+	return &memoryLock{m: m, name: name, released: released}, true, nil
+}
+
+// Lock waits until name is acquired or ctx is done
+func (m *Memory) Lock(ctx context.Context, name string) (Lock, error) {
+	for {
+		m.mu.Lock()
+		released, ok := m.held[name]
+		m.mu.Unlock()
+		if !ok {
+			if l, ok, _ := m.TryLock(ctx, name); ok {
+				return l, nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+type memoryLock struct {
+	m        *Memory
+	name     string
+	released chan struct{}
+	once     sync.Once
+}
+
+func (l *memoryLock) Unlock(context.Context) error {
+	err := ErrNotHeld
+	l.once.Do(func() {
+		l.m.mu.Lock()
+		defer l.m.mu.Unlock()
+		delete(l.m.held, l.name)
+		close(l.released)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocker runs the behaviour every Locker must share
+func testLocker(t *testing.T, a, b Locker) {
+	ctx := context.Background()
+
+	l, ok, err := a.TryLock(ctx, "job")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = b.TryLock(ctx, "job")
+	require.NoError(t, err)
+	assert.False(t, ok, "held elsewhere")
+
+	other, ok, err := b.TryLock(ctx, "other-job")
+	require.NoError(t, err)
+	assert.True(t, ok, "names are independent")
+	require.NoError(t, other.Unlock(ctx))
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = b.Lock(short, "job")
+	assert.Error(t, err, "Lock gives up when ctx is done")
+
+	acquired := make(chan Lock)
+	go func() {
+		l, err := b.Lock(ctx, "job")
+		assert.NoError(t, err)
+		acquired <- l
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, l.Unlock(ctx))
+	assert.ErrorIs(t, l.Unlock(ctx), ErrNotHeld)
+
+	select {
+	case l := <-acquired:
+		require.NoError(t, l.Unlock(ctx))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock did not acquire the released lock")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	testLocker(t, m, m)
+}
+
+func TestSingleton(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	held, _, err := m.TryLock(ctx, "cleanup")
+	require.NoError(t, err)
+	ran, err := Singleton(ctx, m, "cleanup", func(context.Context) error {
+		t.Fatal("ran while another holder runs it")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, ran)
+	require.NoError(t, held.Unlock(ctx))
+
+	boom := errors.New("boom")
+	ran, err = Singleton(ctx, m, "cleanup", func(context.Context) error { return boom })
+	assert.True(t, ran)
+	assert.ErrorIs(t, err, boom)
+
+	_, ok, err := m.TryLock(ctx, "cleanup")
+	require.NoError(t, err)
+	assert.True(t, ok, "released after the job")
+}
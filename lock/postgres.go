@@ -0,0 +1,108 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// conner is implemented by the database/sql pool behind a pop connection
+type conner interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// Postgres hands out session-level advisory locks. Each held lock pins a
+// pooled connection; if the process dies the connection closes and
+// Postgres releases the lock, so a crashed holder never blocks the others.
+type Postgres struct {
+	pool conner
+}
+
+// NewPostgres returns a Postgres locker using the pool of db
+func NewPostgres(db *pop.Connection) (*Postgres, error) {
+	pool, ok := db.Store.(conner)
+	if !ok {
+		return nil, fmt.Errorf("lock: %s connections cannot hold advisory locks", db.Dialect.Name())
+	}
+	return &Postgres{pool: pool}, nil
+}
+
+// Key maps a lock name to the 64-bit advisory lock key
+func Key(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryLock acquires name without waiting
+func (p *Postgres) TryLock(ctx context.Context, name string) (Lock, bool, error) {
+	conn, err := p.pool.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock %s: %w", name, err)
+	}
+	key := Key(name)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		discard(conn)
+		return nil, false, fmt.Errorf("lock %s: %w", name, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return &postgresLock{conn: conn, name: name, key: key}, true, nil
+}
+
+// Lock waits until name is acquired or ctx is done, or for at most the
+// statement timeout of the connection
+func (p *Postgres) Lock(ctx context.Context, name string) (Lock, error) {
+	conn, err := p.pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+	key := Key(name)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		// The lock may have been granted as the wait was cancelled
+		discard(conn)
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+	return &postgresLock{conn: conn, name: name, key: key}, nil
+}
+
+type postgresLock struct {
+	conn *sql.Conn
+	name string
+	key  int64
+}
+
+func (l *postgresLock) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return ErrNotHeld
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var released bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released); err != nil {
+		// A connection that may still hold the lock must not go back to
+		// the pool
+		discard(conn)
+		return fmt.Errorf("unlock %s: %w", l.name, err)
+	}
+	conn.Close()
+	if !released {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// discard closes the underlying connection instead of returning it to the
+// pool, which releases any advisory lock it holds
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
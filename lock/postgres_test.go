@@ -0,0 +1,26 @@
+package lock
+
+import (
+	"testing"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgres(t *testing.T) {
+	modelstest.DB(t)
+	// Two lockers on one pool behave like two replicas: advisory locks
+	// belong to connections
+	a, err := NewPostgres(models.DB)
+	require.NoError(t, err)
+	b, err := NewPostgres(models.DB)
+	require.NoError(t, err)
+	testLocker(t, a, b)
+}
+
+func TestKey_Is_Stable(t *testing.T) {
+	assert.Equal(t, Key("ratelimit.cleanup"), Key("ratelimit.cleanup"))
+	assert.NotEqual(t, Key("a"), Key("b"))
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/gobuffalo/logger"
+)
+
+// BuffaloLogger adapts a slog.Logger to the logger.FieldLogger interface
+// Buffalo uses internally, so framework and request logs share the same
+// structured output.
+type BuffaloLogger struct {
+	l *slog.Logger
+}
+
+// NewBuffaloLogger wraps l for use as buffalo.Options.Logger
+func NewBuffaloLogger(l *slog.Logger) *BuffaloLogger {
+	return &BuffaloLogger{l: l}
+}
+
+// Slog returns the underlying logger including any fields added so far
+func (b *BuffaloLogger) Slog() *slog.Logger {
+	return b.l
+}
+
+// WithField returns a logger with key=value added to every record
+func (b *BuffaloLogger) WithField(key string, value interface{}) logger.FieldLogger {
+	return &BuffaloLogger{l: b.l.With(key, value)}
+}
+
+// WithFields returns a logger with all fields added to every record
+func (b *BuffaloLogger) WithFields(fields map[string]interface{}) logger.FieldLogger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, k := range keys {
+		args = append(args, k, fields[k])
+	}
+	return &BuffaloLogger{l: b.l.With(args...)}
+}
+
+func (b *BuffaloLogger) log(level slog.Level, msg string) {
+	b.l.Log(context.Background(), level, msg)
+}
+
+func (b *BuffaloLogger) Debugf(format string, args ...interface{}) {
+	b.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (b *BuffaloLogger) Infof(format string, args ...interface{}) {
+	b.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (b *BuffaloLogger) Printf(format string, args ...interface{}) {
+	b.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (b *BuffaloLogger) Warnf(format string, args ...interface{}) {
+	b.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (b *BuffaloLogger) Errorf(format string, args ...interface{}) {
+	b.log(slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+func (b *BuffaloLogger) Fatalf(format string, args ...interface{}) {
+	b.log(slog.LevelError, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (b *BuffaloLogger) Debug(args ...interface{}) { b.log(slog.LevelDebug, fmt.Sprint(args...)) }
+func (b *BuffaloLogger) Info(args ...interface{})  { b.log(slog.LevelInfo, fmt.Sprint(args...)) }
+func (b *BuffaloLogger) Warn(args ...interface{})  { b.log(slog.LevelWarn, fmt.Sprint(args...)) }
+func (b *BuffaloLogger) Error(args ...interface{}) { b.log(slog.LevelError, fmt.Sprint(args...)) }
+
+func (b *BuffaloLogger) Fatal(args ...interface{}) {
+	b.log(slog.LevelError, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (b *BuffaloLogger) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	b.log(slog.LevelError, msg)
+	panic(msg)
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/envy"
+)
+
+// Output formats accepted by Config.Format
+const (
+	FormatJSON   = "json"
+	FormatPretty = "pretty"
+)
+
+// Config holds the logging settings
+type Config struct {
+	// Format is "json" (production) or "pretty" (development)
+	Format string
+	// Level is the default minimum level
+	Level slog.Level
+	// Levels overrides Level per component, e.g. {"models": slog.LevelWarn}.
+	// A component inherits the level of its closest configured parent, so
+	// "actions" also applies to "actions.auth".
+	Levels map[string]slog.Level
+	// Output defaults to os.Stdout
+	Output io.Writer
+	// Redactor scrubs secrets from every record. Defaults to NewRedactor().
+	Redactor *Redactor
+}
+
+// ConfigFromEnv builds a Config from LOG_FORMAT, LOG_LEVEL and LOG_LEVELS.
+// LOG_LEVELS is a comma separated list such as "models=warn,actions=debug".
+// LOG_REDACT_KEYS adds comma separated keys to the redaction deny-list and
+// LOG_HASH_EMAILS=true hashes email addresses found in log values.
+func ConfigFromEnv() (Config, error) {
+	env := envy.Get("GO_ENV", "development")
+	format := FormatJSON
+	if env == "development" {
+		format = FormatPretty
+	}
+
+	cfg := Config{
+		Format: envy.Get("LOG_FORMAT", format),
+		Levels: map[string]slog.Level{},
+		Output: os.Stdout,
+	}
+
+	cfg.Redactor = NewRedactor(strings.Split(envy.Get("LOG_REDACT_KEYS", ""), ",")...)
+	cfg.Redactor.HashEmails = envy.Get("LOG_HASH_EMAILS", "false") == "true"
+
+	if err := cfg.Level.UnmarshalText([]byte(envy.Get("LOG_LEVEL", "info"))); err != nil {
+		return cfg, fmt.Errorf("parsing LOG_LEVEL: %w", err)
+	}
+
+	levels, err := ParseLevels(envy.Get("LOG_LEVELS", ""))
+	if err != nil {
+		return cfg, fmt.Errorf("parsing LOG_LEVELS: %w", err)
+	}
+	cfg.Levels = levels
+
+	return cfg, nil
+}
+
+// ParseLevels parses a "component=level,..." list
+func ParseLevels(s string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, lvl, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid level %q, expected component=level", pair)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(lvl))); err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(name)] = level
+	}
+	return levels, nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = Config{Format: FormatJSON, Level: slog.LevelInfo, Output: os.Stdout, Redactor: NewRedactor()}
+	base    = newHandler(current)
+)
+
+// Setup installs cfg for every logger created afterwards with For and
+// makes it the slog default.
+func Setup(cfg Config) {
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	if cfg.Redactor == nil {
+		cfg.Redactor = NewRedactor()
+	}
+
+	mu.Lock()
+	current = cfg
+	base = newHandler(cfg)
+	mu.Unlock()
+
+	slog.SetDefault(For(""))
+}
+
+// For returns a logger for the named component. Records carry a
+// "component" attribute and are filtered by the component's level.
+func For(component string) *slog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	l := slog.New(&levelHandler{Handler: base, level: levelFor(current, component)})
+	if component != "" {
+		l = l.With("component", component)
+	}
+	return l
+}
+
+// levelFor resolves the level of component from its closest configured
+// parent, falling back to the default level.
+func levelFor(cfg Config, component string) slog.Level {
+	for name := component; name != ""; {
+		if lvl, ok := cfg.Levels[name]; ok {
+			return lvl
+		}
+		i := strings.LastIndexAny(name, "./")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return cfg.Level
+}
+
+// Redact returns the Redactor of the current configuration for code that
+// has to scrub values outside of a logger
+func Redact() *Redactor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.Redactor
+}
+
+// newHandler builds the output handler. It accepts every level, filtering
+// happens per component in levelHandler.
+func newHandler(cfg Config) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var h slog.Handler = slog.NewJSONHandler(cfg.Output, opts)
+	if cfg.Format == FormatPretty {
+		h = newPrettyHandler(cfg.Output, opts)
+	}
+	return &redactHandler{Handler: h, r: cfg.Redactor}
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capture installs cfg writing into a buffer and restores the previous
+// configuration when the test ends
+func capture(t *testing.T, cfg Config) *bytes.Buffer {
+	t.Helper()
+	mu.RLock()
+	previous := current
+	mu.RUnlock()
+	t.Cleanup(func() { Setup(previous) })
+
+	buf := &bytes.Buffer{}
+	cfg.Output = buf
+	Setup(cfg)
+	return buf
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("models=warn, actions = debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, levels["models"])
+	assert.Equal(t, slog.LevelDebug, levels["actions"])
+
+	_, err = ParseLevels("models")
+	assert.Error(t, err)
+
+	_, err = ParseLevels("models=loud")
+	assert.Error(t, err)
+}
+
+func TestLevelFor_Inherits_From_Parent(t *testing.T) {
+	cfg := Config{
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{"actions": slog.LevelDebug, "actions.auth": slog.LevelError},
+	}
+
+	assert.Equal(t, slog.LevelDebug, levelFor(cfg, "actions"))
+	assert.Equal(t, slog.LevelDebug, levelFor(cfg, "actions.health"))
+	assert.Equal(t, slog.LevelError, levelFor(cfg, "actions.auth"))
+	assert.Equal(t, slog.LevelInfo, levelFor(cfg, "models"))
+}
+
+func TestFor_JSON_With_Component_Levels(t *testing.T) {
+	buf := capture(t, Config{
+		Format: FormatJSON,
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{"models": slog.LevelWarn},
+	})
+
+	For("models").Info("hidden")
+	For("models").Warn("shown", "table", "users")
+	For("actions").Debug("hidden")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "shown", record["msg"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "models", record["component"])
+	assert.Equal(t, "users", record["table"])
+}
+
+func TestFor_Pretty(t *testing.T) {
+	buf := capture(t, Config{Format: FormatPretty, Level: slog.LevelDebug})
+
+	For("actions").WithGroup("req").Debug("hello world", "path", "/auth/login", "note", "two words")
+
+	out := buf.String()
+	assert.Contains(t, out, "DEBUG hello world")
+	assert.Contains(t, out, "component=actions")
+	assert.Contains(t, out, "req.path=/auth/login")
+	assert.Contains(t, out, `req.note="two words"`)
+}
+
+func TestBuffaloLogger_Fields(t *testing.T) {
+	buf := capture(t, Config{Format: FormatJSON, Level: slog.LevelInfo})
+
+	bl := NewBuffaloLogger(For("http"))
+	bl.WithFields(map[string]interface{}{"status": 200, "method": "GET"}).Infof("served %s", "/health")
+	bl.Debug("hidden")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "served /health", record["msg"])
+	assert.Equal(t, "GET", record["method"])
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, "http", record["component"])
+}
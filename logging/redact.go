@@ -0,0 +1,252 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must never reach log output
+const Redacted = "[REDACTED]"
+
+// DefaultDenyList holds the keys whose values are always redacted. Keys are
+// matched case-insensitively, ignoring "-" and "_", and a key matches when
+// it contains an entry, so "password_confirm" is caught by "password".
+var DefaultDenyList = []string{
+	"password",
+	"secret",
+	"token",
+	"authorization",
+	"cookie",
+	"apikey",
+	"jwt",
+	"creditcard",
+	"cvc",
+	"ssn",
+}
+
+var (
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// Redactor removes secrets from values before they are logged. Values are
+// redacted by key using a deny-list and by content using patterns for JWTs,
+// credentials in Authorization-style strings and, optionally, emails.
+type Redactor struct {
+	deny []string
+	// HashEmails replaces email addresses with a stable hash so records can
+	// still be correlated without storing the address
+	HashEmails bool
+}
+
+// NewRedactor returns a Redactor denying DefaultDenyList plus extra keys
+func NewRedactor(extra ...string) *Redactor {
+	r := &Redactor{}
+	for _, k := range append(append([]string{}, DefaultDenyList...), extra...) {
+		if k = normalizeKey(k); k != "" {
+			r.deny = append(r.deny, k)
+		}
+	}
+	return r
+}
+
+func normalizeKey(k string) string {
+	k = strings.ToLower(strings.TrimSpace(k))
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(k)
+}
+
+// Denied reports whether values stored under key must be redacted
+func (r *Redactor) Denied(key string) bool {
+	k := normalizeKey(key)
+	for _, d := range r.deny {
+		if strings.Contains(k, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// String scrubs JWTs, credentials and, when enabled, emails from s. Strings
+// holding a JSON document are redacted structurally.
+func (r *Redactor) String(s string) string {
+	if t := strings.TrimSpace(s); len(t) > 1 && (t[0] == '{' || t[0] == '[') {
+		var v interface{}
+		if err := json.Unmarshal([]byte(t), &v); err == nil {
+			if b, err := json.Marshal(r.Any(v)); err == nil {
+				return string(b)
+			}
+		}
+	}
+
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	s = bearerPattern.ReplaceAllString(s, "$1 "+Redacted)
+	if r.HashEmails {
+		s = emailPattern.ReplaceAllStringFunc(s, hashEmail)
+	}
+	return s
+}
+
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return "email:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Value redacts v stored under key
+func (r *Redactor) Value(key string, v interface{}) interface{} {
+	if r.Denied(key) {
+		return Redacted
+	}
+	return r.Any(v)
+}
+
+// Any walks maps, slices, headers and errors redacting denied keys and
+// scrubbing strings. Structs, pointers to them and other maps and slices
+// are redacted as their JSON encoding, by field name; values that cannot
+// be encoded are redacted whole.
+func (r *Redactor) Any(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case error:
+		return r.String(v.Error())
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = r.Value(k, val)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = r.Value(k, val)
+		}
+		return out
+	case url.Values:
+		return r.Any(map[string][]string(v))
+	case http.Header:
+		return r.Any(map[string][]string(v))
+	case map[string][]string:
+		out := make(map[string]interface{}, len(v))
+		for k, vals := range v {
+			if r.Denied(k) {
+				out[k] = Redacted
+				continue
+			}
+			scrubbed := make([]string, len(vals))
+			for i, val := range vals {
+				scrubbed[i] = r.String(val)
+			}
+			out[k] = scrubbed
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = r.Any(val)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, val := range v {
+			out[i] = r.String(val)
+		}
+		return out
+	case fmt.Stringer:
+		return r.String(v.String())
+	default:
+		if !structured(v) {
+			return v
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return Redacted
+		}
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return Redacted
+		}
+		return r.Any(doc)
+	}
+}
+
+// structured reports whether v holds fields or elements that may need
+// scrubbing, as opposed to a number, a bool or a nil pointer
+func structured(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+// Attr redacts a slog attribute, descending into groups
+func (r *Redactor) Attr(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindLogValuer {
+		a.Value = a.Value.Resolve()
+	}
+	if r.Denied(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.String(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		attrs := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			attrs[i] = r.Attr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}
+	case slog.KindAny:
+		return slog.Any(a.Key, r.Any(a.Value.Any()))
+	default:
+		return a
+	}
+}
+
+// redactHandler applies a Redactor to the message and every attribute
+// before records reach the output handler
+type redactHandler struct {
+	slog.Handler
+	r *Redactor
+}
+
+func (h *redactHandler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, h.r.String(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.r.Attr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.r.Attr(a)
+	}
+	return &redactHandler{Handler: h.Handler.WithAttrs(redacted), r: h.r}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name), r: h.r}
+}
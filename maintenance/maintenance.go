@@ -0,0 +1,144 @@
+// Package maintenance switches the API into maintenance, during which it
+// turns requests away, or only serves reads, while the service is worked
+// on.
+package maintenance
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Mode is how much of the API is served
+type Mode string
+
+const (
+	// Off serves every request
+	Off Mode = "off"
+	// ReadOnly only serves GET, HEAD and OPTIONS requests
+	ReadOnly Mode = "read_only"
+	// Offline serves no request
+	Offline Mode = "offline"
+)
+
+// Valid reports whether m is a known mode
+func (m Mode) Valid() bool {
+	return m == Off || m == ReadOnly || m == Offline
+}
+
+// State is the maintenance mode of the API
+type State struct {
+	Mode Mode `json:"mode" db:"mode"`
+	// Message tells clients about the maintenance; empty uses a generic
+	// one
+	Message string `json:"message" db:"message"`
+	// RetryAfter is when clients should retry, in seconds; 0 sends no
+	// Retry-After
+	RetryAfter int       `json:"retry_after" db:"retry_after"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Blocks reports whether s turns away requests with method
+func (s State) Blocks(method string) bool {
+	switch s.Mode {
+	case Offline:
+		return true
+	case ReadOnly:
+		return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+	default:
+		return false
+	}
+}
+
+// Store keeps the state set at runtime
+type Store interface {
+	// Get returns the stored state, Off before any was set
+	Get(ctx context.Context) (State, error)
+	// Set replaces the stored state; UpdatedAt of s is set
+	Set(ctx context.Context, s *State) error
+}
+
+// Switch holds the state from memory, so checking it costs no query.
+// Refresh it when the store changes. A state forced by configuration
+// takes precedence over the stored one. It is safe for concurrent use.
+type Switch struct {
+	store  Store
+	forced State
+
+	mu    sync.RWMutex
+	state State
+}
+
+// NewSwitch returns a switch of store, off until refreshed. Unless the mode
+// of forced is Off, forced is the state whatever is stored.
+func NewSwitch(store Store, forced State) *Switch {
+	return &Switch{store: store, forced: forced, state: State{Mode: Off}}
+}
+
+// Forced reports whether configuration forces the state
+func (s *Switch) Forced() bool {
+	return s.forced.Mode != Off && s.forced.Mode != ""
+}
+
+// State returns the state in effect
+func (s *Switch) State() State {
+	if s.Forced() {
+		return s.forced
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Refresh loads the stored state. On error the switch keeps the state it
+// had.
+func (s *Switch) Refresh(ctx context.Context) error {
+	state, err := s.store.Get(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+	return nil
+}
+
+// Set stores state and applies it at once, unless configuration forces
+// another. UpdatedAt of state is set.
+func (s *Switch) Set(ctx context.Context, state *State) error {
+	if err := s.store.Set(ctx, state); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.state = *state
+	s.mu.Unlock()
+	return nil
+}
+
+// MemoryStore keeps the state in process memory, for tests and development
+type MemoryStore struct {
+	mu    sync.Mutex
+	state State
+}
+
+// NewMemoryStore returns a MemoryStore that is off
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: State{Mode: Off}}
+}
+
+// Get returns the stored state
+func (s *MemoryStore) Get(_ context.Context) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+// Set replaces the stored state
+func (s *MemoryStore) Set(_ context.Context, state *State) error {
+	state.UpdatedAt = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = *state
+	return nil
+}
@@ -0,0 +1,89 @@
+package maintenance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_Blocks(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		assert.False(t, State{Mode: Off}.Blocks(method), method)
+		assert.False(t, State{}.Blocks(method), "the zero state is off")
+		assert.True(t, State{Mode: Offline}.Blocks(method), method)
+	}
+	readOnly := State{Mode: ReadOnly}
+	assert.False(t, readOnly.Blocks(http.MethodGet))
+	assert.False(t, readOnly.Blocks(http.MethodHead))
+	assert.False(t, readOnly.Blocks(http.MethodOptions))
+	assert.True(t, readOnly.Blocks(http.MethodPost))
+	assert.True(t, readOnly.Blocks(http.MethodPatch))
+}
+
+func TestSwitch(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	sw := NewSwitch(store, State{Mode: Off})
+	assert.Equal(t, Off, sw.State().Mode)
+	assert.False(t, sw.Forced())
+
+	// Another replica switches maintenance on
+	require.NoError(t, store.Set(ctx, &State{Mode: Offline, RetryAfter: 60}))
+	assert.Equal(t, Off, sw.State().Mode, "not refreshed yet")
+	require.NoError(t, sw.Refresh(ctx))
+	assert.Equal(t, Offline, sw.State().Mode)
+
+	require.NoError(t, sw.Set(ctx, &State{Mode: ReadOnly, Message: "Upgrading"}))
+	assert.Equal(t, "Upgrading", sw.State().Message, "applies at once")
+	stored, err := store.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReadOnly, stored.Mode)
+}
+
+func TestSwitch_Forced(t *testing.T) {
+	ctx := context.Background()
+	sw := NewSwitch(NewMemoryStore(), State{Mode: Offline, Message: "Migrating"})
+	assert.True(t, sw.Forced())
+	require.NoError(t, sw.Set(ctx, &State{Mode: Off}))
+	assert.Equal(t, State{Mode: Offline, Message: "Migrating"}, sw.State(), "configuration wins")
+}
+
+// testStore runs the behaviour every store must share
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	state, err := s.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Off, state.Mode, "off before any was set")
+
+	set := &State{Mode: ReadOnly, Message: "Upgrading", RetryAfter: 300}
+	require.NoError(t, s.Set(ctx, set))
+	assert.False(t, set.UpdatedAt.IsZero())
+	state, err = s.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReadOnly, state.Mode)
+	assert.Equal(t, "Upgrading", state.Message)
+	assert.Equal(t, 300, state.RetryAfter)
+	assert.WithinDuration(t, set.UpdatedAt, state.UpdatedAt, time.Millisecond)
+
+	require.NoError(t, s.Set(ctx, &State{Mode: Off}))
+	state, err = s.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Off, state.Mode)
+	assert.Empty(t, state.Message, "the state is replaced")
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestPostgresStore(t *testing.T) {
+	modelstest.DB(t)
+	require.NoError(t, models.DB.RawQuery("DELETE FROM maintenance_state").Exec())
+	testStore(t, NewPostgresStore(models.DB))
+}
@@ -0,0 +1,62 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Channel is the Postgres notification channel PostgresStore announces
+// changes on
+const Channel = "maintenance_changed"
+
+// PostgresStore keeps the state in the single row of the
+// maintenance_state table and notifies Channel of every change
+type PostgresStore struct {
+	db *pop.Connection
+}
+
+// NewPostgresStore returns a PostgresStore on db
+func NewPostgresStore(db *pop.Connection) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get returns the stored state
+func (s *PostgresStore) Get(ctx context.Context) (State, error) {
+	var state State
+	err := s.db.WithContext(ctx).RawQuery(`SELECT mode, message, retry_after, updated_at
+		FROM maintenance_state WHERE id = 1`).First(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return State{Mode: Off}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("maintenance: postgres: %w", err)
+	}
+	return state, nil
+}
+
+// Set replaces the stored state and notifies Channel in one transaction,
+// so the notification is sent if and only if the change commits
+func (s *PostgresStore) Set(ctx context.Context, state *State) error {
+	now := time.Now().UTC()
+	err := s.db.WithContext(ctx).Transaction(func(tx *pop.Connection) error {
+		err := tx.RawQuery(`INSERT INTO maintenance_state (id, mode, message, retry_after, updated_at)
+			VALUES (1, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET mode = EXCLUDED.mode, message = EXCLUDED.message,
+				retry_after = EXCLUDED.retry_after, updated_at = EXCLUDED.updated_at`,
+			state.Mode, state.Message, state.RetryAfter, now).Exec()
+		if err != nil {
+			return err
+		}
+		return tx.RawQuery(`SELECT pg_notify(?, ?)`, Channel, string(state.Mode)).Exec()
+	})
+	if err != nil {
+		return fmt.Errorf("maintenance: postgres: %w", err)
+	}
+	state.UpdatedAt = now
+	return nil
+}
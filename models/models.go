@@ -1,22 +1,173 @@
 package models
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
-	"github.com/gobuffalo/envy"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
 	"github.com/gobuffalo/pop/v6"
 )
 
 // DB is a connection to your database to be used
-// throughout your application.
+// throughout your application. It is nil until Open or Connect.
 var DB *pop.Connection
 
-func init() {
-	var err error
-	env := envy.Get("GO_ENV", "development")
-	DB, err = pop.Connect(env)
-	if err != nil {
-		log.Fatal(err)
+const (
+	// minConnectBackoff is the wait before the first retry of Connect; it
+	// doubles on every retry up to maxConnectBackoff
+	minConnectBackoff = 500 * time.Millisecond
+	maxConnectBackoff = 10 * time.Second
+)
+
+// Open sets DB to the connection of cfg.Env in database.yml and Replicas
+// to its read replicas, with the settings of cfg.Database, without
+// connecting: the first query does.
+// Tests and tools that may not need the database use it; servers use
+// Connect.
+func Open(cfg *config.Config) error {
+	env := cfg.Env
+	if len(pop.Connections) == 0 {
+		if err := pop.LoadConfigFile(); err != nil {
+			return fmt.Errorf("models: %w", err)
+		}
+	}
+	// The configured URL replaces the details of database.yml
+	if cfg.Database.URL != "" {
+		c, err := pop.NewConnection(&pop.ConnectionDetails{URL: cfg.Database.URL})
+		if err != nil {
+			return fmt.Errorf("models: %w", err)
+		}
+		pop.Connections[env] = c
+	}
+	c, ok := pop.Connections[env]
+	if !ok {
+		return fmt.Errorf("models: no connection for %q in database.yml", env)
+	}
+	if err := configure(c.Dialect.Details(), cfg.Database); err != nil {
+		return fmt.Errorf("models: %w", err)
+	}
+	if err := c.Open(); err != nil {
+		return fmt.Errorf("models: %w", err)
 	}
+
+	replicas := make([]*pop.Connection, 0, len(cfg.Database.ReplicaURLs))
+	for i, u := range cfg.Database.ReplicaURLs {
+		r, err := pop.NewConnection(&pop.ConnectionDetails{URL: u})
+		if err == nil {
+			err = configure(r.Dialect.Details(), cfg.Database)
+		}
+		if err == nil {
+			err = r.Open()
+		}
+		if err != nil {
+			return fmt.Errorf("models: replica %d: %w", i, err)
+		}
+		replicas = append(replicas, r)
+	}
+
+	DB = c
+	Replicas = NewReplicaSet(c, replicas, cfg.Database.ReplicaMaxLag)
 	pop.Debug = env == "development"
-} 
\ No newline at end of file
+	return nil
+}
+
+// Close closes DB and its replicas
+func Close() error {
+	return errors.Join(Replicas.Close(), DB.Close())
+}
+
+// configure applies the settings of cfg to deets; zero settings keep
+// those of database.yml
+func configure(deets *pop.ConnectionDetails, cfg config.Database) error {
+	if cfg.Pool > 0 {
+		deets.Pool = cfg.Pool
+	}
+	if cfg.IdlePool > 0 {
+		deets.IdlePool = cfg.IdlePool
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		deets.ConnMaxLifetime = cfg.ConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		deets.ConnMaxIdleTime = cfg.ConnMaxIdleTime
+	}
+	if cfg.StatementTimeout > 0 {
+		if err := setRuntimeParam(deets, "statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)); err != nil {
+			return err
+		}
+	}
+	// Trace every query as a child of the request span
+	deets.UseInstrumentedDriver = true
+	deets.InstrumentedDriverOptions = telemetry.SQLDriverOptions()
+	return nil
+}
+
+// setRuntimeParam sets a Postgres run-time parameter of every connection
+// of deets. The driver sends unknown URL parameters to the server, so it
+// goes in the URL when there is one and with the options otherwise.
+func setRuntimeParam(deets *pop.ConnectionDetails, name, value string) error {
+	if deets.URL == "" {
+		if deets.Options == nil {
+			deets.Options = map[string]string{}
+		}
+		deets.Options[name] = value
+		return nil
+	}
+	u, err := url.Parse(deets.URL)
+	if err != nil {
+		return fmt.Errorf("database url: %w", err)
+	}
+	q := u.Query()
+	q.Set(name, value)
+	u.RawQuery = q.Encode()
+	deets.URL = u.String()
+	return nil
+}
+
+// Connect opens DB like Open and waits until the database answers, so a
+// server starting before its database does not crash. Failed attempts are
+// retried with exponential backoff until cfg.Database.ConnectTimeout
+// passes or ctx is done, which returns the last error.
+func Connect(ctx context.Context, cfg *config.Config) error {
+	if err := Open(cfg); err != nil {
+		return err
+	}
+	if timeout := cfg.Database.ConnectTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log := logging.For("models")
+	backoff := minConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("models: database unavailable after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		}
+		log.Warn("database unavailable", "attempt", attempt, "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("models: database unavailable after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
+
+// Ping checks the database answers
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("models: not connected")
+	}
+	return DB.WithContext(ctx).RawQuery("SELECT 1").Exec()
+}
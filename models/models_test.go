@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigure(t *testing.T) {
+	deets := &pop.ConnectionDetails{URL: "postgres://app@db.internal:5432/app?sslmode=disable", Pool: 5}
+	require.NoError(t, configure(deets, config.Database{
+		IdlePool:         3,
+		ConnMaxLifetime:  time.Hour,
+		StatementTimeout: 1500 * time.Millisecond,
+	}))
+	assert.Equal(t, 5, deets.Pool, "zero settings keep database.yml")
+	assert.Equal(t, 3, deets.IdlePool)
+	assert.Equal(t, time.Hour, deets.ConnMaxLifetime)
+	u, err := url.Parse(deets.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "1500", u.Query().Get("statement_timeout"))
+	assert.Equal(t, "disable", u.Query().Get("sslmode"))
+	assert.True(t, deets.UseInstrumentedDriver)
+
+	deets = &pop.ConnectionDetails{Database: "app"}
+	require.NoError(t, configure(deets, config.Database{StatementTimeout: time.Second}))
+	assert.Equal(t, "1000", deets.Options["statement_timeout"], "without a URL")
+}
+
+func TestOpen_Does_Not_Connect(t *testing.T) {
+	cfg := config.Defaults("unreachable")
+	cfg.Database.URL = "postgres://nobody@127.0.0.1:1/none?sslmode=disable&connect_timeout=1"
+	require.NoError(t, Open(cfg))
+	assert.NotNil(t, DB)
+	assert.Error(t, Ping(context.Background()))
+}
+
+func TestConnect_Retries_Until_The_Timeout(t *testing.T) {
+	cfg := config.Defaults("unreachable")
+	cfg.Database.URL = "postgres://nobody@127.0.0.1:1/none?sslmode=disable&connect_timeout=1"
+	cfg.Database.ConnectTimeout = 1200 * time.Millisecond
+
+	start := time.Now()
+	err := Connect(context.Background(), cfg)
+	assert.ErrorContains(t, err, "database unavailable after 2 attempts")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Connect(ctx, cfg), context.Canceled, "shutdown stops the retries")
+}
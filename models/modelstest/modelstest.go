@@ -0,0 +1,45 @@
+// Package modelstest opens the database for tests. Tests that do not
+// touch the database need nothing from it: importing models no longer
+// connects.
+package modelstest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/gobuffalo/pop/v6"
+)
+
+var (
+	openOnce sync.Once
+	openErr  error
+)
+
+// Open opens models.DB once per test binary, without connecting, for code
+// such as actions.App() that holds on to it
+func Open() error {
+	openOnce.Do(func() {
+		openErr = models.Open(config.Get())
+	})
+	return openErr
+}
+
+// DB returns models.DB, skipping t when the database is not running. It
+// does not retry, so test runs without a database stay fast.
+func DB(t testing.TB) *pop.Connection {
+	t.Helper()
+	err := Open()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = models.Ping(ctx)
+	}
+	if err != nil {
+		t.Skipf("database unavailable: %v", err)
+	}
+	return models.DB
+}
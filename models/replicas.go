@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/logging"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Replicas routes read-only queries between DB and its read replicas. It
+// is set by Open.
+var Replicas *ReplicaSet
+
+// ReplicaSet sends read-only queries to read replicas of a primary, in
+// turn, while they answer and keep up with it; otherwise reads go to the
+// primary. Replicas are unused until the first Check. It is safe for
+// concurrent use.
+type ReplicaSet struct {
+	primary  *pop.Connection
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+// replica is a read replica and the outcome of its last check
+type replica struct {
+	conn *pop.Connection
+	// probe returns how far the replica is behind the primary
+	probe  func(ctx context.Context) (time.Duration, error)
+	usable atomic.Bool
+}
+
+// NewReplicaSet returns a set reading from replicas of primary while they
+// are at most maxLag behind it
+func NewReplicaSet(primary *pop.Connection, replicas []*pop.Connection, maxLag time.Duration) *ReplicaSet {
+	s := &ReplicaSet{primary: primary, maxLag: maxLag}
+	for _, conn := range replicas {
+		r := &replica{conn: conn}
+		r.probe = r.lag
+		s.replicas = append(s.replicas, r)
+	}
+	return s
+}
+
+// Len returns the number of replicas
+func (s *ReplicaSet) Len() int {
+	return len(s.replicas)
+}
+
+// Primary returns the primary, for writes and for reads that must see
+// them
+func (s *ReplicaSet) Primary() *pop.Connection {
+	return s.primary
+}
+
+// Reader returns the next usable replica, or the primary when none is
+func (s *ReplicaSet) Reader() *pop.Connection {
+	n := len(s.replicas)
+	start := s.next.Add(1)
+	for i := 0; i < n; i++ {
+		if r := s.replicas[(start+uint64(i))%uint64(n)]; r.usable.Load() {
+			return r.conn
+		}
+	}
+	return s.primary
+}
+
+// Check probes every replica and uses those that answer and lag at most
+// maxLag until the next check. Each probe is bounded by ctx.
+func (s *ReplicaSet) Check(ctx context.Context) {
+	log := logging.For("models")
+	var wg sync.WaitGroup
+	for i, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lag, err := r.probe(ctx)
+			usable := err == nil && lag <= s.maxLag
+			if was := r.usable.Swap(usable); was == usable {
+				return
+			}
+			switch {
+			case usable:
+				log.Info("replica in use", "replica", i, "lag", lag)
+			case err != nil:
+				log.Warn("replica unavailable, reading from others or the primary", "replica", i, "error", err)
+			default:
+				log.Warn("replica lagging, reading from others or the primary", "replica", i, "lag", lag, "max_lag", s.maxLag)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Close closes the replicas; the primary is closed with DB
+func (s *ReplicaSet) Close() error {
+	var errs []error
+	for _, r := range s.replicas {
+		errs = append(errs, r.conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// lag returns how far the replica is behind its primary: nothing when it
+// replayed all it received, otherwise the age of the last transaction it
+// replayed. A server not in recovery, such as the primary itself, is
+// current.
+func (r *replica) lag(ctx context.Context) (time.Duration, error) {
+	var row struct {
+		Lag float64 `db:"lag"`
+	}
+	err := r.conn.WithContext(ctx).RawQuery(`SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8 AS lag`).First(&row)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(row.Lag * float64(time.Second)), nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lagging returns a probe reporting lag and err
+func lagging(lag time.Duration, err error) func(context.Context) (time.Duration, error) {
+	return func(context.Context) (time.Duration, error) { return lag, err }
+}
+
+func TestReplicaSet_Reader(t *testing.T) {
+	primary, a, b, c := &pop.Connection{ID: "primary"}, &pop.Connection{ID: "a"}, &pop.Connection{ID: "b"}, &pop.Connection{ID: "c"}
+	set := NewReplicaSet(primary, []*pop.Connection{a, b, c}, time.Second)
+	assert.Equal(t, 3, set.Len())
+	assert.Same(t, primary, set.Reader(), "replicas are unused until checked")
+
+	set.replicas[0].probe = lagging(0, nil)
+	set.replicas[1].probe = lagging(500*time.Millisecond, nil)
+	set.replicas[2].probe = lagging(0, nil)
+	set.Check(context.Background())
+	seen := map[string]int{}
+	for range 6 {
+		seen[set.Reader().ID]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, seen, "round-robin")
+
+	set.replicas[1].probe = lagging(2*time.Second, nil)
+	set.replicas[2].probe = lagging(0, errors.New("connection refused"))
+	set.Check(context.Background())
+	for range 3 {
+		assert.Same(t, a, set.Reader(), "lagging and failed replicas are skipped")
+	}
+
+	set.replicas[0].probe = lagging(time.Minute, nil)
+	set.Check(context.Background())
+	assert.Same(t, primary, set.Reader(), "the primary serves when every replica lags")
+
+	set.replicas[1].probe = lagging(0, nil)
+	set.Check(context.Background())
+	assert.Same(t, b, set.Reader(), "recovered replicas serve again")
+	assert.Same(t, primary, set.Primary())
+}
+
+func TestReplicaSet_Without_Replicas(t *testing.T) {
+	primary := &pop.Connection{ID: "primary"}
+	set := NewReplicaSet(primary, nil, time.Second)
+	set.Check(context.Background())
+	assert.Zero(t, set.Len())
+	assert.Same(t, primary, set.Reader())
+	assert.NoError(t, set.Close())
+}
+
+func TestOpen_Replicas(t *testing.T) {
+	cfg := config.Defaults("unreachable")
+	cfg.Database.URL = "postgres://nobody@127.0.0.1:1/none?sslmode=disable&connect_timeout=1"
+	cfg.Database.ReplicaURLs = []string{"postgres://nobody@127.0.0.1:2/none?sslmode=disable&connect_timeout=1"}
+	require.NoError(t, Open(cfg))
+	t.Cleanup(func() { Replicas.Close() })
+	require.Equal(t, 1, Replicas.Len())
+	assert.Same(t, DB, Replicas.Primary())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	Replicas.Check(ctx)
+	assert.Same(t, DB, Replicas.Reader(), "an unreachable replica is not used")
+}
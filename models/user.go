@@ -1,18 +1,26 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/akingundogdu/production-ready-go-backend-architecture/config"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/telemetry"
 	"github.com/gobuffalo/pop/v6"
 	"github.com/gobuffalo/validate/v3"
-	"github.com/gobuffalo/validate/v3/validators"
 	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	emailRegex  = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+	localeRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+)
+
 // User roles constants
 const (
 	RoleUser  = "user"
@@ -26,6 +34,8 @@ type User struct {
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"` // Never expose password hash in JSON
 	Role         string    `json:"role" db:"role"`
+	Locale       string    `json:"locale,omitempty" db:"locale"` // Preferred language tag for API messages
+	Org          string    `json:"org,omitempty" db:"org"`       // Organization, for feature flag targeting
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 	
@@ -42,6 +52,8 @@ func (u User) String() string {
 		Name      string    `json:"name"`
 		Email     string    `json:"email"`
 		Role      string    `json:"role"`
+		Locale    string    `json:"locale,omitempty"`
+		Org       string    `json:"org,omitempty"`
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 	}{
@@ -49,6 +61,8 @@ func (u User) String() string {
 		Name:      u.Name,
 		Email:     u.Email,
 		Role:      u.Role,
+		Locale:    u.Locale,
+		Org:       u.Org,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
 	}
@@ -67,7 +81,15 @@ func (u Users) String() string {
 
 // SetPassword hashes the password and sets the PasswordHash field
 func (u *User) SetPassword(password string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return u.SetPasswordContext(context.Background(), password)
+}
+
+// SetPasswordContext is SetPassword with the bcrypt work traced as a child
+// span of the span in ctx
+func (u *User) SetPasswordContext(ctx context.Context, password string) error {
+	_, span := telemetry.StartSpan(ctx, "bcrypt.GenerateFromPassword")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), config.Get().Auth.BcryptCost)
+	telemetry.EndSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -77,10 +99,24 @@ func (u *User) SetPassword(password string) error {
 
 // ValidatePassword checks if the provided password matches the stored hash
 func (u *User) ValidatePassword(password string) bool {
+	return u.ValidatePasswordContext(context.Background(), password)
+}
+
+// ValidatePasswordContext is ValidatePassword with the bcrypt comparison
+// traced as a child span of the span in ctx
+func (u *User) ValidatePasswordContext(ctx context.Context, password string) bool {
+	_, span := telemetry.StartSpan(ctx, "bcrypt.CompareHashAndPassword")
 	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
+	// A mismatch is an expected outcome, not a span error
+	span.End()
 	return err == nil
 }
 
+// IsValidLocale checks if s looks like a language tag such as "en-US"
+func IsValidLocale(s string) bool {
+	return localeRegex.MatchString(s)
+}
+
 // IsAdmin checks if the user has admin role
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
@@ -95,7 +131,7 @@ func (u *User) IsUser() bool {
 func (u *User) BeforeCreate(tx *pop.Connection) error {
 	// Hash password if provided
 	if u.Password != "" {
-		return u.SetPassword(u.Password)
+		return u.SetPasswordContext(tx.Context(), u.Password)
 	}
 	
 	return nil
@@ -105,7 +141,7 @@ func (u *User) BeforeCreate(tx *pop.Connection) error {
 func (u *User) BeforeUpdate(tx *pop.Connection) error {
 	// Hash password if provided
 	if u.Password != "" {
-		return u.SetPassword(u.Password)
+		return u.SetPasswordContext(tx.Context(), u.Password)
 	}
 	
 	return nil
@@ -113,6 +149,12 @@ func (u *User) BeforeUpdate(tx *pop.Connection) error {
 
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
 func (u *User) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return u.validateFields(), nil
+}
+
+// validateFields normalizes and checks the fields of u that do not need
+// the database
+func (u *User) validateFields() *validate.Errors {
 	// Normalize fields before validation
 	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
 	u.Name = strings.TrimSpace(u.Name)
@@ -122,55 +164,73 @@ func (u *User) Validate(tx *pop.Connection) (*validate.Errors, error) {
 		u.Role = RoleUser
 	}
 	
-	errors := validate.Validate(
-		&validators.StringIsPresent{Field: u.Name, Name: "Name"},
-		&validators.StringLengthInRange{Field: u.Name, Name: "Name", Min: 2, Max: 100},
-		&validators.StringIsPresent{Field: u.Email, Name: "Email"},
-		&validators.EmailIsPresent{Field: u.Email, Name: "Email"},
-		// Role is not required as it will be set to default if empty
-	)
+	// Messages are translation IDs from the locales directory; the API
+	// translates them into the language of each request
+	errors := validate.NewErrors()
+	
+	if u.Name == "" {
+		errors.Add("name", "user_name_required")
+	} else if n := utf8.RuneCountInString(u.Name); n < 2 || n > 100 {
+		errors.Add("name", "user_name_length")
+	}
+	
+	// Validate email format with regex
+	if u.Email == "" {
+		errors.Add("email", "user_email_required")
+	} else if !emailRegex.MatchString(u.Email) {
+		errors.Add("email", "user_email_invalid")
+	}
 	
 	// Validate role is one of the allowed roles (empty is allowed, will be set to default)
 	if u.Role != "" && u.Role != RoleUser && u.Role != RoleAdmin {
-		errors.Add("role", "Role must be either 'user' or 'admin'")
+		errors.Add("role", "user_role_invalid")
 	}
 	
-	// Validate email format with regex
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(u.Email) {
-		errors.Add("email", "Email format is invalid")
+	// Locale is optional; requests fall back to Accept-Language without it
+	if u.Locale != "" && !IsValidLocale(u.Locale) {
+		errors.Add("locale", "user_locale_invalid")
 	}
 	
-	return errors, nil
+	return errors
 }
 
-// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
-func (u *User) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+// validatePassword checks the password of u, which creation requires
+func (u *User) validatePassword(required bool) *validate.Errors {
 	errors := validate.NewErrors()
 	
-	// Password is required for creation
 	if u.Password == "" {
-		errors.Add("password", "Password is required")
-	} else {
-		// Validate password strength
-		if len(u.Password) < 8 {
-			errors.Add("password", "Password must be at least 8 characters long")
-		}
-		if len(u.Password) > 100 {
-			errors.Add("password", "Password must be less than 100 characters")
-		}
-		
-		// Check password confirmation if provided
-		if u.PasswordConfirm != "" && u.Password != u.PasswordConfirm {
-			errors.Add("password_confirm", "Password confirmation does not match")
+		if required {
+			errors.Add("password", "user_password_required")
 		}
+		return errors
+	}
+	
+	// Validate password strength
+	if len(u.Password) < 8 {
+		errors.Add("password", "user_password_too_short")
+	}
+	if len(u.Password) > 100 {
+		errors.Add("password", "user_password_too_long")
 	}
 	
+	// Check password confirmation if provided
+	if u.PasswordConfirm != "" && u.Password != u.PasswordConfirm {
+		errors.Add("password_confirm", "user_password_confirm_mismatch")
+	}
+	
+	return errors
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+func (u *User) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	// Password is required for creation
+	errors := u.validatePassword(true)
+	
 	// Check if email is already taken
 	existingUser := &User{}
 	err := tx.Where("email = ?", strings.ToLower(u.Email)).First(existingUser)
 	if err == nil {
-		errors.Add("email", "Email is already taken")
+		errors.Add("email", "user_email_taken")
 	}
 	
 	return errors, nil
@@ -178,28 +238,14 @@ func (u *User) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
 
 // ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
 func (u *User) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
-	errors := validate.NewErrors()
-	
 	// Validate password only if provided for update
-	if u.Password != "" {
-		if len(u.Password) < 8 {
-			errors.Add("password", "Password must be at least 8 characters long")
-		}
-		if len(u.Password) > 100 {
-			errors.Add("password", "Password must be less than 100 characters")
-		}
-		
-		// Check password confirmation if provided
-		if u.PasswordConfirm != "" && u.Password != u.PasswordConfirm {
-			errors.Add("password_confirm", "Password confirmation does not match")
-		}
-	}
+	errors := u.validatePassword(false)
 	
 	// Check if email is already taken by another user
 	existingUser := &User{}
 	err := tx.Where("email = ? AND id != ?", strings.ToLower(u.Email), u.ID).First(existingUser)
 	if err == nil {
-		errors.Add("email", "Email is already taken")
+		errors.Add("email", "user_email_taken")
 	}
 	
 	return errors, nil
@@ -0,0 +1,323 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gofrs/uuid"
+)
+
+// ErrUserNotFound is returned for users that do not exist
+var ErrUserNotFound = errors.New("models: user not found")
+
+// UserRepository stores users. Create and Update validate the user first
+// and return the validation errors without saving when there are any.
+type UserRepository interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*User, error)
+	// FindByEmail finds users by email, whatever its case
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	Create(ctx context.Context, u *User) (*validate.Errors, error)
+	Update(ctx context.Context, u *User) (*validate.Errors, error)
+	// List returns the users matching filter, newest first
+	List(ctx context.Context, filter UserFilter) (Users, error)
+}
+
+// UserFilter selects users to list; zero fields select every user
+type UserFilter struct {
+	Role string
+	Org  string
+	// Search matches part of the name or email, whatever its case
+	Search string
+	// Page counts from 1 in pages of PerPage users; PerPage 0 lists all
+	Page    int
+	PerPage int
+}
+
+// offset returns how many matching users come before the page
+func (f UserFilter) offset() int {
+	return max(f.Page-1, 0) * f.PerPage
+}
+
+// PostgresUserRepository keeps users in the users table
+type PostgresUserRepository struct {
+	// read and write return the connection for the queries of ctx
+	read  func(ctx context.Context) *pop.Connection
+	write func(ctx context.Context) *pop.Connection
+}
+
+// NewPostgresUserRepository returns a PostgresUserRepository on db
+func NewPostgresUserRepository(db *pop.Connection) *PostgresUserRepository {
+	on := func(ctx context.Context) *pop.Connection { return db.WithContext(ctx) }
+	return &PostgresUserRepository{read: on, write: on}
+}
+
+// ReadFrom makes finds and listings use the connection read returns for
+// their context, such as a read replica, and returns r
+func (r *PostgresUserRepository) ReadFrom(read func(ctx context.Context) *pop.Connection) *PostgresUserRepository {
+	r.read = read
+	return r
+}
+
+// WriteTo makes Create and Update use the connection write returns for
+// their context, such as the transaction of a request, and returns r
+func (r *PostgresUserRepository) WriteTo(write func(ctx context.Context) *pop.Connection) *PostgresUserRepository {
+	r.write = write
+	return r
+}
+
+// FindByID returns the user of id
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	u := &User{}
+	return found(u, r.read(ctx).Find(u, id))
+}
+
+// FindByEmail returns the user of email
+func (r *PostgresUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	u := &User{}
+	return found(u, r.read(ctx).Where("email = ?", normalizeEmail(email)).First(u))
+}
+
+// Create validates u and inserts it
+func (r *PostgresUserRepository) Create(ctx context.Context, u *User) (*validate.Errors, error) {
+	verrs, err := r.write(ctx).ValidateAndCreate(u)
+	if err != nil {
+		return verrs, fmt.Errorf("models: users: %w", err)
+	}
+	return verrs, nil
+}
+
+// Update validates u and saves it
+func (r *PostgresUserRepository) Update(ctx context.Context, u *User) (*validate.Errors, error) {
+	db := r.write(ctx)
+	exists, err := db.Where("id = ?", u.ID).Exists(&User{})
+	if err != nil {
+		return nil, fmt.Errorf("models: users: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	verrs, err := db.ValidateAndUpdate(u)
+	if err != nil {
+		return verrs, fmt.Errorf("models: users: %w", err)
+	}
+	return verrs, nil
+}
+
+// List returns the users matching filter
+func (r *PostgresUserRepository) List(ctx context.Context, filter UserFilter) (Users, error) {
+	q := r.read(ctx).Order("created_at DESC, id")
+	if filter.Role != "" {
+		q = q.Where("role = ?", filter.Role)
+	}
+	if filter.Org != "" {
+		q = q.Where("org = ?", filter.Org)
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		q = q.Where("(name ILIKE ? OR email ILIKE ?)", pattern, pattern)
+	}
+	if filter.PerPage > 0 {
+		q = q.Paginate(max(filter.Page, 1), filter.PerPage)
+	}
+	users := Users{}
+	if err := q.All(&users); err != nil {
+		return nil, fmt.Errorf("models: users: %w", err)
+	}
+	return users, nil
+}
+
+// found returns u, or ErrUserNotFound when err is a missing row
+func found(u *User, err error) (*User, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("models: users: %w", err)
+	}
+	return u, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// MemoryUserRepository keeps users in memory, for tests and development.
+// It validates and hashes passwords like PostgresUserRepository.
+type MemoryUserRepository struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]User
+}
+
+// NewMemoryUserRepository returns an empty MemoryUserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uuid.UUID]User{}}
+}
+
+// FindByID returns the user of id
+func (r *MemoryUserRepository) FindByID(_ context.Context, id uuid.UUID) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
+
+// FindByEmail returns the user of email
+func (r *MemoryUserRepository) FindByEmail(_ context.Context, email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.byEmail(normalizeEmail(email)); ok {
+		return &u, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+// Create validates u and adds it. Passwords are hashed without holding
+// the lock, so the email is checked again before u is added.
+func (r *MemoryUserRepository) Create(ctx context.Context, u *User) (*validate.Errors, error) {
+	r.mu.Lock()
+	verrs := r.validate(u, true)
+	r.mu.Unlock()
+	if verrs.HasAny() {
+		return verrs, nil
+	}
+	if err := r.save(ctx, u); err != nil {
+		return verrs, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.emailTaken(u) {
+		verrs.Add("email", "user_email_taken")
+		return verrs, nil
+	}
+	if u.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return verrs, fmt.Errorf("models: users: %w", err)
+		}
+		u.ID = id
+	}
+	u.CreatedAt = u.UpdatedAt
+	r.users[u.ID] = r.stored(u)
+	return verrs, nil
+}
+
+// Update validates u and saves it. Like Create, it hashes passwords
+// without holding the lock.
+func (r *MemoryUserRepository) Update(ctx context.Context, u *User) (*validate.Errors, error) {
+	r.mu.Lock()
+	_, ok := r.users[u.ID]
+	verrs := r.validate(u, false)
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if verrs.HasAny() {
+		return verrs, nil
+	}
+	if err := r.save(ctx, u); err != nil {
+		return verrs, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.users[u.ID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if r.emailTaken(u) {
+		verrs.Add("email", "user_email_taken")
+		return verrs, nil
+	}
+	u.CreatedAt = old.CreatedAt
+	r.users[u.ID] = r.stored(u)
+	return verrs, nil
+}
+
+// List returns the users matching filter
+func (r *MemoryUserRepository) List(_ context.Context, filter UserFilter) (Users, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	search := strings.ToLower(filter.Search)
+	users := Users{}
+	for _, u := range r.users {
+		switch {
+		case filter.Role != "" && u.Role != filter.Role,
+			filter.Org != "" && u.Org != filter.Org,
+			search != "" && !strings.Contains(strings.ToLower(u.Name), search) && !strings.Contains(u.Email, search):
+			continue
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].ID.String() < users[j].ID.String()
+	})
+	if filter.PerPage > 0 {
+		start := min(filter.offset(), len(users))
+		users = users[start:min(start+filter.PerPage, len(users))]
+	}
+	return users, nil
+}
+
+// validate checks u like the validations pop runs, email uniqueness
+// included
+func (r *MemoryUserRepository) validate(u *User, create bool) *validate.Errors {
+	verrs := u.validateFields()
+	verrs.Append(u.validatePassword(create))
+	if r.emailTaken(u) {
+		verrs.Add("email", "user_email_taken")
+	}
+	return verrs
+}
+
+// emailTaken reports whether another user has the email of u
+func (r *MemoryUserRepository) emailTaken(u *User) bool {
+	other, ok := r.byEmail(u.Email)
+	return ok && other.ID != u.ID
+}
+
+// save hashes the new password of u, like the pop callbacks, and stamps it
+func (r *MemoryUserRepository) save(ctx context.Context, u *User) error {
+	if u.Password != "" {
+		if err := u.SetPasswordContext(ctx, u.Password); err != nil {
+			return fmt.Errorf("models: users: %w", err)
+		}
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// stored returns the copy of u kept, without its virtual fields
+func (r *MemoryUserRepository) stored(u *User) User {
+	kept := *u
+	kept.Password, kept.PasswordConfirm = "", ""
+	return kept
+}
+
+func (r *MemoryUserRepository) byEmail(email string) (User, bool) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, true
+		}
+	}
+	return User{}, false
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, NewMemoryUserRepository())
+}
+
+func TestMemoryUserRepository_Concurrent_Creates(t *testing.T) {
+	repo := NewMemoryUserRepository()
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verrs, err := repo.Create(context.Background(), &User{Name: "Ada", Email: "ada@example.com", Password: "password123"})
+			assert.NoError(t, err)
+			if !verrs.HasAny() {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, created.Load(), "emails stay unique while passwords hash unlocked")
+	users, err := repo.List(context.Background(), UserFilter{})
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func (ms *ModelSuite) Test_PostgresUserRepository() {
+	testUserRepository(ms.T(), NewPostgresUserRepository(ms.DB))
+}
+
+// testUserRepository checks the behavior every UserRepository shares
+func testUserRepository(t *testing.T, repo UserRepository) {
+	ctx := context.Background()
+	create := func(name, email, role, org string) *User {
+		t.Helper()
+		u := &User{Name: name, Email: email, Password: "password123", Role: role, Org: org}
+		verrs, err := repo.Create(ctx, u)
+		require.NoError(t, err)
+		require.False(t, verrs.HasAny(), verrs.String())
+		return u
+	}
+
+	ada := create("Ada Lovelace", " Ada@Example.com ", RoleAdmin, "analytical")
+	assert.NotEqual(t, uuid.Nil, ada.ID)
+	assert.Equal(t, "ada@example.com", ada.Email, "emails are normalized")
+	assert.True(t, ada.ValidatePassword("password123"), "passwords are hashed")
+	create("Grace Hopper", "grace@example.com", RoleUser, "navy")
+	create("Alan Turing", "alan@example.com", RoleUser, "analytical")
+
+	verrs, err := repo.Create(ctx, &User{Name: "Ada Again", Email: "ADA@example.com", Password: "password123"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_email_taken"}, verrs.Get("email"))
+	verrs, err = repo.Create(ctx, &User{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, verrs.Get("name"))
+	assert.NotEmpty(t, verrs.Get("password"))
+
+	found, err := repo.FindByID(ctx, ada.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", found.Name)
+	assert.Empty(t, found.Password, "virtual fields are not stored")
+	found, err = repo.FindByEmail(ctx, "ADA@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, ada.ID, found.ID)
+	_, err = repo.FindByID(ctx, uuid.Must(uuid.NewV4()))
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = repo.FindByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	found.Name, found.Password = "Ada King", "newpassword1"
+	verrs, err = repo.Update(ctx, found)
+	require.NoError(t, err)
+	require.False(t, verrs.HasAny(), verrs.String())
+	found, err = repo.FindByID(ctx, ada.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada King", found.Name)
+	assert.True(t, found.ValidatePassword("newpassword1"))
+	found.Email = "grace@example.com"
+	verrs, err = repo.Update(ctx, found)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_email_taken"}, verrs.Get("email"))
+	_, err = repo.Update(ctx, &User{ID: uuid.Must(uuid.NewV4()), Name: "Nobody", Email: "nobody@example.com"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	names := func(filter UserFilter) []string {
+		t.Helper()
+		users, err := repo.List(ctx, filter)
+		require.NoError(t, err)
+		names := []string{}
+		for _, u := range users {
+			names = append(names, u.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"Alan Turing", "Grace Hopper", "Ada King"}, names(UserFilter{}), "newest first")
+	assert.Equal(t, []string{"Alan Turing", "Grace Hopper"}, names(UserFilter{Role: RoleUser}))
+	assert.Equal(t, []string{"Alan Turing", "Ada King"}, names(UserFilter{Org: "analytical"}))
+	assert.Equal(t, []string{"Grace Hopper"}, names(UserFilter{Search: "GRACE"}))
+	assert.Equal(t, []string{"Ada King"}, names(UserFilter{Search: "ada@"}))
+	assert.Empty(t, names(UserFilter{Search: "%"}), "wildcards are literal")
+	assert.Equal(t, []string{"Grace Hopper"}, names(UserFilter{Page: 2, PerPage: 1}))
+	assert.Empty(t, names(UserFilter{Page: 4, PerPage: 1}))
+}
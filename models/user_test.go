@@ -321,3 +321,28 @@ func TestUsers_String(t *testing.T) {
 	assert.Contains(t, jsonStr, "John Doe")
 	assert.Contains(t, jsonStr, "Jane Doe")
 }
+
+func TestUser_Validate_Returns_Translation_IDs(t *testing.T) {
+	user := &User{Name: "J", Email: "not-an-email", Role: "root", Locale: "not a locale"}
+	verrs, err := user.Validate(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"user_name_length"}, verrs.Get("name"))
+	assert.Equal(t, []string{"user_email_invalid"}, verrs.Get("email"))
+	assert.Equal(t, []string{"user_role_invalid"}, verrs.Get("role"))
+	assert.Equal(t, []string{"user_locale_invalid"}, verrs.Get("locale"))
+
+	verrs, err = (&User{}).Validate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_name_required"}, verrs.Get("name"))
+	assert.Equal(t, []string{"user_email_required"}, verrs.Get("email"))
+}
+
+func TestUser_Validate_Accepts_Locales(t *testing.T) {
+	for _, locale := range []string{"", "en", "en-US", "es_ES", "zh-Hans-CN"} {
+		user := &User{Name: "John Doe", Email: "john@example.com", Locale: locale}
+		verrs, err := user.Validate(nil)
+		require.NoError(t, err)
+		assert.Empty(t, verrs.Get("locale"), locale)
+	}
+}
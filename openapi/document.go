@@ -0,0 +1,339 @@
+// Package openapi loads the OpenAPI 3.1 contract of the API and checks
+// requests and responses against it.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the subset of an OpenAPI 3.1 document the validator uses
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	routes []*Route
+}
+
+// Info is the document metadata
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the reusable schemas and responses referenced with $ref
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how an operation authenticates
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// PathItem holds the operations of a path template such as "/users/{id}"
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters,omitempty"`
+	Get        *Operation   `json:"get,omitempty"`
+	Put        *Operation   `json:"put,omitempty"`
+	Post       *Operation   `json:"post,omitempty"`
+	Delete     *Operation   `json:"delete,omitempty"`
+	Patch      *Operation   `json:"patch,omitempty"`
+}
+
+// Operations returns the operations of p keyed by HTTP method
+func (p *PathItem) Operations() map[string]*Operation {
+	ops := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// Operation is a single API operation
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the accepted request bodies by media type
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response by media type
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Route is an operation together with its path template
+type Route struct {
+	Method    string
+	Path      string
+	Operation *Operation
+	// Parameters merges path-level and operation-level parameters
+	Parameters []*Parameter
+
+	segments []string
+	// responses are the operation responses with references resolved
+	responses map[string]*Response
+}
+
+// Load parses an OpenAPI document in JSON or YAML and resolves its
+// component references
+func Load(data []byte) (*Document, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("openapi: parse document: %w", err)
+	}
+	// Round trip through JSON so YAML and JSON documents share the json tags
+	js, err := json.Marshal(normalize(raw))
+	if err != nil {
+		return nil, fmt.Errorf("openapi: parse document: %w", err)
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(js, doc); err != nil {
+		return nil, fmt.Errorf("openapi: parse document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+	if err := doc.resolve(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// resolve links every $ref to its component schema and builds the route
+// table
+func (d *Document) resolve() error {
+	seen := map[*Schema]bool{}
+	var walk func(s *Schema) error
+	walk = func(s *Schema) error {
+		if s == nil || seen[s] {
+			return nil
+		}
+		seen[s] = true
+		if s.Ref != "" {
+			name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+			target, ok := d.Components.Schemas[name]
+			if !ok || name == s.Ref {
+				return fmt.Errorf("openapi: unresolved reference %q", s.Ref)
+			}
+			s.resolved = target
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("openapi: invalid pattern %q: %w", s.Pattern, err)
+			}
+			s.pattern = re
+		}
+		for _, child := range s.children() {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, s := range d.Components.Schemas {
+		if err := walk(s); err != nil {
+			return err
+		}
+	}
+
+	d.routes = nil
+	for path, item := range d.Paths {
+		for method, op := range item.Operations() {
+			route := &Route{
+				Method:     method,
+				Path:       path,
+				Operation:  op,
+				Parameters: mergeParameters(item.Parameters, op.Parameters),
+				segments:   strings.Split(strings.Trim(path, "/"), "/"),
+				responses:  map[string]*Response{},
+			}
+			for _, p := range route.Parameters {
+				if err := walk(p.Schema); err != nil {
+					return err
+				}
+			}
+			if op.RequestBody != nil {
+				for _, mt := range op.RequestBody.Content {
+					if err := walk(mt.Schema); err != nil {
+						return err
+					}
+				}
+			}
+			for code, res := range op.Responses {
+				if res.Ref != "" {
+					name := strings.TrimPrefix(res.Ref, "#/components/responses/")
+					target, ok := d.Components.Responses[name]
+					if !ok || name == res.Ref {
+						return fmt.Errorf("openapi: unresolved reference %q", res.Ref)
+					}
+					res = target
+				}
+				route.responses[code] = res
+				for _, mt := range res.Content {
+					if err := walk(mt.Schema); err != nil {
+						return err
+					}
+				}
+			}
+			d.routes = append(d.routes, route)
+		}
+	}
+
+	// Literal segments win over templates: /users/me before /users/{id}
+	sort.Slice(d.routes, func(i, j int) bool {
+		a, b := d.routes[i], d.routes[j]
+		if ta, tb := templates(a.segments), templates(b.segments); ta != tb {
+			return ta < tb
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	return nil
+}
+
+// normalize converts the map[interface{}]interface{} values YAML produces
+// for non-string keys, such as response codes, into JSON objects
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalize(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalize(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// mergeParameters lets operation parameters override path parameters
+// with the same name and location
+func mergeParameters(pathParams, opParams []*Parameter) []*Parameter {
+	merged := append([]*Parameter{}, opParams...)
+	for _, p := range pathParams {
+		overridden := false
+		for _, op := range opParams {
+			if op.Name == p.Name && op.In == p.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+func templates(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if isTemplate(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// Routes returns every operation of the document
+func (d *Document) Routes() []*Route {
+	return d.routes
+}
+
+// Find returns the route matching method and path along with the values
+// of its path parameters. A trailing slash is ignored.
+func (d *Document) Find(method, path string) (*Route, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, route := range d.routes {
+		if route.Method != method || len(route.segments) != len(segments) {
+			continue
+		}
+		if params, ok := route.match(segments); ok {
+			return route, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (r *Route) match(segments []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, s := range r.segments {
+		if isTemplate(s) {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(s, "{}")] = segments[i]
+			continue
+		}
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,55 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+)
+
+//go:embed explorer.html
+var explorerHTML string
+
+var explorer = template.Must(template.New("explorer").Parse(explorerHTML))
+
+// inlineScript matches the bootstrap script of the explorer page
+var inlineScript = regexp.MustCompile(`(?s)<script>(.*?)</script>`)
+
+// ExplorerOrigin serves the Swagger UI assets the explorer loads
+const ExplorerOrigin = "https://unpkg.com"
+
+// WriteExplorer writes an interactive API explorer page (Swagger UI) that
+// loads the document served at specURL
+func WriteExplorer(w io.Writer, title, specURL string) error {
+	return explorer.Execute(w, struct{ Title, SpecURL string }{title, specURL})
+}
+
+// ExplorerPolicy returns the Content-Security-Policy the page written by
+// WriteExplorer for specURL needs: Swagger UI from ExplorerOrigin, its
+// inline bootstrap script allowed by hash, and requests to this origin only
+func ExplorerPolicy(specURL string) (string, error) {
+	var page strings.Builder
+	if err := WriteExplorer(&page, "", specURL); err != nil {
+		return "", err
+	}
+	scripts := []string{ExplorerOrigin}
+	for _, m := range inlineScript.FindAllStringSubmatch(page.String(), -1) {
+		sum := sha256.Sum256([]byte(m[1]))
+		scripts = append(scripts, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	}
+	return strings.Join([]string{
+		"default-src 'none'",
+		"script-src " + strings.Join(scripts, " "),
+		// Swagger UI sets style attributes
+		"style-src " + ExplorerOrigin + " 'unsafe-inline'",
+		"img-src 'self' data: " + ExplorerOrigin,
+		"font-src " + ExplorerOrigin,
+		"connect-src 'self'",
+		"base-uri 'none'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}, "; "), nil
+}
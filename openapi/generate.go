@@ -0,0 +1,349 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/apperrors"
+	"github.com/gofrs/uuid"
+)
+
+// Endpoint annotates a route with what the route table cannot tell: its
+// purpose, authentication and the Go types of its bodies
+type Endpoint struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Tags        []string
+	// Secured operations require a bearer token
+	Secured bool
+	// Parameters are added to the path parameters found in Path, e.g.
+	// headers the operation understands
+	Parameters []*Parameter
+	// Request is a value of the request body type; nil for no body
+	Request interface{}
+	// Responses maps success statuses to a value of their body type; a nil
+	// value documents a response without a body
+	Responses map[int]interface{}
+	// ContentType of the success responses, application/json by default
+	ContentType string
+	// Errors lists the statuses answered with a problem document
+	Errors []int
+}
+
+// Generator builds an OpenAPI 3.1 document from endpoint annotations and
+// Go types. Struct schemas follow the json tags; `validate:` tags add
+// constraints, and an `openapi:` tag overrides a field with a component
+// reference ("ref=User"), a format ("format=date-time") or an enum
+// ("enum=user|admin").
+type Generator struct {
+	doc   *Document
+	types map[reflect.Type]string
+}
+
+// NewGenerator returns a Generator for a document described by info
+func NewGenerator(info Info) *Generator {
+	g := &Generator{
+		doc: &Document{
+			OpenAPI: "3.1.0",
+			Info:    info,
+			Paths:   map[string]*PathItem{},
+			Components: Components{
+				Schemas:   map[string]*Schema{},
+				Responses: map[string]*Response{},
+				SecuritySchemes: map[string]*SecurityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				},
+			},
+		},
+		types: map[reflect.Type]string{},
+	}
+	g.Component("Problem", apperrors.Problem{})
+	g.doc.Components.Responses["Problem"] = &Response{
+		Description: "RFC 7807 problem document",
+		Content: map[string]*MediaType{
+			apperrors.ContentType: {Schema: ref("Problem")},
+		},
+	}
+	return g
+}
+
+// Component registers the type of v as the named component schema and
+// returns the schema so callers can refine it. Fields of that type are
+// documented as references to it from then on.
+func (g *Generator) Component(name string, v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Register first so recursive types refer to themselves
+	g.types[t] = name
+	s := g.schema(t, true)
+	g.doc.Components.Schemas[name] = s
+	return s
+}
+
+// Add documents an endpoint. Path uses the {param} syntax of the router;
+// a trailing slash is ignored.
+func (g *Generator) Add(e Endpoint) {
+	path := "/" + strings.Trim(e.Path, "/")
+	item, ok := g.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		g.doc.Paths[path] = item
+	}
+
+	op := &Operation{
+		OperationID: e.OperationID,
+		Summary:     e.Summary,
+		Tags:        e.Tags,
+		Responses:   map[string]*Response{},
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if isTemplate(segment) {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     strings.Trim(segment, "{}"),
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: Types{"string"}},
+			})
+		}
+	}
+	op.Parameters = append(op.Parameters, e.Parameters...)
+	if e.Secured {
+		op.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
+	if e.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: g.SchemaFor(e.Request)}},
+		}
+	}
+
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	for status, body := range e.Responses {
+		res := &Response{Description: http.StatusText(status)}
+		if body != nil {
+			res.Content = map[string]*MediaType{contentType: {Schema: g.SchemaFor(body)}}
+		} else if e.ContentType != "" {
+			res.Content = map[string]*MediaType{contentType: {}}
+		}
+		op.Responses[strconv.Itoa(status)] = res
+	}
+	for _, status := range e.Errors {
+		op.Responses[strconv.Itoa(status)] = &Response{Ref: "#/components/responses/Problem"}
+	}
+
+	switch e.Method {
+	case http.MethodGet:
+		item.Get = op
+	case http.MethodPut:
+		item.Put = op
+	case http.MethodPost:
+		item.Post = op
+	case http.MethodDelete:
+		item.Delete = op
+	case http.MethodPatch:
+		item.Patch = op
+	default:
+		panic(fmt.Sprintf("openapi: unsupported method %q", e.Method))
+	}
+}
+
+// Document returns the generated document, ready for validation
+func (g *Generator) Document() (*Document, error) {
+	// Serve and validate the same bytes: round trip so references resolve
+	// exactly as they would for a client reading the document
+	data, err := json.Marshal(g.doc)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// SchemaFor returns the schema of the type of v, as a reference when the
+// type is a registered component
+func (g *Generator) SchemaFor(v interface{}) *Schema {
+	return g.schema(reflect.TypeOf(v), false)
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schema returns the schema of t. inline forces registered components to
+// be expanded instead of referenced.
+func (g *Generator) schema(t reflect.Type, inline bool) *Schema {
+	if t == nil {
+		return Bool(true)
+	}
+	if t.Kind() == reflect.Ptr {
+		s := g.schema(t.Elem(), inline)
+		switch {
+		case s.Ref != "":
+			return &Schema{AnyOf: []*Schema{s, {Type: Types{"null"}}}}
+		case len(s.Type) > 0:
+			s.Type = append(s.Type, "null")
+		}
+		return s
+	}
+	if name, ok := g.types[t]; ok && !inline {
+		return ref(name)
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: Types{"string"}, Format: "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: Types{"array"}, Items: g.schema(t.Elem(), false)}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}, AdditionalProperties: g.schema(t.Elem(), false)}
+	case reflect.Struct:
+		s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}, AdditionalProperties: Bool(false)}
+		g.fields(t, s)
+		sort.Strings(s.Required)
+		return s
+	default:
+		// interface{} and friends can hold anything
+		return Bool(true)
+	}
+}
+
+// fields adds the JSON fields of struct t to s
+func (g *Generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, s)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(f.Type, false)
+		prop = annotate(prop, f.Tag.Get("openapi"))
+		constrain(prop, f.Tag.Get("validate"))
+		s.Properties[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// annotate applies an `openapi:` tag to s
+func annotate(s *Schema, tag string) *Schema {
+	if tag == "" {
+		return s
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "ref":
+			s = ref(value)
+		case "format":
+			s.Format = value
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, v)
+			}
+		case "description":
+			s.Description = value
+		}
+	}
+	return s
+}
+
+// constrain translates binding rules from a `validate:` tag into schema
+// keywords. Rules without a schema equivalent are left to the binding
+// layer.
+func constrain(s *Schema, tag string) {
+	if tag == "" || s.Ref != "" || len(s.Type) == 0 {
+		return
+	}
+	kind := s.Type[0]
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		n, _ := strconv.Atoi(param)
+		switch name {
+		case "required":
+			if kind == "string" {
+				s.MinLength = atLeast(s.MinLength, 1)
+			}
+		case "email":
+			s.Format = "email"
+		case "uuid":
+			s.Format = "uuid"
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "min", "len":
+			switch kind {
+			case "string":
+				s.MinLength = atLeast(s.MinLength, n)
+			case "array":
+				s.MinItems = &n
+			case "integer", "number":
+				f := float64(n)
+				s.Minimum = &f
+			}
+		}
+		switch name {
+		case "max", "len":
+			switch kind {
+			case "string":
+				s.MaxLength = &n
+			case "array":
+				s.MaxItems = &n
+			case "integer", "number":
+				f := float64(n)
+				s.Maximum = &f
+			}
+		}
+	}
+}
+
+// atLeast returns the larger bound, treating nil as no bound
+func atLeast(bound *int, n int) *int {
+	if bound != nil && *bound > n {
+		return bound
+	}
+	return &n
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
@@ -0,0 +1,288 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const petstore = `
+openapi: 3.1.0
+info: {title: Pets, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, minimum: 1, maximum: 100}}
+        - {name: tags, in: query, schema: {type: array, items: {type: string}}}
+        - {name: X-Tenant, in: header, required: true, schema: {type: string}}
+      responses:
+        200:
+          description: Pets
+          content:
+            application/json:
+              schema: {type: array, items: {$ref: "#/components/schemas/Pet"}}
+    post:
+      operationId: createPet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/Pet"}
+      responses:
+        "201": {description: Created}
+        4XX: {$ref: "#/components/responses/Error"}
+  /pets/mine:
+    get:
+      operationId: myPets
+      responses: {default: {description: Anything}}
+  /pets/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: string, format: uuid}}
+    get:
+      operationId: getPet
+      responses:
+        "200":
+          description: Pet
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Pet"}
+components:
+  responses:
+    Error: {description: Error}
+  schemas:
+    Pet:
+      type: object
+      additionalProperties: false
+      required: [name]
+      properties:
+        name: {type: string, minLength: 1, pattern: "^[A-Z]"}
+        kind: {type: string, enum: [cat, dog]}
+        owner: {type: ["string", "null"], format: email}
+        born: {type: string, format: date-time}
+`
+
+func load(t *testing.T) *Document {
+	t.Helper()
+	doc, err := Load([]byte(petstore))
+	require.NoError(t, err)
+	return doc
+}
+
+func TestLoad_Rejects_Bad_Documents(t *testing.T) {
+	_, err := Load([]byte(`swagger: "2.0"`))
+	assert.Error(t, err)
+
+	_, err = Load([]byte(`{"openapi": "3.1.0", "paths": {"/x": {"get": {"responses": {"200": {"description": "x",
+		"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Missing"}}}}}}}}}`))
+	assert.ErrorContains(t, err, "unresolved reference")
+}
+
+func TestDocument_Find(t *testing.T) {
+	doc := load(t)
+
+	route, params, ok := doc.Find(http.MethodGet, "/pets/mine/")
+	require.True(t, ok)
+	assert.Equal(t, "myPets", route.Operation.OperationID)
+	assert.Empty(t, params)
+
+	route, params, ok = doc.Find(http.MethodGet, "/pets/6f1c8e6a-6b1e-4f43-9a55-2f3b4f6f7a10")
+	require.True(t, ok)
+	assert.Equal(t, "getPet", route.Operation.OperationID)
+	assert.Equal(t, "6f1c8e6a-6b1e-4f43-9a55-2f3b4f6f7a10", params["id"])
+
+	_, _, ok = doc.Find(http.MethodDelete, "/pets")
+	assert.False(t, ok)
+	_, _, ok = doc.Find(http.MethodGet, "/owners")
+	assert.False(t, ok)
+	assert.Len(t, doc.Routes(), 4)
+}
+
+func TestSchema_Validate(t *testing.T) {
+	pet := load(t).Components.Schemas["Pet"]
+
+	assert.Empty(t, pet.Validate("", map[string]interface{}{"name": "Rex", "owner": nil}))
+	assert.Equal(t, map[string][]string{
+		"name":  {"validation_pattern"},
+		"kind":  {"validation_oneof:cat dog"},
+		"owner": {"validation_email"},
+		"born":  {"validation_date_time"},
+		"legs":  {"validation_unknown_field"},
+	}, pet.Validate("", map[string]interface{}{
+		"name": "rex", "kind": "fish", "owner": "nobody", "born": "yesterday", "legs": 4.0,
+	}))
+	assert.Equal(t, map[string][]string{"name": {"validation_required"}}, pet.Validate("", map[string]interface{}{}))
+	assert.Equal(t, map[string][]string{"body": {"validation_type:object"}}, pet.Validate("", "Rex"))
+}
+
+func TestRoute_ValidateRequest_Parameters(t *testing.T) {
+	doc := load(t)
+	route, params, _ := doc.Find(http.MethodGet, "/pets")
+
+	req := httptest.NewRequest(http.MethodGet, "/pets?limit=500&tags=a,b", nil)
+	assert.Equal(t, map[string][]string{
+		"query.limit":     {"validation_max:100"},
+		"header.X-Tenant": {"validation_required"},
+	}, route.ValidateRequest(req, params, nil))
+
+	req = httptest.NewRequest(http.MethodGet, "/pets?limit=ten", nil)
+	req.Header.Set("X-Tenant", "acme")
+	assert.Equal(t, map[string][]string{"query.limit": {"validation_type:integer"}}, route.ValidateRequest(req, params, nil))
+
+	route, params, _ = doc.Find(http.MethodGet, "/pets/42")
+	req = httptest.NewRequest(http.MethodGet, "/pets/42", nil)
+	assert.Equal(t, map[string][]string{"path.id": {"validation_uuid"}}, route.ValidateRequest(req, params, nil))
+}
+
+func TestRoute_ValidateRequest_Body(t *testing.T) {
+	doc := load(t)
+	route, params, _ := doc.Find(http.MethodPost, "/pets")
+
+	validate := func(contentType, body string) map[string][]string {
+		req := httptest.NewRequest(http.MethodPost, "/pets", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return route.ValidateRequest(req, params, []byte(body))
+	}
+
+	assert.Empty(t, validate("application/json; charset=utf-8", `{"name":"Rex"}`))
+	assert.Equal(t, map[string][]string{"body": {"validation_required"}}, validate("application/json", ""))
+	assert.Equal(t, map[string][]string{"body": {"request_body_malformed"}}, validate("application/json", `{"name":`))
+	assert.Equal(t, map[string][]string{"body": {"validation_content_type"}}, validate("text/plain", `Rex`))
+	assert.Equal(t, map[string][]string{"name": {"validation_min_length:1", "validation_pattern"}}, validate("application/json", `{"name":""}`))
+}
+
+func TestRoute_ValidateResponse(t *testing.T) {
+	doc := load(t)
+	route, _, _ := doc.Find(http.MethodGet, "/pets")
+	header := http.Header{"Content-Type": {"application/json"}}
+
+	assert.Empty(t, route.ValidateResponse(http.StatusOK, header, []byte(`[{"name":"Rex"}]`)))
+	assert.Equal(t, []string{"[1].secret: validation_unknown_field"},
+		route.ValidateResponse(http.StatusOK, header, []byte(`[{"name":"Rex"},{"name":"Tom","secret":"x"}]`)))
+	assert.Equal(t, []string{"status 500 is not documented"}, route.ValidateResponse(http.StatusInternalServerError, header, nil))
+
+	create, _, _ := doc.Find(http.MethodPost, "/pets")
+	assert.Empty(t, create.ValidateResponse(http.StatusConflict, header, nil), "4XX covers 409")
+
+	mine, _, _ := doc.Find(http.MethodGet, "/pets/mine")
+	assert.Empty(t, mine.ValidateResponse(http.StatusTeapot, header, []byte(`"anything"`)), "default covers every status")
+}
+
+type genAddress struct {
+	City string `json:"city" validate:"required,max=50"`
+}
+
+type genPerson struct {
+	ID        uuid.UUID   `json:"id"`
+	Name      string      `json:"name" validate:"required,min=2,max=100"`
+	Email     string      `json:"email" validate:"required,email"`
+	Role      string      `json:"role,omitempty" validate:"omitempty,oneof=user admin"`
+	Tags      []string    `json:"tags,omitempty" validate:"max=3"`
+	Born      time.Time   `json:"born" openapi:"description=Date of birth"`
+	Address   *genAddress `json:"address"`
+	Friend    *genPerson  `json:"friend,omitempty"`
+	Secret    string      `json:"-"`
+	CreatedAt string      `json:"created_at" openapi:"format=date-time"`
+}
+
+type genResult struct {
+	Person genPerson `json:"person" openapi:"ref=Person"`
+}
+
+func TestGenerator_Struct_Schema(t *testing.T) {
+	g := NewGenerator(Info{Title: "People", Version: "1"})
+	g.Component("Address", genAddress{})
+	s := g.Component("Person", genPerson{})
+
+	assert.Equal(t, []string{"address", "born", "created_at", "email", "id", "name"}, s.Required)
+	assert.NotContains(t, s.Properties, "Secret")
+	assert.Equal(t, "uuid", s.Properties["id"].Format)
+	assert.Equal(t, "date-time", s.Properties["born"].Format)
+	assert.Equal(t, "Date of birth", s.Properties["born"].Description)
+	assert.Equal(t, "date-time", s.Properties["created_at"].Format)
+	assert.Equal(t, 2, *s.Properties["name"].MinLength)
+	assert.Equal(t, 100, *s.Properties["name"].MaxLength)
+	assert.Equal(t, "email", s.Properties["email"].Format)
+	assert.Equal(t, []interface{}{"user", "admin"}, s.Properties["role"].Enum)
+	assert.Equal(t, 3, *s.Properties["tags"].MaxItems)
+	assert.Equal(t, "#/components/schemas/Address", s.Properties["address"].AnyOf[0].Ref)
+	assert.Equal(t, Types{"null"}, s.Properties["address"].AnyOf[1].Type, "pointers are nullable")
+	assert.Equal(t, "#/components/schemas/Person", s.Properties["friend"].AnyOf[0].Ref, "recursive types refer to themselves")
+}
+
+func TestGenerator_Document(t *testing.T) {
+	g := NewGenerator(Info{Title: "People", Version: "1"})
+	g.Component("Address", genAddress{})
+	g.Component("Person", genPerson{})
+	g.Add(Endpoint{
+		Method: http.MethodPost, Path: "/people/", OperationID: "createPerson",
+		Request:   genPerson{},
+		Responses: map[int]interface{}{http.StatusCreated: genResult{}},
+		Errors:    []int{http.StatusBadRequest},
+	})
+	g.Add(Endpoint{
+		Method: http.MethodGet, Path: "/people/{id}", OperationID: "getPerson", Secured: true,
+		Responses: map[int]interface{}{http.StatusOK: genResult{}},
+	})
+
+	doc, err := g.Document()
+	require.NoError(t, err)
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Contains(t, doc.Components.Schemas, "Problem")
+
+	route, params, ok := doc.Find(http.MethodGet, "/people/42")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"id": "42"}, params)
+	assert.Equal(t, "path", route.Parameters[0].In)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, route.Operation.Security)
+
+	create, _, ok := doc.Find(http.MethodPost, "/people")
+	require.True(t, ok)
+	req := httptest.NewRequest(http.MethodPost, "/people", nil)
+	req.Header.Set("Content-Type", "application/json")
+	errs := create.ValidateRequest(req, nil, []byte(`{"name":"J","email":"nope","born":"2000-01-01T00:00:00Z","address":null,"id":"x","created_at":"now","extra":1}`))
+	assert.Equal(t, []string{"validation_min_length:2"}, errs["name"])
+	assert.Equal(t, []string{"validation_email"}, errs["email"])
+	assert.Equal(t, []string{"validation_uuid"}, errs["id"])
+	assert.Equal(t, []string{"validation_unknown_field"}, errs["extra"])
+	assert.NotContains(t, errs, "address", "pointers are nullable")
+
+	problem := []byte(`{"type":"about:blank","title":"Bad","status":400,"code":"invalid_request"}`)
+	header := http.Header{"Content-Type": {"application/problem+json"}}
+	assert.Empty(t, create.ValidateResponse(http.StatusBadRequest, header, problem))
+	assert.Equal(t, []string{"person: validation_required"},
+		create.ValidateResponse(http.StatusCreated, http.Header{}, []byte(`{}`)))
+}
+
+func TestWriteExplorer(t *testing.T) {
+	var buf strings.Builder
+	require.NoError(t, WriteExplorer(&buf, "People <API>", "/openapi.json"))
+	assert.Contains(t, buf.String(), "People &lt;API&gt;")
+	assert.Contains(t, buf.String(), "/openapi.json")
+}
+
+func TestExplorerPolicy(t *testing.T) {
+	var page strings.Builder
+	require.NoError(t, WriteExplorer(&page, "API", "/openapi.json"))
+	script := inlineScript.FindStringSubmatch(page.String())
+	require.NotNil(t, script)
+	sum := sha256.Sum256([]byte(script[1]))
+
+	policy, err := ExplorerPolicy("/openapi.json")
+	require.NoError(t, err)
+	assert.Contains(t, policy, "script-src https://unpkg.com 'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	assert.Contains(t, policy, "connect-src 'self'")
+
+	other, err := ExplorerPolicy("/v2/openapi.json")
+	require.NoError(t, err)
+	assert.NotEqual(t, policy, other, "the hash covers the spec URL")
+}
@@ -0,0 +1,332 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Schema is the subset of JSON Schema 2020-12, the schema dialect of
+// OpenAPI 3.1, that the API contract uses. The boolean schemas true and
+// false are supported, so `additionalProperties: false` works as usual.
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type   Types         `json:"type,omitempty"`
+	Enum   []interface{} `json:"enum,omitempty"`
+	Const  interface{}   `json:"const,omitempty"`
+	Format string        `json:"format,omitempty"`
+
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+
+	Example interface{} `json:"example,omitempty"`
+
+	// boolean is set for the boolean schemas true and false
+	boolean  *bool
+	resolved *Schema
+	// pattern is Pattern compiled by Load
+	pattern *regexp.Regexp
+}
+
+// Bool returns the boolean schema b: true accepts anything, false nothing
+func Bool(b bool) *Schema {
+	return &Schema{boolean: &b}
+}
+
+type schemaFields Schema
+
+// UnmarshalJSON accepts boolean schemas as well as schema objects
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{boolean: &b}
+		return nil
+	}
+	return json.Unmarshal(data, (*schemaFields)(s))
+}
+
+// MarshalJSON writes boolean schemas as true or false
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.boolean != nil {
+		return json.Marshal(*s.boolean)
+	}
+	return json.Marshal((*schemaFields)(s))
+}
+
+// Types is the JSON Schema "type" keyword, which OpenAPI 3.1 allows to be
+// a single type or a list such as ["string", "null"]
+type Types []string
+
+// UnmarshalJSON accepts a single type name or a list of them
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// MarshalJSON writes a single type as a plain string
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (s *Schema) children() []*Schema {
+	children := []*Schema{s.AdditionalProperties, s.Items}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	children = append(children, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	return append(children, s.OneOf...)
+}
+
+// target follows $ref
+func (s *Schema) target() *Schema {
+	for s != nil && s.resolved != nil {
+		s = s.resolved
+	}
+	return s
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into
+// an interface{}) against s. Failures are keyed by JSON path below path
+// and use the same message IDs as the binding package.
+func (s *Schema) Validate(path string, v interface{}) map[string][]string {
+	errs := map[string][]string{}
+	s.validate(path, v, errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, v interface{}, errs map[string][]string) {
+	s = s.target()
+	if s == nil {
+		return
+	}
+	add := func(p, msg string) {
+		if p == "" {
+			p = "body"
+		}
+		errs[p] = append(errs[p], msg)
+	}
+
+	if s.boolean != nil {
+		if !*s.boolean {
+			add(path, "validation_schema")
+		}
+		return
+	}
+
+	if len(s.Type) > 0 && !s.Type.allows(v) {
+		add(path, "validation_type:"+s.Type[0])
+		return
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, v) {
+		add(path, "validation_oneof:"+join(s.Enum))
+	}
+	if s.Const != nil && !equal(s.Const, v) {
+		add(path, "validation_oneof:"+join([]interface{}{s.Const}))
+	}
+
+	switch v := v.(type) {
+	case string:
+		s.validateString(path, v, add)
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add(path, "validation_min:"+number(*s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add(path, "validation_max:"+number(*s.Maximum))
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add(path, fmt.Sprintf("validation_min_items:%d", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add(path, fmt.Sprintf("validation_max_items:%d", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		s.validateObject(path, v, errs, add)
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(path, v, errs)
+	}
+	if len(s.AnyOf) > 0 && matching(s.AnyOf, path, v) == 0 {
+		add(path, "validation_schema")
+	}
+	if len(s.OneOf) > 0 && matching(s.OneOf, path, v) != 1 {
+		add(path, "validation_schema")
+	}
+}
+
+func (s *Schema) validateString(path, v string, add func(string, string)) {
+	if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+		add(path, fmt.Sprintf("validation_min_length:%d", *s.MinLength))
+	}
+	if s.MaxLength != nil && utf8.RuneCountInString(v) > *s.MaxLength {
+		add(path, fmt.Sprintf("validation_max_length:%d", *s.MaxLength))
+	}
+	if s.pattern != nil {
+		if !s.pattern.MatchString(v) {
+			add(path, "validation_pattern")
+		}
+	}
+	switch s.Format {
+	case "email":
+		if !emailRegex.MatchString(v) {
+			add(path, "validation_email")
+		}
+	case "uuid":
+		if _, err := uuid.FromString(v); err != nil {
+			add(path, "validation_uuid")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+			add(path, "validation_date_time")
+		}
+	}
+}
+
+func (s *Schema) validateObject(path string, v map[string]interface{}, errs map[string][]string, add func(string, string)) {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			add(joinPath(path, name), "validation_required")
+		}
+	}
+	for name, value := range v {
+		if prop, ok := s.Properties[name]; ok {
+			prop.validate(joinPath(path, name), value, errs)
+			continue
+		}
+		if extra := s.AdditionalProperties.target(); extra != nil {
+			if extra.boolean != nil && !*extra.boolean {
+				add(joinPath(path, name), "validation_unknown_field")
+				continue
+			}
+			extra.validate(joinPath(path, name), value, errs)
+		}
+	}
+}
+
+// matching counts the schemas v is valid against
+func matching(schemas []*Schema, path string, v interface{}) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(sub.Validate(path, v)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (t Types) allows(v interface{}) bool {
+	for _, name := range t {
+		switch name {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []interface{}, v interface{}) bool {
+	for _, allowed := range values {
+		if equal(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares JSON values; YAML documents may hold ints where decoded
+// bodies hold float64s
+func equal(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func join(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateRequest checks the parameters and body of r against the route.
+// pathParams holds the values of the path template and body the raw
+// request body. Parameter failures are keyed by location, e.g.
+// "query.limit" or "header.X-Request-ID"; body failures by JSON path.
+func (route *Route) ValidateRequest(r *http.Request, pathParams map[string]string, body []byte) map[string][]string {
+	errs := map[string][]string{}
+	query := r.URL.Query()
+
+	for _, p := range route.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			if v, ok := pathParams[p.Name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+
+		key := p.In + "." + p.Name
+		if len(values) == 0 {
+			if p.Required {
+				errs[key] = append(errs[key], "validation_required")
+			}
+			continue
+		}
+		if p.Schema != nil {
+			merge(errs, p.Schema.Validate(key, coerce(p.Schema, values)))
+		}
+	}
+
+	rb := route.Operation.RequestBody
+	if rb == nil {
+		return errs
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		if rb.Required {
+			errs["body"] = append(errs["body"], "validation_required")
+		}
+		return errs
+	}
+
+	mt, ok := mediaType(rb.Content, r.Header.Get("Content-Type"))
+	if !ok {
+		errs["body"] = append(errs["body"], "validation_content_type")
+		return errs
+	}
+	if mt.Schema == nil {
+		return errs
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		errs["body"] = append(errs["body"], "request_body_malformed")
+		return errs
+	}
+	merge(errs, mt.Schema.Validate("", v))
+	return errs
+}
+
+// ValidateResponse checks a response produced for the route against the
+// documented responses and returns every mismatch found, for logs. body
+// may be nil when the response was not captured.
+func (route *Route) ValidateResponse(status int, header http.Header, body []byte) []string {
+	res := route.response(status)
+	if res == nil {
+		return []string{fmt.Sprintf("status %d is not documented", status)}
+	}
+	if len(res.Content) == 0 || body == nil {
+		return nil
+	}
+
+	mt, ok := mediaType(res.Content, header.Get("Content-Type"))
+	if !ok {
+		return []string{fmt.Sprintf("content type %q is not documented for status %d", header.Get("Content-Type"), status)}
+	}
+	if mt.Schema == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []string{fmt.Sprintf("body is not valid JSON: %v", err)}
+	}
+
+	errs := mt.Schema.Validate("", v)
+	drift := make([]string, 0, len(errs))
+	for path, msgs := range errs {
+		drift = append(drift, path+": "+strings.Join(msgs, ", "))
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+// response returns the documented response for status, trying the exact
+// code, then its class such as "4XX", then "default"
+func (route *Route) response(status int) *Response {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		if res, ok := route.responses[key]; ok {
+			return res
+		}
+	}
+	return nil
+}
+
+// mediaType picks the content entry for contentType. An empty content
+// type matches application/json, the default of the API.
+func mediaType(content map[string]*MediaType, contentType string) (*MediaType, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mt == "" {
+		mt = "application/json"
+	}
+	if m, ok := content[mt]; ok {
+		return m, true
+	}
+	if m, ok := content[mt[:strings.Index(mt+"/", "/")]+"/*"]; ok {
+		return m, true
+	}
+	m, ok := content["*/*"]
+	return m, ok
+}
+
+// coerce converts raw parameter values to the JSON type of schema so they
+// can be validated like body values. Values that do not parse are left as
+// strings and fail the type check.
+func coerce(schema *Schema, values []string) interface{} {
+	s := schema.target()
+	if s.Type.has("array") {
+		items := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			for _, part := range strings.Split(v, ",") {
+				items = append(items, coerceOne(s.Items, part))
+			}
+		}
+		return items
+	}
+	return coerceOne(s, values[0])
+}
+
+func coerceOne(schema *Schema, v string) interface{} {
+	s := schema.target()
+	if s == nil {
+		return v
+	}
+	switch {
+	case s.Type.has("integer"), s.Type.has("number"):
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case s.Type.has("boolean"):
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+func (t Types) has(name string) bool {
+	for _, n := range t {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func merge(dst, src map[string][]string) {
+	for k, v := range src {
+		dst[k] = append(dst[k], v...)
+	}
+}
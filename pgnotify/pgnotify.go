@@ -0,0 +1,38 @@
+// Package pgnotify listens for Postgres notifications, which replicas use
+// to tell each other that shared state changed.
+package pgnotify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Listen calls notified with the payload of every notification on channel
+// until ctx is done, then returns nil. It listens on a connection of its
+// own to url, since a listening session cannot go back to a pool. Once
+// listening it calls notified with "", for the notifications it may have
+// missed while not connected. It returns the error that broke the
+// connection; listen again to resume.
+func Listen(ctx context.Context, url, channel string, notified func(payload string)) error {
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		return fmt.Errorf("pgnotify: %s: %w", channel, err)
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("pgnotify: %s: %w", channel, err)
+	}
+	notified("")
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("pgnotify: %s: %w", channel, err)
+		}
+		notified(n.Payload)
+	}
+}
@@ -0,0 +1,51 @@
+package pgnotify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models"
+	"github.com/akingundogdu/production-ready-go-backend-architecture/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	modelstest.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	payloads := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- Listen(ctx, models.DB.URL(), "pgnotify_test", func(payload string) { payloads <- payload })
+	}()
+
+	receive := func() string {
+		select {
+		case payload := <-payloads:
+			return payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+			return ""
+		}
+	}
+	assert.Equal(t, "", receive(), "listening")
+
+	require.NoError(t, models.DB.RawQuery(`SELECT pg_notify('pgnotify_test', 'one')`).Exec())
+	assert.Equal(t, "one", receive())
+	require.NoError(t, models.DB.RawQuery(`SELECT pg_notify('other', 'two')`).Exec())
+	require.NoError(t, models.DB.RawQuery(`SELECT pg_notify('pgnotify_test', 'three')`).Exec())
+	assert.Equal(t, "three", receive(), "other channels are ignored")
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestListen_Unreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := Listen(ctx, "postgres://localhost:1/none?connect_timeout=1", "pgnotify_test", func(string) {
+		t.Error("not listening")
+	})
+	assert.ErrorContains(t, err, "pgnotify: pgnotify_test")
+}
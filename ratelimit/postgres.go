@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// PostgresStore counts requests in the rate_limit_windows table, so
+// replicas share limits without extra infrastructure. It implements a
+// sliding window: the count of the previous fixed window, weighted by how
+// much of it still overlaps the sliding window, plus the current count
+// must stay within the bucket size. The refill rate of Limit is thereby
+// approximated; Burst still caps requests per window.
+type PostgresStore struct {
+	db  *pop.Connection
+	now func() time.Time
+}
+
+// NewPostgresStore returns a PostgresStore on db
+func NewPostgresStore(db *pop.Connection) *PostgresStore {
+	return &PostgresStore{db: db, now: time.Now}
+}
+
+// errRejected rolls back the count of a rejected request
+var errRejected = errors.New("rate limited")
+
+// Take counts a request for key. Rejected requests are not counted, so a
+// client retrying too early does not push its window further out.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	w := newWindow(s.now(), limit)
+
+	var current, previous int
+	err := s.db.WithContext(ctx).Transaction(func(tx *pop.Connection) error {
+		// The upsert locks the row of the current window, serializing
+		// concurrent requests for the same key
+		if err := tx.RawQuery(`INSERT INTO rate_limit_windows (key, window_start, count, expires_at)
+			VALUES (?, ?, 1, ?)
+			ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_windows.count + 1
+			RETURNING count`, key, w.start, w.expires).First(&current); err != nil {
+			return err
+		}
+		err := tx.RawQuery(`SELECT count FROM rate_limit_windows WHERE key = ? AND window_start = ?`,
+			key, w.start-w.size).First(&previous)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if !w.allows(previous, current) {
+			return errRejected
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRejected) {
+		return Result{}, fmt.Errorf("ratelimit: postgres: %w", err)
+	}
+	return w.result(previous, current, err == nil), nil
+}
+
+// DeleteExpired removes windows that no longer affect any limit
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := s.db.WithContext(ctx).RawQuery(`WITH gone AS (DELETE FROM rate_limit_windows WHERE expires_at < ? RETURNING 1)
+		SELECT count(*) FROM gone`, s.now()).First(&deleted)
+	if err != nil {
+		return 0, fmt.Errorf("ratelimit: postgres cleanup: %w", err)
+	}
+	return deleted, nil
+}
+
+// window is the fixed window holding now, in milliseconds
+type window struct {
+	start   int64
+	size    int64
+	now     int64
+	max     int
+	expires time.Time
+}
+
+func newWindow(now time.Time, l Limit) window {
+	ms := now.UnixMilli()
+	size := l.Period.Milliseconds()
+	start := ms - ms%size
+	return window{
+		start: start,
+		size:  size,
+		now:   ms,
+		max:   l.Capacity(),
+		// The window still weighs on the next one
+		expires: time.UnixMilli(start + 2*size),
+	}
+}
+
+// weight is the share of the previous window still inside the sliding
+// window
+func (w window) weight() float64 {
+	return 1 - float64(w.now-w.start)/float64(w.size)
+}
+
+// estimate returns the requests counted in the sliding window
+func (w window) estimate(previous, current int) float64 {
+	return float64(previous)*w.weight() + float64(current)
+}
+
+func (w window) allows(previous, current int) bool {
+	return w.estimate(previous, current) <= float64(w.max)
+}
+
+// result describes the window after a request counted in current was
+// allowed or rejected; rejected requests are rolled back
+func (w window) result(previous, current int, allowed bool) Result {
+	if !allowed {
+		current--
+	}
+	used := w.estimate(previous, current)
+	r := Result{
+		Allowed:   allowed,
+		Limit:     w.max,
+		Remaining: int(math.Max(0, math.Floor(float64(w.max)-used))),
+	}
+
+	end := w.start + w.size
+	// The sliding window is empty once it has passed the current window
+	r.Reset = time.Duration(end-w.now) * time.Millisecond
+	if current > 0 {
+		r.Reset += time.Duration(w.size) * time.Millisecond
+	}
+
+	if !allowed {
+		// Wait for the previous window to slide out far enough to make
+		// room for one request, or for the next window
+		wait := end - w.now
+		if previous > 0 {
+			excess := used + 1 - float64(w.max)
+			if slide := int64(math.Ceil(excess / float64(previous) * float64(w.size))); slide < wait {
+				wait = slide
+			}
+		}
+		r.RetryAfter = time.Duration(wait) * time.Millisecond
+	}
+	return r
+}
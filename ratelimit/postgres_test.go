@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow_Slides(t *testing.T) {
+	l := PerMinute(10)
+	start := time.Unix(1700000000-1700000000%60, 0)
+
+	w := newWindow(start.Add(15*time.Second), l)
+	assert.Equal(t, 0.75, w.weight())
+	assert.Equal(t, start.Add(2*time.Minute), w.expires)
+
+	// 8 requests last minute weigh 6 a quarter into this one
+	assert.True(t, w.allows(8, 4))
+	assert.False(t, w.allows(8, 5))
+
+	r := w.result(8, 4, true)
+	assert.Equal(t, Result{Allowed: true, Limit: 10, Remaining: 0, Reset: 105 * time.Second}, r)
+
+	r = w.result(8, 5, false)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+	assert.Equal(t, 7500*time.Millisecond, r.RetryAfter, "an eighth of the window makes room for one")
+
+	w = newWindow(start.Add(30*time.Second), l)
+	r = w.result(0, 11, false)
+	assert.Equal(t, 30*time.Second, r.RetryAfter, "without a previous window, wait for the next one")
+}
+
+// postgresStore returns a store on the test database, skipping the test
+// when the database is not running. The database is opened from
+// database.yml rather than through models, which imports config and so
+// this package.
+func postgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	db, err := pop.Connect("test")
+	if err == nil {
+		err = db.RawQuery("SELECT 1").Exec()
+	}
+	if err != nil {
+		t.Skipf("database unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	require.NoError(t, db.RawQuery("DELETE FROM rate_limit_windows").Exec())
+	return NewPostgresStore(db)
+}
+
+func TestPostgresStore(t *testing.T) {
+	s := postgresStore(t)
+	c := &clock{t: time.Unix(1700000000-1700000000%60, 0)}
+	s.now = c.now
+	ctx := context.Background()
+	l := PerMinute(3)
+
+	for want := 2; want >= 0; want-- {
+		r, err := s.Take(ctx, "a", l)
+		require.NoError(t, err)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, want, r.Remaining)
+	}
+	r, err := s.Take(ctx, "a", l)
+	require.NoError(t, err)
+	assert.False(t, r.Allowed)
+
+	r, err = s.Take(ctx, "b", l)
+	require.NoError(t, err)
+	assert.True(t, r.Allowed, "keys have their own windows")
+
+	c.advance(3 * time.Minute)
+	deleted, err := s.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	r, err = s.Take(ctx, "a", l)
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+}
@@ -0,0 +1,153 @@
+// Package ratelimit implements token-bucket rate limiting over pluggable
+// stores. A bucket holds up to Burst tokens and refills at Requests per
+// Period; every request takes a token and is rejected when none is left.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is the size and refill rate of a bucket
+type Limit struct {
+	// Requests are allowed per Period on average
+	Requests int
+	Period   time.Duration
+	// Burst is the bucket size, the number of requests allowed at once;
+	// it defaults to Requests
+	Burst int
+}
+
+// MinPeriod is the shortest Period: buckets refill per millisecond
+const MinPeriod = time.Millisecond
+
+// PerSecond allows n requests per second
+func PerSecond(n int) Limit {
+	return Limit{Requests: n, Period: time.Second}
+}
+
+// PerMinute allows n requests per minute
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+// ParseLimit parses limits written as "requests/period" with an optional
+// burst, e.g. "10/m", "300/1m", "5/s" or "100/1h,burst=20"
+func ParseLimit(s string) (Limit, error) {
+	spec, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ",")
+	reqs, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, want requests/period", s)
+	}
+
+	var l Limit
+	var err error
+	if l.Requests, err = strconv.Atoi(strings.TrimSpace(reqs)); err != nil || l.Requests <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid request count in %q", s)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if l.Period, err = time.ParseDuration(period); err != nil || l.Period <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid period in %q", s)
+	}
+	if l.Period < MinPeriod {
+		return Limit{}, fmt.Errorf("ratelimit: period in %q is shorter than %s", s, MinPeriod)
+	}
+	if hasBurst {
+		v, ok := strings.CutPrefix(strings.TrimSpace(burst), "burst=")
+		if l.Burst, err = strconv.Atoi(v); !ok || err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", s)
+		}
+	}
+	return l, nil
+}
+
+// String formats l the way ParseLimit reads it
+func (l Limit) String() string {
+	s := fmt.Sprintf("%d/%s", l.Requests, l.Period)
+	if l.Burst > 0 && l.Burst != l.Requests {
+		s += fmt.Sprintf(",burst=%d", l.Burst)
+	}
+	return s
+}
+
+// MarshalText formats l as String does
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses a limit written as ParseLimit reads it
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Capacity returns the bucket size
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate returns the refill rate in tokens per millisecond
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / float64(l.Period.Milliseconds())
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is how long until a token is available; zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps buckets. Take must be atomic: concurrent calls for the same
+// key must not spend the same token twice.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// refill returns the tokens of a bucket that held tokens at last, as of
+// now (both in milliseconds)
+func refill(tokens float64, last, now int64, l Limit) float64 {
+	if elapsed := now - last; elapsed > 0 {
+		tokens += float64(elapsed) * l.rate()
+	}
+	return math.Min(tokens, float64(l.Capacity()))
+}
+
+// result describes a bucket left with tokens after a take
+func result(allowed bool, tokens float64, l Limit) Result {
+	rate := l.rate()
+	r := Result{
+		Allowed:   allowed,
+		Limit:     l.Capacity(),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     millis((float64(l.Capacity()) - tokens) / rate),
+	}
+	if !allowed {
+		r.RetryAfter = millis((1 - tokens) / rate)
+	}
+	return r
+}
+
+func millis(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
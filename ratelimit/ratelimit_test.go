@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+	}{
+		{"10/m", Limit{Requests: 10, Period: time.Minute}},
+		{"300/1m", Limit{Requests: 300, Period: time.Minute}},
+		{"5/s", Limit{Requests: 5, Period: time.Second}},
+		{" 100/1h,burst=20 ", Limit{Requests: 100, Period: time.Hour, Burst: 20}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+
+		again, err := ParseLimit(got.String())
+		require.NoError(t, err)
+		assert.Equal(t, got, again, "String round trips")
+	}
+
+	for _, in := range []string{"", "10", "0/m", "x/m", "10/", "10/-1s", "10/m,burst=0", "10/m,size=3", "10/500us"} {
+		_, err := ParseLimit(in)
+		assert.Error(t, err, in)
+	}
+}
+
+// clock is a settable time source for stores
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newClock() *clock                   { return &clock{t: time.Unix(1700000000, 0)} }
+func take(t *testing.T, s Store, key string, l Limit) Result {
+	t.Helper()
+	r, err := s.Take(context.Background(), key, l)
+	require.NoError(t, err)
+	return r
+}
+
+// testStore runs the behaviour every store must share
+func testStore(t *testing.T, s Store, c *clock) {
+	l := Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+	for want := 2; want >= 0; want-- {
+		r := take(t, s, "a", l)
+		assert.True(t, r.Allowed)
+		assert.Equal(t, 3, r.Limit)
+		assert.Equal(t, want, r.Remaining)
+		assert.Zero(t, r.RetryAfter)
+	}
+
+	r := take(t, s, "a", l)
+	assert.False(t, r.Allowed, "the burst is spent")
+	assert.Equal(t, 0, r.Remaining)
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter, "one token refills in 1s/2")
+	assert.Equal(t, 1500*time.Millisecond, r.Reset)
+
+	assert.True(t, take(t, s, "b", l).Allowed, "keys have their own buckets")
+
+	c.advance(500 * time.Millisecond)
+	assert.True(t, take(t, s, "a", l).Allowed, "a token refilled")
+	assert.False(t, take(t, s, "a", l).Allowed)
+
+	c.advance(time.Hour)
+	assert.Equal(t, 2, take(t, s, "a", l).Remaining, "buckets refill up to the burst")
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := newClock()
+	s := NewMemoryStore()
+	s.now = c.now
+	testStore(t, s, c)
+}
+
+func TestMemoryStore_Sweeps_Full_Buckets(t *testing.T) {
+	c := newClock()
+	s := NewMemoryStore()
+	s.now = c.now
+
+	take(t, s, "a", PerSecond(1))
+	take(t, s, "b", PerMinute(1))
+	c.advance(2 * time.Second)
+	take(t, s, "c", PerSecond(1))
+	assert.Equal(t, 3, s.Len())
+
+	c.advance(sweepInterval)
+	take(t, s, "c", PerSecond(1))
+	assert.Equal(t, 1, s.Len(), "a and b refilled and are forgotten")
+}
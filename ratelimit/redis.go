@@ -0,0 +1,287 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// takeScript spends a token atomically inside the server. Buckets are
+// hashes of tokens and last refill time (ms) that expire once full. Tokens
+// are returned as a string because Lua numbers become integers in replies.
+const takeScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1]) or capacity
+local last = tonumber(bucket[2]) or now
+if now > last then
+  tokens = math.min(capacity, tokens + (now - last) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(math.max(now, last)))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisStore keeps buckets in a server speaking the Redis protocol (Redis,
+// Valkey, KeyDB, Dragonfly...), so every instance shares the same limits.
+// Buckets are updated by a Lua script, which makes Take atomic. The clock
+// of the calling instance is used, so keep instance clocks in sync.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	// tls is set for rediss:// URLs
+	tls *tls.Config
+
+	mu   sync.Mutex
+	idle []*redisConn
+	now  func() time.Time
+}
+
+// maxIdleConns bounds the connections kept open between calls
+const maxIdleConns = 8
+
+// NewRedisStore returns a RedisStore for a URL such as
+// "redis://:password@localhost:6379/0", or "rediss://" to connect over
+// TLS. Keys are prefixed with "ratelimit:".
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("ratelimit: invalid redis URL %q", rawURL)
+	}
+	s := &RedisStore{
+		addr:    u.Host,
+		prefix:  "ratelimit:",
+		timeout: time.Second,
+		now:     time.Now,
+	}
+	if !strings.Contains(u.Host, ":") {
+		s.addr += ":6379"
+	}
+	if u.Scheme == "rediss" {
+		s.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	if u.User != nil {
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid redis database %q", db)
+		}
+	}
+	return s, nil
+}
+
+// Take spends a token from the bucket of key
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	args := []string{
+		s.prefix + key,
+		strconv.Itoa(limit.Capacity()),
+		strconv.FormatFloat(limit.rate(), 'g', -1, 64),
+		strconv.FormatInt(s.now().UnixMilli(), 10),
+	}
+	reply, err := conn.do(ctx, append([]string{"EVALSHA", takeScriptSHA, "1"}, args...)...)
+	var serverErr redisError
+	if errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "NOSCRIPT") {
+		// First use on this server: send the script itself, which also
+		// caches it for EVALSHA
+		reply, err = conn.do(ctx, append([]string{"EVAL", takeScript, "1"}, args...)...)
+	}
+	s.release(conn, err)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: redis: %w", err)
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: redis: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: redis: unexpected tokens %q", raw)
+	}
+	return result(allowed == 1, tokens, limit), nil
+}
+
+// Close closes the idle connections
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.idle {
+		c.Close()
+	}
+	s.idle = nil
+	return nil
+}
+
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	d := &net.Dialer{Timeout: s.timeout}
+	var nc net.Conn
+	var err error
+	if s.tls != nil {
+		nc, err = (&tls.Dialer{NetDialer: d, Config: s.tls}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: redis: %w", err)
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), timeout: s.timeout}
+	if s.password != "" {
+		if _, err := c.do(ctx, "AUTH", s.password); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ratelimit: redis auth: %w", err)
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(s.db)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ratelimit: redis select: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// release returns c to the pool unless the call broke it. Server errors
+// leave the connection usable; I/O errors do not.
+func (s *RedisStore) release(c *redisConn, err error) {
+	var serverErr redisError
+	if err != nil && !errors.As(err, &serverErr) {
+		c.Close()
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.idle) >= maxIdleConns {
+		c.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisConn speaks RESP, the Redis serialization protocol
+type redisConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// do sends a command and reads its reply: a string, int64, nil,
+// []interface{} or a redisError
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	reply, err := readReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
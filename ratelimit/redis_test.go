@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis speaks enough RESP to run takeScript, emulating the script in
+// Go. It records the commands it receives.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	commands []string
+	cached   bool
+	buckets  map[string][2]float64
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return serveFakeRedis(t, ln, password)
+}
+
+// newFakeRedisTLS is newFakeRedis over TLS, with a certificate for
+// 127.0.0.1 signed by the returned pool
+func newFakeRedisTLS(t *testing.T, password string) (*fakeRedis, *x509.CertPool) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: srv.TLS.Certificates})
+	require.NoError(t, err)
+	return serveFakeRedis(t, ln, password), pool
+}
+
+func serveFakeRedis(t *testing.T, ln net.Listener, password string) *fakeRedis {
+	f := &fakeRedis{ln: ln, password: password, buckets: map[string][2]float64{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		parts := reply.([]interface{})
+		args := make([]string, len(parts))
+		for i, p := range parts {
+			args[i] = p.(string)
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var out string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			out = "+OK\r\n"
+			if !authed {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			out = "+OK\r\n"
+		case args[0] == "EVALSHA" && !f.cached:
+			out = "-NOSCRIPT No matching script.\r\n"
+		case args[0] == "EVALSHA" || args[0] == "EVAL":
+			if args[0] == "EVAL" {
+				f.cached = args[1] == takeScript
+			}
+			out = f.take(args[3], args[4:])
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		fmt.Fprint(conn, out)
+	}
+}
+
+// take mirrors takeScript
+func (f *fakeRedis) take(key string, argv []string) string {
+	capacity, _ := strconv.ParseFloat(argv[0], 64)
+	rate, _ := strconv.ParseFloat(argv[1], 64)
+	now, _ := strconv.ParseFloat(argv[2], 64)
+	tokens, last := capacity, now
+	if b, ok := f.buckets[key]; ok {
+		tokens, last = b[0], b[1]
+	}
+	if now > last {
+		tokens = min(capacity, tokens+(now-last)*rate)
+	}
+	allowed := 0
+	if tokens >= 1 {
+		tokens--
+		allowed = 1
+	}
+	f.buckets[key] = [2]float64{tokens, max(now, last)}
+	s := strconv.FormatFloat(tokens, 'g', -1, 64)
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(s), s)
+}
+
+func (f *fakeRedis) sent() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.commands, " ")
+}
+
+func TestRedisStore(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	s, err := NewRedisStore("redis://:secret@" + f.ln.Addr().String() + "/2")
+	require.NoError(t, err)
+	defer s.Close()
+	c := newClock()
+	s.now = c.now
+
+	testStore(t, s, c)
+	assert.True(t, strings.HasPrefix(f.sent(), "AUTH SELECT EVALSHA EVAL EVALSHA EVALSHA"), f.sent())
+	assert.NotContains(t, f.sent(), "AUTH SELECT EVALSHA EVAL EVALSHA AUTH", "connections are reused")
+	assert.Contains(t, f.buckets, "ratelimit:a")
+}
+
+func TestRedisStore_TLS(t *testing.T) {
+	f, pool := newFakeRedisTLS(t, "secret")
+	s, err := NewRedisStore("rediss://:secret@" + f.ln.Addr().String())
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "127.0.0.1", s.tls.ServerName)
+	s.tls.RootCAs = pool
+
+	res, err := s.Take(t.Context(), "a", PerSecond(1))
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.True(t, strings.HasPrefix(f.sent(), "AUTH EVALSHA"), f.sent())
+
+	untrusted, err := NewRedisStore("rediss://:secret@" + f.ln.Addr().String())
+	require.NoError(t, err)
+	_, err = untrusted.Take(t.Context(), "a", PerSecond(1))
+	assert.ErrorContains(t, err, "certificate", "servers are verified")
+}
+
+func TestRedisStore_Errors(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	s, err := NewRedisStore("redis://:wrong@" + f.ln.Addr().String())
+	require.NoError(t, err)
+	_, err = s.Take(t.Context(), "a", PerSecond(1))
+	assert.ErrorContains(t, err, "WRONGPASS")
+
+	s, err = NewRedisStore("redis://127.0.0.1:1")
+	require.NoError(t, err)
+	_, err = s.Take(t.Context(), "a", PerSecond(1))
+	assert.Error(t, err)
+
+	for _, u := range []string{"localhost:6379", "http://localhost", "redis://localhost/x"} {
+		_, err := NewRedisStore(u)
+		assert.Error(t, err, u)
+	}
+}
@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// EncryptedFileProvider reads secrets from an age encrypted YAML file of
+// name: value pairs, binary or armored, such as one written by
+//
+//	age -r age1... -a -o secrets.yaml.age secrets.yaml
+//
+// The file is decrypted on every lookup, so a replaced file is picked up
+// on the next refresh.
+type EncryptedFileProvider struct {
+	Path       string
+	identities []age.Identity
+}
+
+// NewEncryptedFileProvider returns a provider of the secrets in path,
+// decrypted with the age identities in identity, such as
+// "AGE-SECRET-KEY-1..."
+func NewEncryptedFileProvider(path, identity string) (*EncryptedFileProvider, error) {
+	ids, err := age.ParseIdentities(strings.NewReader(identity))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: parsing age identity: %w", err)
+	}
+	return &EncryptedFileProvider{Path: path, identities: ids}, nil
+}
+
+// Get decrypts the file and returns the value of name
+func (p *EncryptedFileProvider) Get(_ context.Context, name string) (string, error) {
+	values, err := p.decrypt()
+	if err != nil {
+		return "", err
+	}
+	v, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// decrypt reads and decrypts the file
+func (p *EncryptedFileProvider) decrypt() (map[string]string, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+	r, err := age.Decrypt(src, p.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: decrypting %s: %w", p.Path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: decrypting %s: %w", p.Path, err)
+	}
+	values := map[string]string{}
+	if err := yaml.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("secrets: %s: %w", p.Path, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encryptFile writes plaintext encrypted to recipient, armored or not,
+// and returns its path
+func encryptFile(t *testing.T, recipient age.Recipient, armored bool, plaintext string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.WriteCloser = nopCloser{&buf}
+	if armored {
+		out = armor.NewWriter(&buf)
+	}
+	w, err := age.Encrypt(out, recipient)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, plaintext)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, out.Close())
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml.age")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	return path
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestEncryptedFileProvider(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	plaintext := "JWT_SECRET: s3cr3t\nDATABASE_URL: postgres://app:pw@db/app\n"
+
+	for _, armored := range []bool{false, true} {
+		p, err := NewEncryptedFileProvider(encryptFile(t, id.Recipient(), armored, plaintext), id.String())
+		require.NoError(t, err)
+
+		v, err := p.Get(context.Background(), "JWT_SECRET")
+		require.NoError(t, err, "armored: %v", armored)
+		assert.Equal(t, "s3cr3t", v)
+
+		_, err = p.Get(context.Background(), "REDIS_URL")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+}
+
+func TestEncryptedFileProvider_Errors(t *testing.T) {
+	_, err := NewEncryptedFileProvider("secrets.yaml.age", "not an identity")
+	assert.ErrorContains(t, err, "age identity")
+
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	p, err := NewEncryptedFileProvider(encryptFile(t, other.Recipient(), false, "JWT_SECRET: x\n"), id.String())
+	require.NoError(t, err)
+	_, err = p.Get(context.Background(), "JWT_SECRET")
+	assert.ErrorContains(t, err, "decrypting")
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Key is a signing key
+type Key struct {
+	// ID is derived from the secret, so every instance agrees on it
+	// without configuration; it reveals nothing about the secret
+	ID     string
+	Secret []byte
+}
+
+// NewKey returns the key of secret
+func NewKey(secret string) Key {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("key id"))
+	return Key{ID: hex.EncodeToString(mac.Sum(nil))[:16], Secret: []byte(secret)}
+}
+
+// Keyring holds the current signing key and the previous keys still
+// accepted, so tokens signed before a rotation stay valid. It is safe for
+// concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	current Key
+	keys    map[string]Key
+}
+
+// NewKeyring returns a keyring signing with current and accepting
+// previous
+func NewKeyring(current string, previous ...string) *Keyring {
+	k := &Keyring{}
+	k.Rotate(current, previous...)
+	return k
+}
+
+// Current returns the signing key
+func (k *Keyring) Current() Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// Lookup returns the key with id, current or previous
+func (k *Keyring) Lookup(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// Rotate replaces the keys and reports whether they changed
+func (k *Keyring) Rotate(current string, previous ...string) bool {
+	keys := map[string]Key{}
+	cur := NewKey(current)
+	keys[cur.ID] = cur
+	for _, secret := range previous {
+		key := NewKey(secret)
+		keys[key.ID] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	changed := cur.ID != k.current.ID || len(keys) != len(k.keys)
+	for id := range keys {
+		if _, ok := k.keys[id]; !ok {
+			changed = true
+		}
+	}
+	k.current, k.keys = cur, keys
+	return changed
+}
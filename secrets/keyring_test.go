@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKey(t *testing.T) {
+	key := NewKey("first-secret")
+	assert.Equal(t, key, NewKey("first-secret"), "IDs are stable")
+	assert.Len(t, key.ID, 16)
+	assert.NotEqual(t, key.ID, NewKey("second-secret").ID)
+	assert.NotContains(t, key.ID, "first")
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	first, second := NewKey("first-secret"), NewKey("second-secret")
+	k := NewKeyring("first-secret")
+	assert.Equal(t, first, k.Current())
+	assert.False(t, k.Rotate("first-secret"), "same keys")
+
+	assert.True(t, k.Rotate("second-secret", "first-secret"))
+	assert.Equal(t, second, k.Current())
+	prev, ok := k.Lookup(first.ID)
+	assert.True(t, ok, "the previous key is still accepted")
+	assert.Equal(t, first, prev)
+
+	assert.True(t, k.Rotate("second-secret"), "the previous key was dropped")
+	_, ok = k.Lookup(first.ID)
+	assert.False(t, ok)
+	_, ok = k.Lookup(second.ID)
+	assert.True(t, ok)
+}
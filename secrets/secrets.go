@@ -0,0 +1,63 @@
+// Package secrets looks up secrets such as the JWT signing key in the
+// environment, mounted files, an age encrypted file or a Vault-compatible
+// server, and holds rotating signing keys.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobuffalo/envy"
+)
+
+// ErrNotFound is returned for secrets a provider does not hold
+var ErrNotFound = errors.New("secrets: not found")
+
+// Provider looks secrets up by name, such as "JWT_SECRET"
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// EnvProvider reads secrets from environment variables of the same name
+type EnvProvider struct{}
+
+// Get returns the variable name
+func (EnvProvider) Get(_ context.Context, name string) (string, error) {
+	v, err := envy.MustGet(name)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// FileProvider reads secrets from files named after them in Dir, such as
+// a Kubernetes secret volume or /run/secrets for Docker secrets
+type FileProvider struct {
+	Dir string
+}
+
+// Get returns the content of the file name in Dir
+func (p FileProvider) Get(_ context.Context, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("secrets: invalid secret name %q", name)
+	}
+	v, err := ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	return v, err
+}
+
+// ReadFile reads the secret in path, without the trailing newline editors
+// and echo add
+func ReadFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobuffalo/envy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvProvider(t *testing.T) {
+	envy.Temp(func() {
+		envy.Set("SECRETS_TEST_TOKEN", "t0k3n")
+		v, err := EnvProvider{}.Get(context.Background(), "SECRETS_TEST_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, "t0k3n", v)
+	})
+	_, err := EnvProvider{}.Get(context.Background(), "SECRETS_TEST_UNSET")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "JWT_SECRET"), []byte("from-a-mount\n"), 0o600))
+	p := FileProvider{Dir: dir}
+
+	v, err := p.Get(context.Background(), "JWT_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-a-mount", v, "the trailing newline is dropped")
+
+	_, err = p.Get(context.Background(), "DATABASE_URL")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, name := range []string{"", "../etc/passwd", "sub/JWT_SECRET", "..data"} {
+		_, err = p.Get(context.Background(), name)
+		assert.ErrorContains(t, err, "invalid secret name", name)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("line one\nline two\r\n"), 0o600))
+	v, err := ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line one\nline two", v)
+}
@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// vaultTimeout bounds a lookup when the client has no timeout of its own
+const vaultTimeout = 10 * time.Second
+
+// VaultProvider reads secrets from one secret of the KV version 2 engine
+// of Vault or a compatible server such as OpenBao: names are the keys of
+// the secret at Path
+type VaultProvider struct {
+	// Addr is the server address, such as "https://vault.internal:8200"
+	Addr  string
+	Token string
+	// Mount is where the KV engine is mounted, "secret" by default
+	Mount string
+	Path  string
+	// Client defaults to a client with a 10 second timeout
+	Client *http.Client
+}
+
+// vaultResponse is the part of a KV v2 read response used
+type vaultResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// Get reads the secret at Path and returns its key name
+func (p *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	u, err := url.JoinPath(p.Addr, "v1", mount, "data", p.Path)
+	if err != nil {
+		return "", fmt.Errorf("secrets: vault address: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: vault: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body vaultResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil && res.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("secrets: vault: decoding %s: %w", p.Path, err)
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case res.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("secrets: vault: reading %s: %s %s", p.Path, res.Status, strings.Join(body.Errors, "; "))
+	}
+
+	v, ok := body.Data.Data[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
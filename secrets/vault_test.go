@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultStub serves the KV v2 secret app/backend of the mount "kv" to
+// requests with the token "root"
+func vaultStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Header.Get("X-Vault-Token") != "root":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/data/app/backend":
+			_, _ = w.Write([]byte(`{"data":{"data":{"JWT_SECRET":"from-vault","DATABASE_POOL":25},"metadata":{"version":3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := vaultStub(t)
+	p := &VaultProvider{Addr: srv.URL, Token: "root", Mount: "kv", Path: "app/backend"}
+
+	v, err := p.Get(context.Background(), "JWT_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", v)
+
+	v, err = p.Get(context.Background(), "DATABASE_POOL")
+	require.NoError(t, err)
+	assert.Equal(t, "25", v)
+
+	_, err = p.Get(context.Background(), "REDIS_URL")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestVaultProvider_Errors(t *testing.T) {
+	srv := vaultStub(t)
+
+	p := &VaultProvider{Addr: srv.URL, Token: "root", Mount: "kv", Path: "app/missing"}
+	_, err := p.Get(context.Background(), "JWT_SECRET")
+	assert.ErrorIs(t, err, ErrNotFound, "a missing secret")
+
+	p = &VaultProvider{Addr: srv.URL, Token: "expired", Mount: "kv", Path: "app/backend"}
+	_, err = p.Get(context.Background(), "JWT_SECRET")
+	assert.ErrorContains(t, err, "403 Forbidden permission denied")
+
+	srv.Close()
+	_, err = p.Get(context.Background(), "JWT_SECRET")
+	assert.ErrorContains(t, err, "secrets: vault")
+}
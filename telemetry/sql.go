@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/luna-duclos/instrumentedsql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SQLDriverOptions returns the instrumentedsql options that turn every
+// database call into a child span of the span in the query context.
+// Query arguments are omitted so secrets never end up in traces.
+func SQLDriverOptions() []instrumentedsql.Opt {
+	return []instrumentedsql.Opt{
+		instrumentedsql.WithTracer(sqlTracer{}),
+		instrumentedsql.WithOmitArgs(),
+		instrumentedsql.WithOpsExcluded(instrumentedsql.OpSQLRowsNext),
+	}
+}
+
+// sqlTracer adapts OpenTelemetry to the instrumentedsql.Tracer interface
+type sqlTracer struct{}
+
+func (sqlTracer) GetSpan(ctx context.Context) instrumentedsql.Span {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return sqlSpan{ctx: ctx}
+}
+
+// sqlSpan wraps an OpenTelemetry span. The zero span is a no-op and is
+// used for the parent handed out by GetSpan.
+type sqlSpan struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+// NewChild starts a client span for a database operation. Queries made
+// without a recording parent span (migrations, background jobs without
+// tracing) are not traced to avoid flooding the exporter with root spans.
+func (s sqlSpan) NewChild(name string) instrumentedsql.Span {
+	if !trace.SpanFromContext(s.ctx).SpanContext().IsValid() {
+		return sqlSpan{ctx: s.ctx}
+	}
+	ctx, span := Tracer().Start(s.ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+	return sqlSpan{ctx: ctx, span: span}
+}
+
+func (s sqlSpan) SetLabel(k, v string) {
+	if s.span == nil {
+		return
+	}
+	if k == "query" {
+		s.span.SetAttributes(semconv.DBQueryText(v))
+		return
+	}
+	s.span.SetAttributes(attribute.String("db."+k, v))
+}
+
+func (s sqlSpan) SetError(err error) {
+	if s.span == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s sqlSpan) Finish() {
+	if s.span != nil {
+		s.span.End()
+	}
+}
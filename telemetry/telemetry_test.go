@@ -0,0 +1,118 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useRecorder installs a tracer provider that keeps finished spans in memory
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetup_File(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Config{
+		ServiceName: "test",
+		Exporter:    ExporterFile,
+		FilePath:    path,
+	})
+	require.NoError(t, err)
+
+	_, span := StartSpan(context.Background(), "file-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "file-span")
+}
+
+func TestSetup_Unknown_Exporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "carrier-pigeon"})
+	assert.Error(t, err)
+}
+
+func TestExtract_Inject_RoundTrip(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := Extract(context.Background(), in)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(ctx))
+
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, in.Get("traceparent"), out.Get("traceparent"))
+}
+
+func TestTraceID_Empty(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+}
+
+func TestEndSpan_Records_Error(t *testing.T) {
+	recorder := useRecorder(t)
+
+	_, span := StartSpan(context.Background(), "failing")
+	EndSpan(span, errors.New("boom"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestSQLTracer_Child_Of_Request_Span(t *testing.T) {
+	recorder := useRecorder(t)
+
+	ctx, parent := StartSpan(context.Background(), "request")
+	child := sqlTracer{}.GetSpan(ctx).NewChild("sql-conn-query")
+	child.SetLabel("query", "SELECT 1")
+	child.Finish()
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "sql-conn-query", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestSQLTracer_Skips_Untraced_Queries(t *testing.T) {
+	recorder := useRecorder(t)
+
+	child := sqlTracer{}.GetSpan(context.Background()).NewChild("sql-conn-query")
+	child.SetLabel("query", "SELECT 1")
+	child.SetError(errors.New("ignored"))
+	child.Finish()
+
+	assert.Empty(t, recorder.Ended())
+}